@@ -1,22 +1,29 @@
 package util
 
 const (
-	ComponentKey           string = "component"
-	ComponentMain          string = "main"
-	ComponentExo           string = "exo"
-	ComponentCert          string = "certificate builder"
-	ComponentCleanup       string = "cleanup"
-	ComponentKeyGen        string = "key pair generator"
-	ComponentSecretGen     string = "secret generator"
-	ComponentHmac          string = "hmac index builder"
-	ComponentOnePassword   string = "1password cli"
-	ComponenetPermissions  string = "permissions"
-	ComponentPatToken      string = "pat token"
-	ComponentPatVerifier   string = "pat verifier"
-	ComponentS2sCaller     string = "s2s caller"
-	ComponentScopes        string = "scopes"
-	ComponentStorage       string = "storage"
-	ComponentTokenProvider string = "token provider"
+	ComponentKey            string = "component"
+	ComponentMain           string = "main"
+	ComponentExo            string = "exo"
+	ComponentCert           string = "certificate builder"
+	ComponentAuthorizer     string = "authorizer"
+	ComponentCleanup        string = "cleanup"
+	ComponentKeyGen         string = "key pair generator"
+	ComponentSecretGen      string = "secret generator"
+	ComponentHmac           string = "hmac index builder"
+	ComponentIdempotency    string = "idempotency"
+	ComponentJwksFetcher    string = "jwks fetcher"
+	ComponentJwksHandler    string = "jwks handler"
+	ComponentOnePassword    string = "1password cli"
+	ComponenetPermissions   string = "permissions"
+	ComponentPatToken       string = "pat token"
+	ComponentPatVerifier    string = "pat verifier"
+	ComponentPeerAuthorizer string = "peer authorizer"
+	ComponentPkiReloader    string = "pki reloader"
+	ComponentS2sCaller      string = "s2s caller"
+	ComponentS2sLogging     string = "s2s logging"
+	ComponentScopes         string = "scopes"
+	ComponentStorage        string = "storage"
+	ComponentTokenProvider  string = "token provider"
 
 	FrameworkKey      string = "framework"
 	FrameworkCarapace string = "carapace"
@@ -27,6 +34,7 @@ const (
 	PackageKey         string = "package"
 	PackageConnect     string = "connect"
 	PackageExo         string = "exo"
+	PackageJwks        string = "jwks"
 	PackageMain        string = "main"
 	PackageOnePassword string = "1password"
 	PackagePat         string = "pat"
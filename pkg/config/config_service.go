@@ -160,6 +160,15 @@ func Load(def SvcDefinition) (*Config, error) {
 		}
 
 		config.Pat.Pepper = pepper
+
+		// optional: pepper rotation
+		config.Pat.PepperVersion = os.Getenv(p + "PAT_PEPPER_VERSION")
+		config.Pat.PreviousPepper = os.Getenv(p + "PAT_PREVIOUS_PEPPER")
+		config.Pat.PreviousPepperVersion = os.Getenv(p + "PAT_PREVIOUS_PEPPER_VERSION")
+
+		if config.Pat.PreviousPepper != "" && config.Pat.PepperVersion == "" {
+			return nil, fmt.Errorf("%sPAT_PEPPER_VERSION must be set to rotate the pat pepper", p)
+		}
 	}
 
 	// if oauth redirect is required, read oauth redirect related env vars into config struct based on
@@ -526,6 +526,50 @@ func TestLoad(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "pat generator pepper rotation",
+			def: SvcDefinition{
+				ServiceName: "cantina",
+				Tls:         StandardTls,
+				Requires:    Requires{PatGenerator: true},
+			},
+			env: map[string]string{
+				"CANTINA_SERVICE_CLIENT_ID":          "wuher-barkeep",
+				"CANTINA_SERVICE_PORT":               ":8443",
+				"CANTINA_SERVER_CERT":                serverCert,
+				"CANTINA_SERVER_KEY":                 serverKey,
+				"CANTINA_PAT_PEPPER":                 "figrin-dan-pepper",
+				"CANTINA_PAT_PEPPER_VERSION":         "2",
+				"CANTINA_PAT_PREVIOUS_PEPPER":        "mos-eisley-cantina-pepper",
+				"CANTINA_PAT_PREVIOUS_PEPPER_VERSION": "",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Pat.Pepper != "figrin-dan-pepper" || cfg.Pat.PepperVersion != "2" {
+					t.Errorf("Pat.Pepper/PepperVersion = %q/%q", cfg.Pat.Pepper, cfg.Pat.PepperVersion)
+				}
+				if cfg.Pat.PreviousPepper != "mos-eisley-cantina-pepper" || cfg.Pat.PreviousPepperVersion != "" {
+					t.Errorf("Pat.PreviousPepper/PreviousPepperVersion = %q/%q", cfg.Pat.PreviousPepper, cfg.Pat.PreviousPepperVersion)
+				}
+			},
+		},
+		{
+			name: "pat generator previous pepper without version",
+			def: SvcDefinition{
+				ServiceName: "cantina",
+				Tls:         StandardTls,
+				Requires:    Requires{PatGenerator: true},
+			},
+			env: map[string]string{
+				"CANTINA_SERVICE_CLIENT_ID":   "wuher-barkeep",
+				"CANTINA_SERVICE_PORT":        ":8443",
+				"CANTINA_SERVER_CERT":         serverCert,
+				"CANTINA_SERVER_KEY":          serverKey,
+				"CANTINA_PAT_PEPPER":          "figrin-dan-pepper",
+				"CANTINA_PAT_PREVIOUS_PEPPER": "mos-eisley-cantina-pepper",
+			},
+			wantErr:     true,
+			errContains: "CANTINA_PAT_PEPPER_VERSION must be set",
+		},
 
 		// --- OAuth redirect ---
 		{
@@ -74,7 +74,12 @@ type Gallery struct {
 // Pat is the model that holds personal access token (pat) configuration (pepper secret) for
 // services that need to generate or verify personal access tokens.
 type Pat struct {
-	Pepper string
+	Pepper        string
+	PepperVersion string // optional: versions the pepper so it can be rotated, see pat.NewPatKeyring
+
+	// optional: the pepper being rotated out, whose version is empty if it was unversioned
+	PreviousPepper        string
+	PreviousPepperVersion string
 }
 
 // Jwt is the model that holds jwt configuration (signing and verifying keys) for
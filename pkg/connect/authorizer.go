@@ -0,0 +1,218 @@
+package connect
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/tdeslauriers/carapace/internal/util"
+	"github.com/tdeslauriers/carapace/pkg/connect/telemetry"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	"google.golang.org/grpc"
+)
+
+const (
+	// S2sAuthorizationHeader is the request header carrying the service-to-service access token.
+	S2sAuthorizationHeader = "Service-Authorization"
+
+	// UserAuthorizationHeader is the request header carrying the user access token.
+	UserAuthorizationHeader = "Authorization"
+)
+
+// authTokenKey is the context key type used to store verified tokens in the request context
+type authTokenKey string
+
+const (
+	s2sTokenKey  authTokenKey = "s2s_token"
+	userTokenKey authTokenKey = "user_token"
+)
+
+// RouteScopes is the set of allowed scopes for a route, by token type.
+// A token type with no allowed scopes is not required, nor checked, for the route.
+// A route with no allowed scopes for either token type is denied.
+type RouteScopes struct {
+	S2s  []string // allowed scopes for the Service-Authorization token
+	User []string // allowed scopes for the Authorization token
+}
+
+// Authorizer is an interface for http middleware and grpc server interceptors that verify the s2s and user
+// access tokens of a request before passing it to the route's or method's handler.
+type Authorizer interface {
+
+	// Authorize wraps the handler so it is only called once the request's tokens are verified against
+	// the route's allowed scopes.  The verified tokens are added to the request context and can be
+	// retrieved with S2sTokenFromContext and UserTokenFromContext.
+	// Failed verification is responded to with the standard unauthorized/forbidden json errors.
+	Authorize(scopes RouteScopes, next http.Handler) http.Handler
+
+	// UnaryServerInterceptor returns a grpc unary server interceptor which verifies the tokens in the
+	// incoming metadata against the allowed scopes of the called method, keyed by full method name,
+	// eg, "/gallery.AlbumService/GetAlbum".  Methods not in the map are denied.
+	UnaryServerInterceptor(methods map[string]RouteScopes) grpc.UnaryServerInterceptor
+
+	// StreamServerInterceptor returns a grpc stream server interceptor with the same checks as UnaryServerInterceptor.
+	StreamServerInterceptor(methods map[string]RouteScopes) grpc.StreamServerInterceptor
+}
+
+// AuthorizerOption is a functional option for configuring the Authorizer.
+type AuthorizerOption func(*authorizer)
+
+// WithRequireBoundS2sTokens rejects s2s tokens which are not bound to a client certificate (RFC 8705).
+// Certificate bound tokens are always checked against the peer certificate, whether or not this option is set.
+func WithRequireBoundS2sTokens() AuthorizerOption {
+	return func(a *authorizer) { a.requireBoundS2s = true }
+}
+
+// NewAuthorizer creates a new Authorizer interface with an underlying implementation.
+// The user verifier may be nil for services which only accept s2s tokens.
+func NewAuthorizer(s2s, user jwt.Verifier, opts ...AuthorizerOption) Authorizer {
+
+	a := &authorizer{
+		s2s:  s2s,
+		user: user,
+
+		logger: slog.Default().
+			With(slog.String(util.FrameworkKey, util.FrameworkCarapace)).
+			With(slog.String(util.PackageKey, util.PackageConnect)).
+			With(slog.String(util.ComponentKey, util.ComponentAuthorizer)),
+	}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+var _ Authorizer = (*authorizer)(nil)
+
+// authorizer is the concrete implementation of the Authorizer interface.
+type authorizer struct {
+	s2s  jwt.Verifier
+	user jwt.Verifier
+
+	requireBoundS2s bool // s2s tokens must be bound to the peer's client certificate
+
+	logger *slog.Logger
+}
+
+// errAuthConfig is returned when a route's authorization is misconfigured, eg, no allowed scopes.
+// It is not the caller's fault, so it is never reported as unauthorized or forbidden.
+var errAuthConfig = errors.New("authorization misconfigured")
+
+// Authorize implements the Authorizer interface.
+func (a *authorizer) Authorize(scopes RouteScopes, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		log := a.logger
+		if tel, ok := r.Context().Value(telemetry.TelemetryKey).(*telemetry.Telemetry); ok && tel != nil {
+			log = log.With(tel.TelemetryFields()...)
+		}
+
+		ctx, provider, err := a.authorizeTokens(
+			r.Context(),
+			scopes,
+			r.Header.Get(S2sAuthorizationHeader),
+			r.Header.Get(UserAuthorizationHeader),
+			peerCertificate(r),
+		)
+		if err != nil {
+			log.Error("failed to authorize request", slog.String("auth_provider", string(provider)), slog.String("err", err.Error()))
+
+			if errors.Is(err, errAuthConfig) {
+				e := ErrorHttp{
+					StatusCode: http.StatusInternalServerError,
+					Message:    "internal server error",
+				}
+				e.SendJsonErr(w)
+				return
+			}
+
+			RespondAuthFailure(provider, err, w)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authorizeTokens is a helper method which verifies the s2s and user tokens required by the route's scopes,
+// and that certificate bound tokens were presented by the peer holding the certificate,
+// returning a context carrying the verified tokens, or the token type which failed and the error.
+func (a *authorizer) authorizeTokens(
+	ctx context.Context,
+	scopes RouteScopes,
+	s2sToken string,
+	userToken string,
+	peerCert *x509.Certificate,
+) (context.Context, AuthProvider, error) {
+
+	// deny by default: a route must declare the scopes it allows
+	if len(scopes.S2s) == 0 && len(scopes.User) == 0 {
+		return nil, "", fmt.Errorf("%w: no allowed scopes configured for route", errAuthConfig)
+	}
+
+	if len(scopes.S2s) > 0 {
+		tkn, err := verifyToken(a.s2s, scopes.S2s, s2sToken)
+		if err != nil {
+			return nil, S2s, err
+		}
+
+		if a.requireBoundS2s && !tkn.Claims.IsCertificateBound() {
+			return nil, S2s, fmt.Errorf("%w: s2s token is not bound to a client certificate", jwt.ErrCertificateMismatch)
+		}
+
+		if err := tkn.Claims.VerifyCertificateBinding(peerCert); err != nil {
+			return nil, S2s, err
+		}
+		ctx = context.WithValue(ctx, s2sTokenKey, tkn)
+	}
+
+	if len(scopes.User) > 0 {
+		tkn, err := verifyToken(a.user, scopes.User, userToken)
+		if err != nil {
+			return nil, User, err
+		}
+
+		if err := tkn.Claims.VerifyCertificateBinding(peerCert); err != nil {
+			return nil, User, err
+		}
+		ctx = context.WithValue(ctx, userTokenKey, tkn)
+	}
+
+	return ctx, "", nil
+}
+
+// verifyToken is a helper function which verifies a token against the allowed scopes.
+func verifyToken(v jwt.Verifier, allowed []string, token string) (*jwt.Token, error) {
+
+	if v == nil {
+		return nil, fmt.Errorf("%w: no verifier configured for token type required by route", errAuthConfig)
+	}
+
+	return v.BuildAuthorized(allowed, token)
+}
+
+// peerCertificate is a helper function which returns the client certificate of an mTLS request, or nil.
+func peerCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// S2sTokenFromContext returns the verified s2s access token added to the request context by the Authorizer.
+func S2sTokenFromContext(ctx context.Context) (*jwt.Token, bool) {
+	tkn, ok := ctx.Value(s2sTokenKey).(*jwt.Token)
+	return tkn, ok && tkn != nil
+}
+
+// UserTokenFromContext returns the verified user access token added to the request context by the Authorizer.
+func UserTokenFromContext(ctx context.Context) (*jwt.Token, bool) {
+	tkn, ok := ctx.Value(userTokenKey).(*jwt.Token)
+	return tkn, ok && tkn != nil
+}
@@ -0,0 +1,165 @@
+package connect
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"maps"
+
+	"github.com/tdeslauriers/carapace/pkg/connect/telemetry"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// S2sAuthorizationMetadata is the grpc metadata key carrying the service-to-service access token.
+	S2sAuthorizationMetadata = "service-authorization"
+
+	// UserAuthorizationMetadata is the grpc metadata key carrying the user access token.
+	UserAuthorizationMetadata = "authorization"
+)
+
+// UnaryServerInterceptor implements the Authorizer interface.
+func (a *authorizer) UnaryServerInterceptor(methods map[string]RouteScopes) grpc.UnaryServerInterceptor {
+
+	// copy so the caller cannot mutate the method scopes after construction
+	scopes := maps.Clone(methods)
+
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+
+		authorized, err := a.authorizeGrpc(ctx, info.FullMethod, scopes)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(authorized, req)
+	}
+}
+
+// StreamServerInterceptor implements the Authorizer interface.
+func (a *authorizer) StreamServerInterceptor(methods map[string]RouteScopes) grpc.StreamServerInterceptor {
+
+	// copy so the caller cannot mutate the method scopes after construction
+	scopes := maps.Clone(methods)
+
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+
+		authorized, err := a.authorizeGrpc(ss.Context(), info.FullMethod, scopes)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: authorized})
+	}
+}
+
+// authorizedStream wraps a grpc.ServerStream to carry the context holding the verified tokens.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context holding the verified tokens.
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+// authorizeGrpc is a helper method which verifies the tokens in the incoming metadata against
+// the called method's allowed scopes, returning a context carrying the verified tokens or a grpc status error.
+func (a *authorizer) authorizeGrpc(ctx context.Context, method string, methods map[string]RouteScopes) (context.Context, error) {
+
+	log := a.logger.With(slog.String("grpc_method", method))
+	if tel, ok := ctx.Value(telemetry.TelemetryKey).(*telemetry.Telemetry); ok && tel != nil {
+		log = log.With(tel.TelemetryFields()...)
+	}
+
+	// deny by default: a method must declare the scopes it allows
+	scopes, ok := methods[method]
+	if !ok {
+		log.Error("no allowed scopes configured for grpc method: denying request")
+		return nil, status.Error(codes.PermissionDenied, "method is not authorized")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	authorized, provider, err := a.authorizeTokens(
+		ctx,
+		scopes,
+		firstMetadata(md, S2sAuthorizationMetadata),
+		firstMetadata(md, UserAuthorizationMetadata),
+		grpcPeerCertificate(ctx),
+	)
+	if err != nil {
+		log.Error("failed to authorize grpc request", slog.String("auth_provider", string(provider)), slog.String("err", err.Error()))
+		return nil, grpcAuthFailure(provider, err)
+	}
+
+	return authorized, nil
+}
+
+// firstMetadata is a helper function which returns the first value of a metadata key, or an empty string.
+func firstMetadata(md metadata.MD, key string) string {
+	if vals := md.Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+// grpcPeerCertificate is a helper function which returns the client certificate of an mTLS grpc connection, or nil.
+func grpcPeerCertificate(ctx context.Context) *x509.Certificate {
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return info.State.PeerCertificates[0]
+}
+
+// grpcAuthFailure is the grpc equivalent of RespondAuthFailure: it maps a token verification error
+// to a status error with the standard unauthorized/forbidden messages.
+func grpcAuthFailure(auth AuthProvider, err error) error {
+
+	var unauthorized string
+	var forbidden string
+
+	if auth == S2s {
+		unauthorized = jwt.S2sUnauthorizedErrMsg
+		forbidden = jwt.S2sForbiddenErrMsg
+	} else {
+		unauthorized = jwt.UserUnauthorizedErrMsg
+		forbidden = jwt.UserForbdiddenErrMsg
+	}
+
+	switch {
+	case errors.Is(err, errAuthConfig):
+		return status.Error(codes.Internal, "internal server error")
+	case errors.Is(err, jwt.ErrUnauthorized):
+		return status.Error(codes.Unauthenticated, unauthorized)
+	case errors.Is(err, jwt.ErrForbidden):
+		return status.Error(codes.PermissionDenied, forbidden)
+	default:
+		return status.Errorf(codes.Internal, "internal server error - failed to validate %s token", auth)
+	}
+}
@@ -0,0 +1,205 @@
+package connect
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const testGrpcMethod = "/gallery.AlbumService/GetAlbum"
+
+// mockServerStream implements grpc.ServerStream for testing.
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (m *mockServerStream) Context() context.Context { return m.ctx }
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	methods := map[string]RouteScopes{
+		testGrpcMethod: {S2s: []string{"r:gallery:*"}, User: []string{"r:gallery:album"}},
+	}
+
+	tests := []struct {
+		name     string
+		s2s      *mockVerifier
+		user     *mockVerifier
+		method   string
+		md       metadata.MD
+		wantCode codes.Code
+	}{
+		{
+			name:     "authorized",
+			s2s:      &mockVerifier{},
+			user:     &mockVerifier{},
+			method:   testGrpcMethod,
+			md:       metadata.Pairs(S2sAuthorizationMetadata, "Bearer valid", UserAuthorizationMetadata, "Bearer valid"),
+			wantCode: codes.OK,
+		},
+		{
+			name:     "method_not_configured_denied",
+			s2s:      &mockVerifier{},
+			user:     &mockVerifier{},
+			method:   "/gallery.AlbumService/DeleteAlbum",
+			md:       metadata.Pairs(S2sAuthorizationMetadata, "Bearer valid", UserAuthorizationMetadata, "Bearer valid"),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "no_metadata_unauthenticated",
+			s2s:      &mockVerifier{err: jwt.ErrMissingToken},
+			user:     &mockVerifier{},
+			method:   testGrpcMethod,
+			md:       nil,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "user_token_forbidden",
+			s2s:      &mockVerifier{},
+			user:     &mockVerifier{err: jwt.ErrMissingScope},
+			method:   testGrpcMethod,
+			md:       metadata.Pairs(S2sAuthorizationMetadata, "Bearer valid", UserAuthorizationMetadata, "Bearer other"),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "unexpected_error_internal",
+			s2s:      &mockVerifier{err: errors.New("boom")},
+			user:     &mockVerifier{},
+			method:   testGrpcMethod,
+			md:       metadata.Pairs(S2sAuthorizationMetadata, "Bearer other"),
+			wantCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+
+			var called bool
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				if _, ok := S2sTokenFromContext(ctx); !ok {
+					t.Error("s2s token missing from handler context")
+				}
+				if _, ok := UserTokenFromContext(ctx); !ok {
+					t.Error("user token missing from handler context")
+				}
+				return "ok", nil
+			}
+
+			interceptor := NewAuthorizer(tt.s2s, tt.user).UnaryServerInterceptor(methods)
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("status code: want %v, got %v (err: %v)", tt.wantCode, got, err)
+			}
+			if called != (tt.wantCode == codes.OK) {
+				t.Errorf("handler called: want %v, got %v", tt.wantCode == codes.OK, called)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	methods := map[string]RouteScopes{
+		testGrpcMethod: {S2s: []string{"r:gallery:*"}},
+	}
+
+	tests := []struct {
+		name     string
+		s2s      *mockVerifier
+		md       metadata.MD
+		wantCode codes.Code
+	}{
+		{
+			name:     "authorized",
+			s2s:      &mockVerifier{},
+			md:       metadata.Pairs(S2sAuthorizationMetadata, "Bearer valid"),
+			wantCode: codes.OK,
+		},
+		{
+			name:     "unauthenticated",
+			s2s:      &mockVerifier{err: jwt.ErrTokenExpired},
+			md:       metadata.Pairs(S2sAuthorizationMetadata, "Bearer expired"),
+			wantCode: codes.Unauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := &mockServerStream{ctx: metadata.NewIncomingContext(context.Background(), tt.md)}
+
+			var called bool
+			handler := func(srv interface{}, stream grpc.ServerStream) error {
+				called = true
+				if _, ok := S2sTokenFromContext(stream.Context()); !ok {
+					t.Error("s2s token missing from stream context")
+				}
+				return nil
+			}
+
+			interceptor := NewAuthorizer(tt.s2s, nil).StreamServerInterceptor(methods)
+			err := interceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: testGrpcMethod}, handler)
+
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("status code: want %v, got %v (err: %v)", tt.wantCode, got, err)
+			}
+			if called != (tt.wantCode == codes.OK) {
+				t.Errorf("handler called: want %v, got %v", tt.wantCode == codes.OK, called)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor_CertificateBinding(t *testing.T) {
+	methods := map[string]RouteScopes{
+		testGrpcMethod: {S2s: []string{"r:gallery:*"}},
+	}
+
+	bound := testClientCert(t, "service-b")
+	other := testClientCert(t, "service-c")
+	cnf := &jwt.Confirmation{X5tS256: jwt.CertificateThumbprint(bound)}
+
+	tests := []struct {
+		name     string
+		peer     *x509.Certificate
+		wantCode codes.Code
+	}{
+		{name: "bound_peer", peer: bound, wantCode: codes.OK},
+		{name: "other_peer", peer: other, wantCode: codes.Unauthenticated},
+		{name: "no_peer", wantCode: codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(S2sAuthorizationMetadata, "Bearer valid"))
+			if tt.peer != nil {
+				ctx = peer.NewContext(ctx, &peer.Peer{
+					AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.peer}}},
+				})
+			}
+
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+			interceptor := NewAuthorizer(&mockVerifier{cnf: cnf}, nil).UnaryServerInterceptor(methods)
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: testGrpcMethod}, handler)
+
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("status code: want %v, got %v (err: %v)", tt.wantCode, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package connect
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+)
+
+// mockVerifier implements jwt.Verifier for testing, authorizing only the token "valid".
+type mockVerifier struct {
+	err error             // returned for any token other than "valid"
+	cnf *jwt.Confirmation // optional: certificate binding of the "valid" token
+}
+
+func (m *mockVerifier) VerifySignature(msg string, sig []byte) error { return nil }
+
+func (m *mockVerifier) BuildAuthorized(allowedScopes []string, token string) (*jwt.Token, error) {
+	if token == "Bearer valid" {
+		return &jwt.Token{Claims: jwt.Claims{Subject: "subject", Scopes: allowedScopes[0], Confirmation: m.cnf}}, nil
+	}
+	return nil, m.err
+}
+
+var _ jwt.Verifier = (*mockVerifier)(nil)
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name       string
+		s2s        jwt.Verifier
+		user       jwt.Verifier
+		scopes     RouteScopes
+		s2sHeader  string
+		userHeader string
+		wantStatus int
+		wantMsg    string
+		wantS2s    bool
+		wantUser   bool
+	}{
+		{
+			name:       "s2s_and_user_authorized",
+			s2s:        &mockVerifier{},
+			user:       &mockVerifier{},
+			scopes:     RouteScopes{S2s: []string{"r:svc:*"}, User: []string{"r:svc:*"}},
+			s2sHeader:  "Bearer valid",
+			userHeader: "Bearer valid",
+			wantStatus: http.StatusOK,
+			wantS2s:    true,
+			wantUser:   true,
+		},
+		{
+			name:       "s2s_only_route",
+			s2s:        &mockVerifier{},
+			scopes:     RouteScopes{S2s: []string{"r:svc:*"}},
+			s2sHeader:  "Bearer valid",
+			wantStatus: http.StatusOK,
+			wantS2s:    true,
+		},
+		{
+			name:       "s2s_unauthorized",
+			s2s:        &mockVerifier{err: jwt.ErrTokenExpired},
+			user:       &mockVerifier{},
+			scopes:     RouteScopes{S2s: []string{"r:svc:*"}, User: []string{"r:svc:*"}},
+			s2sHeader:  "Bearer expired",
+			userHeader: "Bearer valid",
+			wantStatus: http.StatusUnauthorized,
+			wantMsg:    jwt.S2sUnauthorizedErrMsg,
+		},
+		{
+			name:       "user_forbidden",
+			s2s:        &mockVerifier{},
+			user:       &mockVerifier{err: jwt.ErrMissingScope},
+			scopes:     RouteScopes{S2s: []string{"r:svc:*"}, User: []string{"r:svc:*"}},
+			s2sHeader:  "Bearer valid",
+			userHeader: "Bearer other",
+			wantStatus: http.StatusForbidden,
+			wantMsg:    jwt.UserForbdiddenErrMsg,
+		},
+		{
+			name:       "missing_user_header",
+			s2s:        &mockVerifier{},
+			user:       &mockVerifier{err: jwt.ErrMissingToken},
+			scopes:     RouteScopes{S2s: []string{"r:svc:*"}, User: []string{"r:svc:*"}},
+			s2sHeader:  "Bearer valid",
+			wantStatus: http.StatusUnauthorized,
+			wantMsg:    jwt.UserUnauthorizedErrMsg,
+		},
+		{
+			name:       "no_scopes_denied_by_default",
+			s2s:        &mockVerifier{},
+			user:       &mockVerifier{},
+			scopes:     RouteScopes{},
+			s2sHeader:  "Bearer valid",
+			userHeader: "Bearer valid",
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "user_scopes_without_user_verifier",
+			s2s:        &mockVerifier{},
+			scopes:     RouteScopes{S2s: []string{"r:svc:*"}, User: []string{"r:svc:*"}},
+			s2sHeader:  "Bearer valid",
+			userHeader: "Bearer valid",
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				called   bool
+				gotS2s   bool
+				gotUser  bool
+				s2sToken *jwt.Token
+			)
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				s2sToken, gotS2s = S2sTokenFromContext(r.Context())
+				_, gotUser = UserTokenFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/resource", nil)
+			if tt.s2sHeader != "" {
+				req.Header.Set(S2sAuthorizationHeader, tt.s2sHeader)
+			}
+			if tt.userHeader != "" {
+				req.Header.Set(UserAuthorizationHeader, tt.userHeader)
+			}
+			rec := httptest.NewRecorder()
+
+			NewAuthorizer(tt.s2s, tt.user).Authorize(tt.scopes, next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status: want %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				if called {
+					t.Fatal("next handler called for unauthorized request")
+				}
+				if tt.wantMsg != "" {
+					var e ErrorHttp
+					if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+						t.Fatalf("failed to decode error response: %v", err)
+					}
+					if e.Message != tt.wantMsg {
+						t.Errorf("message: want %q, got %q", tt.wantMsg, e.Message)
+					}
+				}
+				return
+			}
+
+			if gotS2s != tt.wantS2s {
+				t.Errorf("s2s token in context: want %v, got %v", tt.wantS2s, gotS2s)
+			}
+			if gotUser != tt.wantUser {
+				t.Errorf("user token in context: want %v, got %v", tt.wantUser, gotUser)
+			}
+			if tt.wantS2s && s2sToken.Claims.Subject != "subject" {
+				t.Errorf("s2s token subject: want %q, got %q", "subject", s2sToken.Claims.Subject)
+			}
+		})
+	}
+}
+
+// testClientCert creates a self-signed client certificate for binding tests, failing the test on error.
+func testClientCert(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate client key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create client cert: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse client cert: %v", err)
+	}
+	return cert
+}
+
+func TestAuthorize_CertificateBinding(t *testing.T) {
+
+	bound := testClientCert(t, "service-b")
+	other := testClientCert(t, "service-c")
+	cnf := &jwt.Confirmation{X5tS256: jwt.CertificateThumbprint(bound)}
+
+	tests := []struct {
+		name       string
+		cnf        *jwt.Confirmation
+		peer       *x509.Certificate
+		opts       []AuthorizerOption
+		wantStatus int
+	}{
+		{
+			name:       "bound_token_from_bound_peer",
+			cnf:        cnf,
+			peer:       bound,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "bound_token_replayed_from_other_peer",
+			cnf:        cnf,
+			peer:       other,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "bound_token_without_tls",
+			cnf:        cnf,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unbound_token_allowed_by_default",
+			peer:       other,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unbound_token_rejected_when_required",
+			peer:       other,
+			opts:       []AuthorizerOption{WithRequireBoundS2sTokens()},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/resource", nil)
+			req.Header.Set(S2sAuthorizationHeader, "Bearer valid")
+			if tt.peer != nil {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.peer}}
+			}
+			rec := httptest.NewRecorder()
+
+			a := NewAuthorizer(&mockVerifier{cnf: tt.cnf}, nil, tt.opts...)
+			a.Authorize(RouteScopes{S2s: []string{"r:svc:*"}}, next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status: want %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package connect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ReasonCircuitOpen is sent in the ErrorHttp reason field when a call fails fast because the
+// downstream service's circuit breaker is open.
+const ReasonCircuitOpen string = "circuit_open"
+
+// CircuitState is the state of a downstream service's circuit breaker.
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // requests are sent
+	CircuitOpen                         // requests fail fast
+	CircuitHalfOpen                     // a limited number of probe requests are sent to test if the downstream recovered
+)
+
+// String returns the circuit state's name, eg, for health checks.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerConfiguration is a struct that holds the configuration for a downstream service's circuit breaker.
+// A failure is a request attempt which errors, eg, a timeout, or returns a 5xx other than 500.
+// Zero values default to 5 consecutive failures, a 60 second window of at least 10 requests,
+// a 30 second open timeout, and 1 half-open probe.
+type CircuitBreakerConfiguration struct {
+	ConsecutiveFailures int           // trips the breaker after this many failures in a row, 0 to disable unless FailureRate is also 0
+	FailureRate         float64       // trips the breaker when this fraction of the window's requests fail, eg, 0.5, 0 to disable
+	MinRequests         int           // requests required in the window before the failure rate is considered
+	Window              time.Duration // the failure rate window
+	OpenTimeout         time.Duration // how long the breaker stays open before half-open probes are sent
+	HalfOpenRequests    int           // probes sent when half-open, all must succeed to close the breaker
+}
+
+// WithCircuitBreaker attaches a circuit breaker to the S2sCaller: once the downstream service is failing,
+// calls fail fast with a 503 ErrorHttp, rather than each burning its retries, until a probe succeeds.
+func WithCircuitBreaker(cfg CircuitBreakerConfiguration) S2sCallerOption {
+	return func(c *S2sCaller) { c.breaker = newCircuitBreaker(cfg) }
+}
+
+// CircuitState returns the state of the S2sCaller's circuit breaker, eg, for health checks.
+// It is always closed if the S2sCaller has no circuit breaker.
+func (caller *S2sCaller) CircuitState() CircuitState {
+
+	if caller.breaker == nil {
+		return CircuitClosed
+	}
+
+	return caller.breaker.currentState()
+}
+
+// attemptResult is the outcome of a request attempt as recorded by the circuit breaker.
+type attemptResult int
+
+const (
+	attemptSucceeded attemptResult = iota
+	attemptFailed                  // the downstream service failed, see isDownstreamFailure
+	attemptReleased                // the attempt says nothing about the downstream service, so it is not recorded
+)
+
+// circuitBreaker is a closed/open/half-open circuit breaker for a downstream service.
+type circuitBreaker struct {
+	cfg CircuitBreakerConfiguration
+	now func() time.Time
+
+	mu           sync.Mutex
+	state        CircuitState
+	generation   int // incremented on every state change, so results from a previous state are ignored
+	consecutive  int
+	windowStart  time.Time
+	requests     int
+	failures     int
+	openedAt     time.Time
+	probes       int // half-open probes in flight or succeeded
+	probeSuccess int
+}
+
+// newCircuitBreaker creates a new circuit breaker, applying defaults to zero configuration values.
+func newCircuitBreaker(cfg CircuitBreakerConfiguration) *circuitBreaker {
+
+	if cfg.ConsecutiveFailures <= 0 && cfg.FailureRate <= 0 {
+		cfg.ConsecutiveFailures = 5
+	}
+
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+
+	return &circuitBreaker{
+		cfg: cfg,
+		now: time.Now,
+	}
+}
+
+// currentState returns the breaker's state, moving from open to half-open once the open timeout has passed.
+func (b *circuitBreaker) currentState() CircuitState {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.checkOpenTimeout()
+
+	return b.state
+}
+
+// allow reports whether a request may be sent.  If it may, the returned done function must be called
+// with the request's outcome.
+func (b *circuitBreaker) allow() (func(result attemptResult), bool) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.checkOpenTimeout()
+
+	switch b.state {
+	case CircuitOpen:
+		return nil, false
+	case CircuitHalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			return nil, false
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(result attemptResult) { b.record(generation, result) }, true
+}
+
+// record updates the breaker with a request's outcome, tripping or closing it if needed.
+// A released attempt only frees its half-open probe slot, so another probe can be sent.
+func (b *circuitBreaker) record(generation int, result attemptResult) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// the breaker changed state since the request was allowed
+	if generation != b.generation {
+		return
+	}
+
+	if result == attemptReleased {
+		if b.state == CircuitHalfOpen {
+			b.probes--
+		}
+		return
+	}
+
+	failed := result == attemptFailed
+
+	switch b.state {
+	case CircuitHalfOpen:
+		if failed {
+			b.transition(CircuitOpen)
+			return
+		}
+		b.probeSuccess++
+		if b.probeSuccess >= b.cfg.HalfOpenRequests {
+			b.transition(CircuitClosed)
+		}
+
+	case CircuitClosed:
+		now := b.now()
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+
+		b.requests++
+		if failed {
+			b.failures++
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+
+		if (b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures) ||
+			(b.cfg.FailureRate > 0 && b.requests >= b.cfg.MinRequests &&
+				float64(b.failures)/float64(b.requests) >= b.cfg.FailureRate) {
+			b.transition(CircuitOpen)
+		}
+	}
+}
+
+// checkOpenTimeout is a helper method which moves an open breaker to half-open once the open timeout has passed.
+// It must be called with the lock held.
+func (b *circuitBreaker) checkOpenTimeout() {
+	if b.state == CircuitOpen && !b.now().Before(b.openedAt.Add(b.cfg.OpenTimeout)) {
+		b.transition(CircuitHalfOpen)
+	}
+}
+
+// transition is a helper method which changes the breaker's state and resets its counters.
+// It must be called with the lock held.
+func (b *circuitBreaker) transition(state CircuitState) {
+
+	b.state = state
+	b.generation++
+	b.consecutive, b.requests, b.failures = 0, 0, 0
+	b.probes, b.probeSuccess = 0, 0
+	b.windowStart = b.now()
+
+	if state == CircuitOpen {
+		b.openedAt = b.now()
+	}
+}
+
+// isDownstreamFailure is a helper function which reports whether a request attempt failed because of the downstream
+// service: an error sending it, other than an *ErrorHttp from middleware or a cancelled request, or a 5xx other than 500.
+// A plain 500 is deliberately not a failure: it is a service's generic response to an unexpected error handling
+// that particular request, eg, a payload it did not validate, while the service itself is up.  502, 503, and 504
+// are what a service which is down, overloaded, or behind a failing proxy returns.  Counting 500s would let one
+// bad request trip the breaker for every call, and the retry logic does not retry them for the same reason.
+func isDownstreamFailure(response *http.Response, err error) bool {
+
+	if err != nil {
+		var e *ErrorHttp
+		return !errors.As(err, &e) && !errors.Is(err, context.Canceled)
+	}
+
+	return response.StatusCode > 500 && response.StatusCode <= 599
+}
+
+// attemptResultOf is a helper function which returns the outcome of a request attempt for the circuit breaker.
+// A cancelled attempt, or one failed by middleware before it was sent, is released rather than recorded:
+// recording it as a success would let a cancelled half-open probe close the breaker unanswered.
+func attemptResultOf(response *http.Response, err error) attemptResult {
+
+	var e *ErrorHttp
+	switch {
+	case err != nil && (errors.As(err, &e) || errors.Is(err, context.Canceled)):
+		return attemptReleased
+	case isDownstreamFailure(response, err):
+		return attemptFailed
+	default:
+		return attemptSucceeded
+	}
+}
+
+// withCircuitBreaker is a middleware which fails request attempts fast with a 503 while the breaker is open,
+// and records the outcome of the attempts it allows.
+func withCircuitBreaker(b *circuitBreaker, service string, logger *slog.Logger) S2sMiddleware {
+	return func(next S2sHandler) S2sHandler {
+		return func(req *http.Request) (*http.Response, error) {
+
+			done, ok := b.allow()
+			if !ok {
+				logger.Warn("circuit breaker open, failing fast")
+				return nil, &ErrorHttp{
+					StatusCode: http.StatusServiceUnavailable,
+					Message:    fmt.Sprintf("%s service unavailable: circuit breaker open", service),
+					Reason:     ReasonCircuitOpen,
+				}
+			}
+
+			before := b.currentState()
+			response, err := next(req)
+			done(attemptResultOf(response, err))
+
+			if after := b.currentState(); after != before {
+				logger.Warn("circuit breaker state changed",
+					slog.String("circuit.from", before.String()),
+					slog.String("circuit.to", after.String()),
+				)
+			}
+
+			return response, err
+		}
+	}
+}
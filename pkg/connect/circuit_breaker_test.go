@@ -0,0 +1,281 @@
+package connect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+
+	type step struct {
+		advance   time.Duration // before the step
+		result    attemptResult
+		wantAllow bool
+		wantState CircuitState // after the step
+	}
+
+	tests := []struct {
+		name  string
+		cfg   CircuitBreakerConfiguration
+		steps []step
+	}{
+		{
+			name: "consecutive_failures_trip",
+			cfg:  CircuitBreakerConfiguration{ConsecutiveFailures: 2},
+			steps: []step{
+				{result: attemptFailed, wantAllow: true, wantState: CircuitClosed},
+				{result: attemptFailed, wantAllow: true, wantState: CircuitOpen},
+				{wantAllow: false, wantState: CircuitOpen},
+			},
+		},
+		{
+			name: "success_resets_consecutive_failures",
+			cfg:  CircuitBreakerConfiguration{ConsecutiveFailures: 2},
+			steps: []step{
+				{result: attemptFailed, wantAllow: true, wantState: CircuitClosed},
+				{result: attemptSucceeded, wantAllow: true, wantState: CircuitClosed},
+				{result: attemptFailed, wantAllow: true, wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "failure_rate_trips_after_min_requests",
+			cfg:  CircuitBreakerConfiguration{FailureRate: 0.5, MinRequests: 4},
+			steps: []step{
+				{result: attemptFailed, wantAllow: true, wantState: CircuitClosed},
+				{result: attemptSucceeded, wantAllow: true, wantState: CircuitClosed},
+				{result: attemptFailed, wantAllow: true, wantState: CircuitClosed},
+				{result: attemptSucceeded, wantAllow: true, wantState: CircuitOpen},
+			},
+		},
+		{
+			name: "failure_rate_window_resets",
+			cfg:  CircuitBreakerConfiguration{FailureRate: 0.5, MinRequests: 2, Window: time.Minute},
+			steps: []step{
+				{result: attemptFailed, wantAllow: true, wantState: CircuitClosed},
+				{advance: time.Minute, result: attemptSucceeded, wantAllow: true, wantState: CircuitClosed},
+				{result: attemptSucceeded, wantAllow: true, wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "half_open_probe_success_closes",
+			cfg:  CircuitBreakerConfiguration{ConsecutiveFailures: 1, OpenTimeout: 10 * time.Second},
+			steps: []step{
+				{result: attemptFailed, wantAllow: true, wantState: CircuitOpen},
+				{advance: 9 * time.Second, wantAllow: false, wantState: CircuitOpen},
+				{advance: time.Second, result: attemptSucceeded, wantAllow: true, wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "half_open_probe_failure_reopens",
+			cfg:  CircuitBreakerConfiguration{ConsecutiveFailures: 1, OpenTimeout: 10 * time.Second},
+			steps: []step{
+				{result: attemptFailed, wantAllow: true, wantState: CircuitOpen},
+				{advance: 10 * time.Second, result: attemptFailed, wantAllow: true, wantState: CircuitOpen},
+				{advance: 9 * time.Second, wantAllow: false, wantState: CircuitOpen},
+			},
+		},
+		{
+			name: "half_open_requires_all_probes",
+			cfg:  CircuitBreakerConfiguration{ConsecutiveFailures: 1, OpenTimeout: time.Second, HalfOpenRequests: 2},
+			steps: []step{
+				{result: attemptFailed, wantAllow: true, wantState: CircuitOpen},
+				{advance: time.Second, result: attemptSucceeded, wantAllow: true, wantState: CircuitHalfOpen},
+				{result: attemptSucceeded, wantAllow: true, wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "released_attempt_not_counted",
+			cfg:  CircuitBreakerConfiguration{ConsecutiveFailures: 2},
+			steps: []step{
+				{result: attemptFailed, wantAllow: true, wantState: CircuitClosed},
+				{result: attemptReleased, wantAllow: true, wantState: CircuitClosed},
+				{result: attemptFailed, wantAllow: true, wantState: CircuitOpen},
+			},
+		},
+		{
+			name: "half_open_released_probe_frees_slot",
+			cfg:  CircuitBreakerConfiguration{ConsecutiveFailures: 1, OpenTimeout: time.Second},
+			steps: []step{
+				{result: attemptFailed, wantAllow: true, wantState: CircuitOpen},
+				{advance: time.Second, result: attemptReleased, wantAllow: true, wantState: CircuitHalfOpen},
+				{result: attemptSucceeded, wantAllow: true, wantState: CircuitClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+			b := newCircuitBreaker(tt.cfg)
+			b.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+
+				done, ok := b.allow()
+				if ok != s.wantAllow {
+					t.Fatalf("step %d: allow() = %v, want %v", i, ok, s.wantAllow)
+				}
+				if ok {
+					done(s.result)
+				}
+
+				if got := b.currentState(); got != s.wantState {
+					t.Fatalf("step %d: state = %s, want %s", i, got, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_HalfOpenLimitsProbes(t *testing.T) {
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(CircuitBreakerConfiguration{ConsecutiveFailures: 1, OpenTimeout: time.Second})
+	b.now = func() time.Time { return now }
+
+	done, _ := b.allow()
+	done(attemptFailed)
+	now = now.Add(time.Second)
+
+	probe, ok := b.allow()
+	if !ok {
+		t.Fatal("expected a half-open probe to be allowed")
+	}
+	if _, ok := b.allow(); ok {
+		t.Fatal("expected a second concurrent probe to be rejected")
+	}
+
+	// a result from before the breaker opened is ignored
+	stale := b.generation
+	b.record(stale-1, attemptFailed)
+	if b.currentState() != CircuitHalfOpen {
+		t.Fatalf("stale result changed state to %s", b.currentState())
+	}
+
+	probe(attemptSucceeded)
+	if b.currentState() != CircuitClosed {
+		t.Errorf("state = %s, want closed", b.currentState())
+	}
+}
+
+func TestS2sCaller_CircuitBreaker(t *testing.T) {
+
+	client := &mockTlsClient{responses: []func() (*http.Response, error){
+		respond(http.StatusServiceUnavailable, "application/json", `{"code":503,"message":"down"}`),
+	}}
+	caller := NewS2sCaller("https://gallery.test", "gallery", client,
+		RetryConfiguration{MaxRetries: 4, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		WithCircuitBreaker(CircuitBreakerConfiguration{ConsecutiveFailures: 3, OpenTimeout: time.Minute}),
+	)
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	caller.breaker.now = func() time.Time { return now }
+
+	if caller.CircuitState() != CircuitClosed {
+		t.Fatalf("initial state = %s, want closed", caller.CircuitState())
+	}
+
+	// the breaker trips mid retry loop: the remaining retries fail fast
+	_, err := GetServiceData[testResp](context.Background(), caller, "/albums", "s2s-token", "")
+	var e *ErrorHttp
+	if !errors.As(err, &e) || e.StatusCode != http.StatusServiceUnavailable || e.Reason != ReasonCircuitOpen {
+		t.Fatalf("expected circuit open error, got %v", err)
+	}
+	if client.calls.Load() != 3 {
+		t.Errorf("attempts: want 3, got %d", client.calls.Load())
+	}
+	if caller.CircuitState() != CircuitOpen {
+		t.Fatalf("state = %s, want open", caller.CircuitState())
+	}
+
+	// subsequent calls fail fast without sending a request
+	if _, err := GetServiceData[testResp](context.Background(), caller, "/albums", "s2s-token", ""); !errors.As(err, &e) || e.Reason != ReasonCircuitOpen {
+		t.Fatalf("expected circuit open error, got %v", err)
+	}
+	if client.calls.Load() != 3 {
+		t.Errorf("attempts while open: want 3, got %d", client.calls.Load())
+	}
+
+	// the downstream recovers: a probe after the open timeout closes the breaker
+	client.responses = []func() (*http.Response, error){respond(http.StatusOK, "application/json", `{"id":"1"}`)}
+	now = now.Add(time.Minute)
+	if caller.CircuitState() != CircuitHalfOpen {
+		t.Fatalf("state = %s, want half-open", caller.CircuitState())
+	}
+	if _, err := GetServiceData[testResp](context.Background(), caller, "/albums", "s2s-token", ""); err != nil {
+		t.Fatalf("probe call error: %v", err)
+	}
+	if caller.CircuitState() != CircuitClosed {
+		t.Errorf("state = %s, want closed", caller.CircuitState())
+	}
+}
+
+func TestAttemptResultOf(t *testing.T) {
+
+	status := func(code int) *http.Response { return &http.Response{StatusCode: code} }
+
+	tests := []struct {
+		name     string
+		response *http.Response
+		err      error
+		want     attemptResult
+	}{
+		{name: "ok", response: status(http.StatusOK), want: attemptSucceeded},
+		{name: "client_error", response: status(http.StatusNotFound), want: attemptSucceeded},
+		{name: "internal_server_error_not_counted", response: status(http.StatusInternalServerError), want: attemptSucceeded},
+		{name: "bad_gateway", response: status(http.StatusBadGateway), want: attemptFailed},
+		{name: "unavailable", response: status(http.StatusServiceUnavailable), want: attemptFailed},
+		{name: "timeout", err: timeoutErr{}, want: attemptFailed},
+		{name: "cancelled", err: fmt.Errorf("Get \"https://gallery.test\": %w", context.Canceled), want: attemptReleased},
+		{name: "middleware_error", err: &ErrorHttp{StatusCode: http.StatusServiceUnavailable}, want: attemptReleased},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attemptResultOf(tt.response, tt.err); got != tt.want {
+				t.Errorf("attemptResultOf() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestS2sCaller_CircuitBreakerCancelledProbe(t *testing.T) {
+
+	client := &mockTlsClient{responses: []func() (*http.Response, error){
+		respond(http.StatusServiceUnavailable, "application/json", `{"code":503,"message":"down"}`),
+	}}
+	caller := NewS2sCaller("https://gallery.test", "gallery", client, RetryConfiguration{},
+		WithCircuitBreaker(CircuitBreakerConfiguration{ConsecutiveFailures: 1, OpenTimeout: time.Minute}),
+	)
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	caller.breaker.now = func() time.Time { return now }
+
+	GetServiceData[testResp](context.Background(), caller, "/albums", "s2s-token", "")
+	if caller.CircuitState() != CircuitOpen {
+		t.Fatalf("state = %s, want open", caller.CircuitState())
+	}
+
+	// the probe's caller gives up before the downstream answers
+	now = now.Add(time.Minute)
+	client.responses = []func() (*http.Response, error){fail(context.Canceled)}
+	GetServiceData[testResp](context.Background(), caller, "/albums", "s2s-token", "")
+
+	if caller.CircuitState() != CircuitHalfOpen {
+		t.Fatalf("state after cancelled probe = %s, want half-open", caller.CircuitState())
+	}
+
+	// the slot is free for the next probe
+	client.responses = []func() (*http.Response, error){respond(http.StatusOK, "application/json", `{"id":"1"}`)}
+	if _, err := GetServiceData[testResp](context.Background(), caller, "/albums", "s2s-token", ""); err != nil {
+		t.Fatalf("probe call error: %v", err)
+	}
+	if caller.CircuitState() != CircuitClosed {
+		t.Errorf("state = %s, want closed", caller.CircuitState())
+	}
+}
@@ -0,0 +1,150 @@
+package connect
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// EndpointResolver is an interface for discovering the endpoints of a downstream service for client-side
+// load balancing, see WithLoadBalancer.
+type EndpointResolver interface {
+
+	// Resolve returns the base urls, eg, https://10.0.0.7:8443 or https://10.0.0.7:8443/api, of the service's endpoints.
+	// A base url's path is prefixed to request paths; base urls with a query or fragment are ignored.
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// NewStaticResolver creates a new EndpointResolver which returns a fixed list of base urls.
+func NewStaticResolver(urls ...string) EndpointResolver {
+	return &staticResolver{
+		urls: urls,
+	}
+}
+
+var _ EndpointResolver = (*staticResolver)(nil)
+
+// staticResolver is the concrete implementation of the EndpointResolver interface for a fixed list of endpoints.
+type staticResolver struct {
+	urls []string
+}
+
+// Resolve implements the EndpointResolver interface.
+func (r *staticResolver) Resolve(ctx context.Context) ([]string, error) {
+
+	if len(r.urls) == 0 {
+		return nil, fmt.Errorf("no static endpoints configured")
+	}
+
+	return r.urls, nil
+}
+
+// dnsLookup is the subset of *net.Resolver used by the dns resolvers, so lookups can be mocked in tests.
+type dnsLookup interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// NewSrvResolver creates a new EndpointResolver which looks up the endpoints in the DNS SRV records
+// _service._proto.name, eg, _https._tcp.gallery.svc.cluster.local.  Only the records with the
+// lowest priority are used.
+func NewSrvResolver(scheme, service, proto, name string) EndpointResolver {
+	return &srvResolver{
+		scheme:  scheme,
+		service: service,
+		proto:   proto,
+		name:    name,
+		lookup:  net.DefaultResolver,
+	}
+}
+
+var _ EndpointResolver = (*srvResolver)(nil)
+
+// srvResolver is the concrete implementation of the EndpointResolver interface for DNS SRV records.
+type srvResolver struct {
+	scheme  string
+	service string
+	proto   string
+	name    string
+	lookup  dnsLookup
+}
+
+// Resolve implements the EndpointResolver interface.
+func (r *srvResolver) Resolve(ctx context.Context) ([]string, error) {
+
+	_, records, err := r.lookup.LookupSRV(ctx, r.service, r.proto, r.name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up srv records for %s: %v", r.name, err)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no srv records found for %s", r.name)
+	}
+
+	// records are sorted by priority
+	urls := make([]string, 0, len(records))
+	for _, srv := range records {
+		if srv.Priority != records[0].Priority {
+			break
+		}
+
+		host := strings.TrimSuffix(srv.Target, ".")
+		urls = append(urls, buildBaseUrl(r.scheme, host, int(srv.Port)))
+	}
+
+	return urls, nil
+}
+
+// NewDnsResolver creates a new EndpointResolver which looks up the endpoints in the host's DNS A and AAAA records.
+// Note: requests are sent to the ip addresses, so the service's certificates must include them as ip SANs.
+func NewDnsResolver(scheme, host string, port int) EndpointResolver {
+	return &dnsResolver{
+		scheme: scheme,
+		host:   host,
+		port:   port,
+		lookup: net.DefaultResolver,
+	}
+}
+
+var _ EndpointResolver = (*dnsResolver)(nil)
+
+// dnsResolver is the concrete implementation of the EndpointResolver interface for DNS A and AAAA records.
+type dnsResolver struct {
+	scheme string
+	host   string
+	port   int
+	lookup dnsLookup
+}
+
+// Resolve implements the EndpointResolver interface.
+func (r *dnsResolver) Resolve(ctx context.Context) ([]string, error) {
+
+	addrs, err := r.lookup.LookupHost(ctx, r.host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up addresses for %s: %v", r.host, err)
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", r.host)
+	}
+
+	urls := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		urls = append(urls, buildBaseUrl(r.scheme, addr, r.port))
+	}
+
+	return urls, nil
+}
+
+// buildBaseUrl is a helper function which builds a base url from the scheme, host, and port,
+// bracketing ipv6 addresses.
+func buildBaseUrl(scheme, host string, port int) string {
+	u := url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+	}
+	return u.String()
+}
@@ -0,0 +1,93 @@
+package connect
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+// mockDnsLookup returns the srv records or addresses, or error.
+type mockDnsLookup struct {
+	srv   []*net.SRV
+	addrs []string
+	err   error
+}
+
+func (m *mockDnsLookup) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return "", m.srv, m.err
+}
+
+func (m *mockDnsLookup) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return m.addrs, m.err
+}
+
+var _ dnsLookup = (*mockDnsLookup)(nil)
+
+func TestEndpointResolvers(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		resolver EndpointResolver
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "static",
+			resolver: NewStaticResolver("https://a:8443", "https://b:8443"),
+			want:     []string{"https://a:8443", "https://b:8443"},
+		},
+		{
+			name:     "static_empty",
+			resolver: NewStaticResolver(),
+			wantErr:  true,
+		},
+		{
+			name: "srv_lowest_priority",
+			resolver: &srvResolver{scheme: "https", lookup: &mockDnsLookup{srv: []*net.SRV{
+				{Target: "gallery-1.svc.", Port: 8443, Priority: 10},
+				{Target: "gallery-2.svc.", Port: 8443, Priority: 10},
+				{Target: "gallery-backup.svc.", Port: 9443, Priority: 20},
+			}}},
+			want: []string{"https://gallery-1.svc:8443", "https://gallery-2.svc:8443"},
+		},
+		{
+			name:     "srv_lookup_error",
+			resolver: &srvResolver{scheme: "https", name: "gallery.svc", lookup: &mockDnsLookup{err: errors.New("no such host")}},
+			wantErr:  true,
+		},
+		{
+			name:     "dns_ipv4_and_ipv6",
+			resolver: &dnsResolver{scheme: "https", port: 8443, lookup: &mockDnsLookup{addrs: []string{"10.0.0.1", "fd00::1"}}},
+			want:     []string{"https://10.0.0.1:8443", "https://[fd00::1]:8443"},
+		},
+		{
+			name:     "dns_no_addresses",
+			resolver: &dnsResolver{scheme: "https", host: "gallery.svc", port: 8443, lookup: &mockDnsLookup{}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.resolver.Resolve(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("endpoint %d: want %s, got %s", i, tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
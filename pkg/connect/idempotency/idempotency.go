@@ -0,0 +1,311 @@
+// Package idempotency provides http middleware which replays the stored response of a retried write,
+// identified by its Idempotency-Key header, so retries of POST and PATCH s2s calls cannot repeat the write.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tdeslauriers/carapace/internal/util"
+	"github.com/tdeslauriers/carapace/pkg/connect"
+)
+
+const (
+	defaultTtl         = 24 * time.Hour
+	defaultMaxBodySize = 1 << 20 // 1 MiB
+
+	maxKeyLength = 255
+)
+
+// Idempotency is an interface for http middleware which handles requests carrying an Idempotency-Key header:
+// the first request with a key is handled and its response stored, duplicates are sent the stored response.
+type Idempotency interface {
+
+	// Handle wraps the handler so POST and PATCH requests with an idempotency key are only handled once.
+	// A duplicate is answered with the stored response, including its headers less hop-by-hop headers,
+	// and the Idempotent-Replayed header,
+	// a 409 while the first request is in progress, or a 422 if the key was used for a different request.
+	// A 5xx response is not stored, so the caller's retry is handled again.
+	// Keys are scoped to the calling service if the s2s token was verified by the connect.Authorizer first.
+	Handle(next http.Handler) http.Handler
+}
+
+// IdempotencyOption is a functional option for configuring the Idempotency middleware.
+type IdempotencyOption func(*idempotency)
+
+// WithTtl sets how long a key's response is stored, 24 hours by default.
+func WithTtl(ttl time.Duration) IdempotencyOption {
+	return func(i *idempotency) { i.ttl = ttl }
+}
+
+// WithMaxBodySize sets the largest request body which is fingerprinted, 1 MiB by default.
+// Larger requests with an idempotency key are rejected with a 413.
+func WithMaxBodySize(size int64) IdempotencyOption {
+	return func(i *idempotency) { i.maxBodySize = size }
+}
+
+// NewIdempotency creates a new Idempotency interface with an underlying implementation.
+func NewIdempotency(s Store, opts ...IdempotencyOption) Idempotency {
+
+	i := &idempotency{
+		store:       s,
+		ttl:         defaultTtl,
+		maxBodySize: defaultMaxBodySize,
+		now:         time.Now,
+
+		logger: slog.Default().
+			With(slog.String(util.FrameworkKey, util.FrameworkCarapace)).
+			With(slog.String(util.PackageKey, util.PackageConnect)).
+			With(slog.String(util.ComponentKey, util.ComponentIdempotency)),
+	}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
+}
+
+var _ Idempotency = (*idempotency)(nil)
+
+// idempotency is the concrete implementation of the Idempotency interface.
+type idempotency struct {
+	store       Store
+	ttl         time.Duration
+	maxBodySize int64
+	now         func() time.Time
+
+	logger *slog.Logger
+}
+
+// Handle implements the Idempotency interface.
+func (i *idempotency) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		key := r.Header.Get(connect.IdempotencyKeyHeader)
+		if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxKeyLength {
+			e := connect.ErrorHttp{
+				StatusCode: http.StatusBadRequest,
+				Message:    fmt.Sprintf("%s header must be at most %d characters", connect.IdempotencyKeyHeader, maxKeyLength),
+			}
+			e.SendJsonErr(w)
+			return
+		}
+
+		// read the body to fingerprint it, then restore it for the handler
+		body, err := io.ReadAll(io.LimitReader(r.Body, i.maxBodySize+1))
+		r.Body.Close()
+		if err != nil {
+			e := connect.ErrorHttp{
+				StatusCode: http.StatusBadRequest,
+				Message:    "failed to read request body",
+			}
+			e.SendJsonErr(w)
+			return
+		}
+
+		if int64(len(body)) > i.maxBodySize {
+			e := connect.ErrorHttp{
+				StatusCode: http.StatusRequestEntityTooLarge,
+				Message:    "request body too large",
+			}
+			e.SendJsonErr(w)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		scoped := scopeKey(r, key)
+		fingerprint := hash(r.Method, r.URL.Path, string(body))
+		log := i.logger.With(slog.String("method", r.Method), slog.String("path", r.URL.Path))
+
+		record, reserved, err := i.store.Reserve(scoped, fingerprint, i.now().Add(i.ttl))
+		if err != nil {
+			log.Error("failed to reserve idempotency key", slog.String("err", err.Error()))
+			e := connect.ErrorHttp{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "internal server error",
+			}
+			e.SendJsonErr(w)
+			return
+		}
+
+		if !reserved {
+			i.replay(w, record, fingerprint, log)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w}
+		completed := false
+
+		// a panicking handler must not leave the key reserved until it expires
+		defer func() {
+			if !completed {
+				if err := i.store.Release(scoped); err != nil {
+					log.Error("failed to release idempotency key", slog.String("err", err.Error()))
+				}
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		// 5xx responses are not stored, a retry may succeed
+		if status >= http.StatusInternalServerError {
+			return
+		}
+
+		if err := i.store.Complete(Record{
+			Key:         scoped,
+			Fingerprint: fingerprint,
+			StatusCode:  status,
+			Header:      storedHeader(rec.sent()),
+			Body:        rec.body.Bytes(),
+		}); err != nil {
+			log.Error("failed to store idempotent response", slog.String("err", err.Error()))
+			return
+		}
+		completed = true
+	})
+}
+
+// replay is a helper method which answers a duplicate request from the record of the first.
+func (i *idempotency) replay(w http.ResponseWriter, record Record, fingerprint string, log *slog.Logger) {
+
+	if record.Fingerprint != fingerprint {
+		log.Warn("idempotency key reused for a different request")
+		e := connect.ErrorHttp{
+			StatusCode: http.StatusUnprocessableEntity,
+			Message:    fmt.Sprintf("%s was used for a different request", connect.IdempotencyKeyHeader),
+		}
+		e.SendJsonErr(w)
+		return
+	}
+
+	if record.InProgress() {
+		e := connect.ErrorHttp{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("a request with this %s is in progress", connect.IdempotencyKeyHeader),
+		}
+		e.SendJsonErr(w)
+		return
+	}
+
+	log.Info("replaying idempotent response", slog.Int("status_code", record.StatusCode))
+
+	for name, values := range record.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(connect.IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// hopByHopHeaders are the headers of a single connection, rfc 9110 section 7.6.1, which are not stored:
+// the Date of the first response is not stored either, the server sets a current one.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Date",
+}
+
+// storedHeader is a helper function which returns a copy of the response headers without hop-by-hop headers,
+// including those named by the Connection header, so they can be stored and replayed.
+func storedHeader(h http.Header) ResponseHeader {
+
+	stored := h.Clone()
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			stored.Del(strings.TrimSpace(name))
+		}
+	}
+
+	for _, name := range hopByHopHeaders {
+		stored.Del(name)
+	}
+	stored.Del(connect.IdempotentReplayedHeader)
+
+	return ResponseHeader(stored)
+}
+
+// scopeKey is a helper function which scopes an idempotency key to the calling service, if its s2s token
+// was verified, so services cannot replay each other's responses.
+func scopeKey(r *http.Request, key string) string {
+
+	caller := ""
+	if tkn, ok := connect.S2sTokenFromContext(r.Context()); ok {
+		caller = tkn.Claims.Subject
+	}
+
+	return hash(caller, key)
+}
+
+// hash is a helper function which returns the hex sha256 of the null separated parts.
+func hash(parts ...string) string {
+
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder is a http.ResponseWriter which captures the status, headers, and body written through it.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header // as sent with the status, changes made after it are not sent
+	body   bytes.Buffer
+}
+
+// WriteHeader captures the status code and headers.
+func (r *recorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write captures the body.
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// sent returns the headers sent with the status, or the current headers if nothing was written.
+func (r *recorder) sent() http.Header {
+	if r.header == nil {
+		return r.ResponseWriter.Header()
+	}
+	return r.header
+}
@@ -0,0 +1,308 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/connect"
+)
+
+func TestIdempotency_Handle(t *testing.T) {
+
+	type call struct {
+		method       string
+		key          string
+		body         string
+		wantStatus   int
+		wantBody     string // substring
+		wantReplayed bool
+	}
+
+	tests := []struct {
+		name        string
+		handler     func(w http.ResponseWriter, r *http.Request)
+		calls       []call
+		wantHandled int
+	}{
+		{
+			name: "duplicate_replayed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"id":"1"}`))
+			},
+			calls: []call{
+				{method: http.MethodPost, key: "key-1", body: `{"name":"summer"}`, wantStatus: http.StatusCreated, wantBody: `{"id":"1"}`},
+				{method: http.MethodPost, key: "key-1", body: `{"name":"summer"}`, wantStatus: http.StatusCreated, wantBody: `{"id":"1"}`, wantReplayed: true},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "different_keys_handled",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			},
+			calls: []call{
+				{method: http.MethodPatch, key: "key-1", body: `{}`, wantStatus: http.StatusCreated},
+				{method: http.MethodPatch, key: "key-2", body: `{}`, wantStatus: http.StatusCreated},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "key_reused_for_different_body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			},
+			calls: []call{
+				{method: http.MethodPost, key: "key-1", body: `{"name":"summer"}`, wantStatus: http.StatusCreated},
+				{method: http.MethodPost, key: "key-1", body: `{"name":"winter"}`, wantStatus: http.StatusUnprocessableEntity, wantBody: "different request"},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "server_error_not_stored",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			calls: []call{
+				{method: http.MethodPost, key: "key-1", body: `{}`, wantStatus: http.StatusServiceUnavailable},
+				{method: http.MethodPost, key: "key-1", body: `{}`, wantStatus: http.StatusServiceUnavailable},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "client_error_stored",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			},
+			calls: []call{
+				{method: http.MethodPost, key: "key-1", body: `{}`, wantStatus: http.StatusBadRequest},
+				{method: http.MethodPost, key: "key-1", body: `{}`, wantStatus: http.StatusBadRequest, wantReplayed: true},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "no_key_passed_through",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			},
+			calls: []call{
+				{method: http.MethodPost, body: `{}`, wantStatus: http.StatusCreated},
+				{method: http.MethodPost, body: `{}`, wantStatus: http.StatusCreated},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "put_passed_through",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			},
+			calls: []call{
+				{method: http.MethodPut, key: "key-1", body: `{}`, wantStatus: http.StatusOK},
+				{method: http.MethodPut, key: "key-1", body: `{}`, wantStatus: http.StatusOK},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "key_too_long",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			},
+			calls: []call{
+				{method: http.MethodPost, key: strings.Repeat("k", maxKeyLength+1), body: `{}`, wantStatus: http.StatusBadRequest},
+			},
+			wantHandled: 0,
+		},
+		{
+			name: "body_too_large",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			},
+			calls: []call{
+				{method: http.MethodPost, key: "key-1", body: strings.Repeat("a", 65), wantStatus: http.StatusRequestEntityTooLarge},
+			},
+			wantHandled: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := 0
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled++
+				tt.handler(w, r)
+			})
+			h := NewIdempotency(NewMemoryStore(), WithMaxBodySize(64)).Handle(next)
+
+			for i, c := range tt.calls {
+				req := httptest.NewRequest(c.method, "/albums", strings.NewReader(c.body))
+				if c.key != "" {
+					req.Header.Set(connect.IdempotencyKeyHeader, c.key)
+				}
+				rec := httptest.NewRecorder()
+
+				h.ServeHTTP(rec, req)
+
+				if rec.Code != c.wantStatus {
+					t.Errorf("call %d: status = %d, want %d", i, rec.Code, c.wantStatus)
+				}
+				if !strings.Contains(rec.Body.String(), c.wantBody) {
+					t.Errorf("call %d: body %q does not contain %q", i, rec.Body.String(), c.wantBody)
+				}
+				if replayed := rec.Header().Get(connect.IdempotentReplayedHeader) == "true"; replayed != c.wantReplayed {
+					t.Errorf("call %d: replayed = %v, want %v", i, replayed, c.wantReplayed)
+				}
+			}
+
+			if handled != tt.wantHandled {
+				t.Errorf("handled: want %d, got %d", tt.wantHandled, handled)
+			}
+		})
+	}
+}
+
+func TestIdempotency_InProgress(t *testing.T) {
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+	h := NewIdempotency(NewMemoryStore()).Handle(next)
+
+	request := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/albums", strings.NewReader(`{}`))
+		req.Header.Set(connect.IdempotencyKeyHeader, "key-1")
+		return req
+	}
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(first, request())
+		close(done)
+	}()
+	<-started
+
+	dup := httptest.NewRecorder()
+	h.ServeHTTP(dup, request())
+	if dup.Code != http.StatusConflict {
+		t.Errorf("duplicate in progress: status = %d, want %d", dup.Code, http.StatusConflict)
+	}
+
+	close(release)
+	<-done
+	if first.Code != http.StatusCreated {
+		t.Errorf("first: status = %d, want %d", first.Code, http.StatusCreated)
+	}
+}
+
+func TestIdempotency_PanicReleasesKey(t *testing.T) {
+
+	store := NewMemoryStore()
+	h := NewIdempotency(store).Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/albums", strings.NewReader(`{}`))
+	req.Header.Set(connect.IdempotencyKeyHeader, "key-1")
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected the panic to propagate")
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	if _, reserved, _ := store.Reserve(hash("", "key-1"), "fingerprint", time.Now().Add(time.Hour)); !reserved {
+		t.Error("expected the key to be released after the panic")
+	}
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := &memoryStore{records: make(map[string]Record), now: func() time.Time { return now }}
+
+	if _, ok, _ := s.Reserve("key-1", "fp", now.Add(time.Hour)); !ok {
+		t.Fatal("expected first reserve to claim the key")
+	}
+	if err := s.Complete(Record{Key: "key-1", StatusCode: http.StatusCreated}); err != nil {
+		t.Fatalf("Complete() error: %v", err)
+	}
+
+	r, ok, _ := s.Reserve("key-1", "fp", now.Add(time.Hour))
+	if ok || r.StatusCode != http.StatusCreated {
+		t.Fatalf("expected the completed record, got claimed=%v status=%d", ok, r.StatusCode)
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok, _ := s.Reserve("key-1", "fp", now.Add(time.Hour)); !ok {
+		t.Error("expected an expired key to be claimed again")
+	}
+
+	now = now.Add(time.Hour)
+	if err := s.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired() error: %v", err)
+	}
+	if len(s.records) != 0 {
+		t.Errorf("expected expired keys to be purged, %d remain", len(s.records))
+	}
+}
+
+func TestIdempotency_ReplaysHeaders(t *testing.T) {
+
+	h := NewIdempotency(NewMemoryStore()).Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/albums/1")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.Header().Set("Connection", "X-Hop")
+		w.Header().Set("X-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.WriteHeader(http.StatusCreated)
+		w.Header().Set("X-Late", "not sent") // set after the status, not part of the response
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/albums", strings.NewReader(`{"name":"summer"}`))
+		req.Header.Set(connect.IdempotencyKeyHeader, "key-1")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	send()
+	replayed := send()
+
+	if replayed.Code != http.StatusCreated || replayed.Header().Get(connect.IdempotentReplayedHeader) != "true" {
+		t.Fatalf("expected a replayed 201, got %d %v", replayed.Code, replayed.Header())
+	}
+
+	want := map[string][]string{
+		"Content-Type": {"application/json"},
+		"Location":     {"/albums/1"},
+		"Etag":         {`"v1"`},
+		"Set-Cookie":   {"a=1", "b=2"},
+	}
+	for name, values := range want {
+		if got := replayed.Header().Values(name); strings.Join(got, ",") != strings.Join(values, ",") {
+			t.Errorf("header %s: want %v, got %v", name, values, got)
+		}
+	}
+
+	for _, name := range []string{"Connection", "X-Hop", "Keep-Alive", "X-Late"} {
+		if got := replayed.Header().Get(name); got != "" {
+			t.Errorf("header %s: expected not replayed, got %q", name, got)
+		}
+	}
+}
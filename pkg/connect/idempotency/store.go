@@ -0,0 +1,173 @@
+package idempotency
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/data"
+)
+
+// Record is the database model of a request's idempotency key and, once the request completes, its response.
+type Record struct {
+	Key         string          `db:"idempotency_key"` // scoped to the calling service, see Idempotency
+	Fingerprint string          `db:"fingerprint"`     // hash of the request's method, path, and body
+	StatusCode  int             `db:"status_code"`     // 0 while the request is in progress
+	Header      ResponseHeader  `db:"header"`          // the response's headers, eg, Content-Type, Location, ETag
+	Body        []byte          `db:"body"`
+	CreatedAt   data.CustomTime `db:"created_at"`
+	ExpiresAt   data.CustomTime `db:"expires_at"`
+}
+
+// ResponseHeader is the headers of a stored response, persisted as json.
+type ResponseHeader http.Header
+
+// Scan implements the sql.Scanner interface
+func (h *ResponseHeader) Scan(value interface{}) error {
+
+	var raw []byte
+	switch v := value.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	case nil:
+		*h = nil
+		return nil
+	default:
+		return errors.New("unsupported data type")
+	}
+
+	if len(raw) == 0 {
+		*h = nil
+		return nil
+	}
+
+	return json.Unmarshal(raw, h)
+}
+
+// Value implements the driver.Valuer interface
+func (h ResponseHeader) Value() (driver.Value, error) {
+
+	if len(h) == 0 {
+		return nil, nil // Use NULL for no headers
+	}
+
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// InProgress reports whether the record's request has not completed.
+func (r Record) InProgress() bool {
+	return r.StatusCode == 0
+}
+
+// Store is a repository of idempotency keys and their requests' responses.
+type Store interface {
+
+	// Reserve claims the key for a request with the fingerprint until it expires.  It returns true if the key
+	// was claimed, or false and the existing record if the key is already claimed or completed.
+	// Expired keys can be claimed again.
+	Reserve(key, fingerprint string, expires time.Time) (Record, bool, error)
+
+	// Complete stores the response of the request which claimed the record's key.
+	Complete(record Record) error
+
+	// Release removes a claimed key, eg, when its request failed in a way a retry may fix.
+	Release(key string) error
+
+	// PurgeExpired removes expired keys.
+	PurgeExpired() error
+}
+
+// NewMemoryStore creates a new in-memory Store.
+// Note: keys are not shared between instances and are lost on restart.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		records: make(map[string]Record),
+		now:     time.Now,
+	}
+}
+
+var _ Store = (*memoryStore)(nil)
+
+// memoryStore is the concrete in-memory implementation of the Store interface.
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+	now     func() time.Time
+}
+
+// Reserve implements the Store interface.
+func (s *memoryStore) Reserve(key, fingerprint string, expires time.Time) (Record, bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.records[key]; ok && s.now().Before(r.ExpiresAt.Time) {
+		return r, false, nil
+	}
+
+	s.records[key] = Record{
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   data.CustomTime{Time: s.now().UTC()},
+		ExpiresAt:   data.CustomTime{Time: expires.UTC()},
+	}
+
+	return Record{}, true, nil
+}
+
+// Complete implements the Store interface.
+func (s *memoryStore) Complete(record Record) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[record.Key]
+	if !ok {
+		return fmt.Errorf("idempotency key not reserved")
+	}
+
+	r.StatusCode = record.StatusCode
+	r.Header = record.Header
+	r.Body = record.Body
+	s.records[record.Key] = r
+
+	return nil
+}
+
+// Release implements the Store interface.
+func (s *memoryStore) Release(key string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
+
+// PurgeExpired implements the Store interface.
+func (s *memoryStore) PurgeExpired() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, r := range s.records {
+		if !now.Before(r.ExpiresAt.Time) {
+			delete(s.records, key)
+		}
+	}
+
+	return nil
+}
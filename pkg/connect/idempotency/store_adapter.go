@@ -0,0 +1,135 @@
+package idempotency
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/data"
+)
+
+// NewSqlStore creates a new Store backed by the idempotency_key table,
+// so duplicate requests are detected across service instances.
+func NewSqlStore(db *sql.DB) Store {
+	return &sqlStore{
+		sql: db,
+	}
+}
+
+var _ Store = (*sqlStore)(nil)
+
+// sqlDB combines Selector and Execer so the store field can be satisfied by
+// *sql.DB in production and by a mock in tests.
+type sqlDB interface {
+	data.Selector
+	data.Execer
+}
+
+// sqlStore is the concrete sql implementation of the Store interface.
+type sqlStore struct {
+	sql sqlDB
+}
+
+// Reserve implements the Store interface.  The key is claimed by an insert which is ignored if the key exists,
+// so concurrent requests with the same key cannot both claim it.
+func (s *sqlStore) Reserve(key, fingerprint string, expires time.Time) (Record, bool, error) {
+
+	if key == "" {
+		return Record{}, false, fmt.Errorf("idempotency key is required")
+	}
+
+	now := time.Now().UTC()
+
+	// expired keys can be claimed again
+	qry := `DELETE FROM idempotency_key WHERE idempotency_key = ? AND expires_at <= ?`
+	if err := data.DeleteRecord(s.sql, qry, key, now); err != nil {
+		return Record{}, false, fmt.Errorf("failed to remove expired idempotency key: %v", err)
+	}
+
+	qry = `
+		INSERT IGNORE INTO idempotency_key (
+			idempotency_key,
+			fingerprint,
+			status_code,
+			header,
+			body,
+			created_at,
+			expires_at
+		) VALUES (?, ?, 0, NULL, NULL, ?, ?)`
+
+	result, err := s.sql.Exec(qry, key, fingerprint, now, expires.UTC())
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to reserve idempotency key: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to get rows affected reserving idempotency key: %v", err)
+	}
+
+	if rows == 1 {
+		return Record{}, true, nil
+	}
+
+	qry = `
+		SELECT
+			idempotency_key,
+			fingerprint,
+			status_code,
+			header,
+			body,
+			created_at,
+			expires_at
+		FROM idempotency_key
+		WHERE idempotency_key = ?`
+
+	record, err := data.SelectOneRecord[Record](s.sql, qry, key)
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to look up idempotency key: %v", err)
+	}
+
+	return record, false, nil
+}
+
+// Complete implements the Store interface.
+func (s *sqlStore) Complete(record Record) error {
+
+	if record.Key == "" {
+		return fmt.Errorf("idempotency key is required")
+	}
+
+	qry := `
+		UPDATE idempotency_key
+		SET status_code = ?,
+			header = ?,
+			body = ?
+		WHERE idempotency_key = ?`
+
+	if err := data.UpdateRecord(s.sql, qry, record.StatusCode, record.Header, record.Body, record.Key); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %v", err)
+	}
+
+	return nil
+}
+
+// Release implements the Store interface.
+func (s *sqlStore) Release(key string) error {
+
+	qry := `DELETE FROM idempotency_key WHERE idempotency_key = ?`
+	if err := data.DeleteRecord(s.sql, qry, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %v", err)
+	}
+
+	return nil
+}
+
+// PurgeExpired implements the Store interface.
+func (s *sqlStore) PurgeExpired() error {
+
+	qry := `DELETE FROM idempotency_key WHERE expires_at <= ?`
+	if err := data.DeleteRecord(s.sql, qry, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to purge expired idempotency keys: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package idempotency
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Adapter tests verify SQL query structure and error propagation at the DB boundary.
+//
+// Success paths which read a record require constructing a real *sql.Row,
+// which is not possible without a registered driver.
+
+// mockSqlDB implements the sqlDB interface for testing.
+type mockSqlDB struct {
+	prepareFunc func(string) (*sql.Stmt, error)
+}
+
+func (m *mockSqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) { return nil, nil }
+func (m *mockSqlDB) QueryRow(query string, args ...interface{}) *sql.Row        { return nil }
+func (m *mockSqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *mockSqlDB) Prepare(query string) (*sql.Stmt, error) {
+	if m.prepareFunc != nil {
+		return m.prepareFunc(query)
+	}
+	return nil, nil
+}
+
+var _ sqlDB = (*mockSqlDB)(nil)
+
+func TestSqlStore(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		call       func(Store) error
+		prepareErr error
+		errSubstr  string
+		wantQuery  []string
+	}{
+		{
+			name:      "reserve_missing_key",
+			call:      func(s Store) error { _, _, err := s.Reserve("", "fp", time.Now()); return err },
+			errSubstr: "idempotency key is required",
+		},
+		{
+			name:       "reserve_prepare_error_propagated",
+			call:       func(s Store) error { _, _, err := s.Reserve("key-1", "fp", time.Now()); return err },
+			prepareErr: errors.New("too many connections"),
+			errSubstr:  "too many connections",
+			wantQuery:  []string{"DELETE FROM idempotency_key", "expires_at <= ?"},
+		},
+		{
+			name:      "complete_missing_key",
+			call:      func(s Store) error { return s.Complete(Record{StatusCode: 201}) },
+			errSubstr: "idempotency key is required",
+		},
+		{
+			name:       "complete_prepare_error_propagated",
+			call:       func(s Store) error { return s.Complete(Record{Key: "key-1", StatusCode: 201}) },
+			prepareErr: errors.New("too many connections"),
+			errSubstr:  "too many connections",
+			wantQuery:  []string{"UPDATE idempotency_key", "status_code = ?", "body = ?", "WHERE idempotency_key = ?"},
+		},
+		{
+			name:       "release_prepare_error_propagated",
+			call:       func(s Store) error { return s.Release("key-1") },
+			prepareErr: errors.New("too many connections"),
+			errSubstr:  "too many connections",
+			wantQuery:  []string{"DELETE FROM idempotency_key", "WHERE idempotency_key = ?"},
+		},
+		{
+			name:       "purge_prepare_error_propagated",
+			call:       func(s Store) error { return s.PurgeExpired() },
+			prepareErr: errors.New("too many connections"),
+			errSubstr:  "too many connections",
+			wantQuery:  []string{"DELETE FROM idempotency_key", "WHERE expires_at <= ?"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capturedQuery string
+			db := &mockSqlDB{
+				prepareFunc: func(query string) (*sql.Stmt, error) {
+					capturedQuery = query
+					return nil, tt.prepareErr
+				},
+			}
+			store := &sqlStore{sql: db}
+
+			err := tt.call(store)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.errSubstr) {
+				t.Fatalf("error %q does not contain %q", err.Error(), tt.errSubstr)
+			}
+			for _, expected := range tt.wantQuery {
+				if !strings.Contains(capturedQuery, expected) {
+					t.Errorf("query missing %q:\n%s", expected, capturedQuery)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseHeader_ScanValue(t *testing.T) {
+
+	h := ResponseHeader{"Location": {"/albums/1"}, "Set-Cookie": {"a=1", "b=2"}}
+
+	v, err := h.Value()
+	if err != nil {
+		t.Fatalf("Value() error: %v", err)
+	}
+
+	var scanned ResponseHeader
+	if err := scanned.Scan([]byte(v.(string))); err != nil {
+		t.Fatalf("Scan() error: %v", err)
+	}
+	if len(scanned) != 2 || scanned["Location"][0] != "/albums/1" || len(scanned["Set-Cookie"]) != 2 {
+		t.Errorf("round trip mismatch: got %v", scanned)
+	}
+
+	// no headers are stored as NULL
+	if v, err := (ResponseHeader{}).Value(); v != nil || err != nil {
+		t.Errorf("empty Value() = %v, %v, want nil, nil", v, err)
+	}
+	if err := scanned.Scan(nil); err != nil || scanned != nil {
+		t.Errorf("Scan(nil) = %v, %v, want nil header", scanned, err)
+	}
+}
@@ -0,0 +1,30 @@
+package connect
+
+import "context"
+
+const (
+	// IdempotencyKeyHeader is the request header carrying the key which identifies retries of the same write,
+	// so the downstream service can replay its first response rather than repeat the write.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader is set on a response replayed for a duplicate idempotency key.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// idempotencyCtxKey is the context key type used to store a caller provided idempotency key.
+type idempotencyCtxKey string
+
+const idempotencyKey idempotencyCtxKey = "idempotency_key"
+
+// WithIdempotencyKey returns a copy of the context carrying the idempotency key for PostToService and PatchToService
+// calls made with it, eg, to keep the key stable across the caller's own retries of an operation.
+// Without one, a key is generated per call and reused for that call's retries.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey, key)
+}
+
+// IdempotencyKeyFromContext returns the idempotency key added to the context by WithIdempotencyKey, if any.
+func IdempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKey).(string)
+	return key, ok && key != ""
+}
@@ -10,6 +10,7 @@ import (
 type ErrorHttp struct {
 	StatusCode int    `json:"code"`
 	Message    string `json:"message"`
+	Reason     string `json:"reason,omitempty"` // machine readable cause, eg, ReasonUserUnauthorized
 }
 
 func (e *ErrorHttp) Error() string {
@@ -1,9 +1,9 @@
 package connect
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/tdeslauriers/carapace/pkg/jwt"
 )
@@ -15,42 +15,53 @@ const (
 	User AuthProvider = "user"
 )
 
+// Auth failure reasons sent in the ErrorHttp reason field so calling services can tell
+// which token failed, and how, without matching on the error message.
+const (
+	ReasonS2sUnauthorized  string = "s2s_unauthorized"
+	ReasonS2sForbidden     string = "s2s_forbidden"
+	ReasonUserUnauthorized string = "user_unauthorized"
+	ReasonUserForbidden    string = "user_forbidden"
+)
+
+// RespondAuthFailure writes the standard unauthorized or forbidden json error for a failed token verification,
+// determined by the jwt.ErrUnauthorized and jwt.ErrForbidden errors wrapped by err.
+// Any other error is an internal server error.
 func RespondAuthFailure(auth AuthProvider, err error, w http.ResponseWriter) {
 
-	var unauthorized string
-	var forbidden string
+	var unauthorized, unauthorizedReason string
+	var forbidden, forbiddenReason string
 
 	if auth == S2s {
-		unauthorized = jwt.S2sUnauthorizedErrMsg
-		forbidden = jwt.S2sForbiddenErrMsg
+		unauthorized, unauthorizedReason = jwt.S2sUnauthorizedErrMsg, ReasonS2sUnauthorized
+		forbidden, forbiddenReason = jwt.S2sForbiddenErrMsg, ReasonS2sForbidden
 	} else {
-		unauthorized = jwt.UserUnauthorizedErrMsg
-		forbidden = jwt.UserForbdiddenErrMsg
+		unauthorized, unauthorizedReason = jwt.UserUnauthorizedErrMsg, ReasonUserUnauthorized
+		forbidden, forbiddenReason = jwt.UserForbdiddenErrMsg, ReasonUserForbidden
 	}
 
-	if strings.Contains(err.Error(), "unauthorized") {
-
+	switch {
+	case errors.Is(err, jwt.ErrUnauthorized):
 		e := ErrorHttp{
 			StatusCode: http.StatusUnauthorized,
 			Message:    unauthorized,
+			Reason:     unauthorizedReason,
 		}
 		e.SendJsonErr(w)
-		return
-	} else if strings.Contains(err.Error(), "forbidden") {
 
+	case errors.Is(err, jwt.ErrForbidden):
 		e := ErrorHttp{
 			StatusCode: http.StatusForbidden,
 			Message:    forbidden,
+			Reason:     forbiddenReason,
 		}
 		e.SendJsonErr(w)
-		return
-	} else {
 
+	default:
 		e := ErrorHttp{
 			StatusCode: http.StatusInternalServerError,
 			Message:    fmt.Sprintf("internal server error - failed to validate %s token:", auth),
 		}
 		e.SendJsonErr(w)
-		return
 	}
 }
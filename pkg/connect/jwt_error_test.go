@@ -0,0 +1,84 @@
+package connect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+)
+
+func TestRespondAuthFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		auth       AuthProvider
+		err        error
+		wantStatus int
+		wantMsg    string
+		wantReason string
+	}{
+		{
+			name:       "s2s_expired",
+			auth:       S2s,
+			err:        jwt.ErrTokenExpired,
+			wantStatus: http.StatusUnauthorized,
+			wantMsg:    jwt.S2sUnauthorizedErrMsg,
+			wantReason: ReasonS2sUnauthorized,
+		},
+		{
+			name:       "user_wrapped_invalid_signature",
+			auth:       User,
+			err:        fmt.Errorf("failed to build token: %w", jwt.ErrInvalidSignature),
+			wantStatus: http.StatusUnauthorized,
+			wantMsg:    jwt.UserUnauthorizedErrMsg,
+			wantReason: ReasonUserUnauthorized,
+		},
+		{
+			name:       "s2s_wrong_audience",
+			auth:       S2s,
+			err:        jwt.ErrInvalidAudience,
+			wantStatus: http.StatusForbidden,
+			wantMsg:    jwt.S2sForbiddenErrMsg,
+			wantReason: ReasonS2sForbidden,
+		},
+		{
+			name:       "user_missing_scope",
+			auth:       User,
+			err:        jwt.ErrMissingScope,
+			wantStatus: http.StatusForbidden,
+			wantMsg:    jwt.UserForbdiddenErrMsg,
+			wantReason: ReasonUserForbidden,
+		},
+		{
+			name:       "message_only_is_not_matched",
+			auth:       User,
+			err:        errors.New("unauthorized: token expired"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			RespondAuthFailure(tt.auth, tt.err, rec)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status: want %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			var e ErrorHttp
+			if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+				t.Fatalf("failed to decode error response: %v", err)
+			}
+			if tt.wantMsg != "" && e.Message != tt.wantMsg {
+				t.Errorf("message: want %q, got %q", tt.wantMsg, e.Message)
+			}
+			if e.Reason != tt.wantReason {
+				t.Errorf("reason: want %q, got %q", tt.wantReason, e.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package connect
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BalanceStrategy selects the endpoint each request attempt is sent to.
+type BalanceStrategy int
+
+const (
+	RoundRobin       BalanceStrategy = iota // endpoints take turns
+	LeastOutstanding                        // the endpoint with the fewest requests in flight, taking turns on ties
+)
+
+// LoadBalancerConfiguration is a struct that holds the configuration for client-side load balancing.
+// Zero values default to round robin, a 30 second refresh interval, and ejecting an endpoint for
+// 30 seconds after 3 consecutive failures.
+type LoadBalancerConfiguration struct {
+	Strategy        BalanceStrategy
+	RefreshInterval time.Duration // how often the endpoints are resolved again
+	EjectAfter      int           // consecutive failures, eg, timeouts or 503s, after which an endpoint is ejected
+	EjectDuration   time.Duration // how long an ejected endpoint is skipped
+}
+
+// WithLoadBalancer balances the S2sCaller's requests across the endpoints found by the resolver, rather than
+// sending them to the ServiceUrl's host: the ServiceUrl's scheme and host are replaced per attempt, and its path
+// is appended to the endpoint's base path, eg, https://10.0.0.7:8443/api and /albums become https://10.0.0.7:8443/api/albums.
+// Endpoints which keep failing are ejected for a while, and retries are sent to an endpoint not yet tried by the call.
+func WithLoadBalancer(r EndpointResolver, cfg LoadBalancerConfiguration) S2sCallerOption {
+	return func(c *S2sCaller) { c.balancer = newLoadBalancer(r, cfg) }
+}
+
+// endpoint is a downstream service endpoint and its health.
+type endpoint struct {
+	base         string // base url as resolved
+	scheme       string
+	host         string
+	path         string // base path without a trailing slash, prefixed to request paths
+	escapedPath  string
+	outstanding  int // requests in flight
+	consecutive  int // consecutive failures
+	ejectedUntil time.Time
+}
+
+// loadBalancer selects endpoints for request attempts and tracks their health.
+type loadBalancer struct {
+	resolver EndpointResolver
+	cfg      LoadBalancerConfiguration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	endpoints   []*endpoint
+	next        int // round robin position
+	refreshedAt time.Time
+	refreshing  bool
+}
+
+// newLoadBalancer creates a new load balancer, applying defaults to zero configuration values.
+func newLoadBalancer(r EndpointResolver, cfg LoadBalancerConfiguration) *loadBalancer {
+
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = 30 * time.Second
+	}
+
+	if cfg.EjectAfter <= 0 {
+		cfg.EjectAfter = 3
+	}
+
+	if cfg.EjectDuration <= 0 {
+		cfg.EjectDuration = 30 * time.Second
+	}
+
+	return &loadBalancer{
+		resolver: r,
+		cfg:      cfg,
+		now:      time.Now,
+	}
+}
+
+// refresh resolves the endpoints again if the refresh interval has passed.  While endpoints are known,
+// only one caller resolves at a time and the others keep using the known endpoints.
+// A failed resolution keeps the known endpoints until the next interval.
+func (b *loadBalancer) refresh(ctx context.Context, logger *slog.Logger) {
+
+	b.mu.Lock()
+	known := len(b.endpoints) > 0
+	if (known && b.refreshing) || (known && b.now().Sub(b.refreshedAt) < b.cfg.RefreshInterval) {
+		b.mu.Unlock()
+		return
+	}
+	b.refreshing = true
+	b.mu.Unlock()
+
+	urls, err := b.resolver.Resolve(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refreshing = false
+	if err != nil {
+		logger.Error("failed to resolve endpoints", slog.String("err", err.Error()))
+		if known {
+			b.refreshedAt = b.now()
+		}
+		return
+	}
+
+	b.setEndpoints(urls, logger)
+	b.refreshedAt = b.now()
+}
+
+// setEndpoints is a helper method which replaces the endpoints, keeping the health of those still resolved.
+// It must be called with the lock held.
+func (b *loadBalancer) setEndpoints(urls []string, logger *slog.Logger) {
+
+	existing := make(map[string]*endpoint, len(b.endpoints))
+	for _, e := range b.endpoints {
+		existing[e.base] = e
+	}
+
+	endpoints := make([]*endpoint, 0, len(urls))
+	for _, base := range urls {
+		if e, ok := existing[base]; ok {
+			endpoints = append(endpoints, e)
+			continue
+		}
+
+		u, err := url.Parse(base)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			logger.Error("ignoring invalid endpoint", slog.String("endpoint", base))
+			continue
+		}
+
+		endpoints = append(endpoints, &endpoint{
+			base:        base,
+			scheme:      u.Scheme,
+			host:        u.Host,
+			path:        strings.TrimSuffix(u.Path, "/"),
+			escapedPath: strings.TrimSuffix(u.EscapedPath(), "/"),
+		})
+	}
+
+	b.endpoints = endpoints
+}
+
+// pick selects the endpoint for a request attempt, preferring healthy endpoints not yet tried by the call.
+// If every healthy endpoint was tried, one is tried again.  If every endpoint is ejected, they are all used
+// rather than failing the call: failing fast is left to the circuit breaker.
+// The returned done function must be called with the attempt's outcome, it reports whether the endpoint was ejected.
+func (b *loadBalancer) pick(tried map[string]bool) (*endpoint, func(failed bool) bool, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.endpoints) == 0 {
+		return nil, nil, fmt.Errorf("no endpoints available")
+	}
+
+	now := b.now()
+	healthy := func(e *endpoint) bool { return !now.Before(e.ejectedUntil) }
+
+	candidates := b.filter(func(e *endpoint) bool { return healthy(e) && !tried[e.base] })
+	if len(candidates) == 0 {
+		candidates = b.filter(healthy)
+	}
+	if len(candidates) == 0 {
+		candidates = b.endpoints
+	}
+
+	start := b.next % len(candidates)
+	b.next++
+
+	selected := candidates[start]
+	if b.cfg.Strategy == LeastOutstanding {
+		for i := range candidates {
+			e := candidates[(start+i)%len(candidates)]
+			if e.outstanding < selected.outstanding {
+				selected = e
+			}
+		}
+	}
+
+	selected.outstanding++
+
+	return selected, func(failed bool) bool { return b.release(selected, failed) }, nil
+}
+
+// filter is a helper method which returns the endpoints matching the predicate.
+// It must be called with the lock held.
+func (b *loadBalancer) filter(match func(*endpoint) bool) []*endpoint {
+
+	var matched []*endpoint
+	for _, e := range b.endpoints {
+		if match(e) {
+			matched = append(matched, e)
+		}
+	}
+
+	return matched
+}
+
+// release records an attempt's outcome for the endpoint, ejecting it after too many consecutive failures.
+// It reports whether the endpoint was ejected.
+func (b *loadBalancer) release(e *endpoint, failed bool) bool {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.outstanding--
+
+	if !failed {
+		e.consecutive = 0
+		return false
+	}
+
+	e.consecutive++
+	if e.consecutive < b.cfg.EjectAfter {
+		return false
+	}
+
+	e.consecutive = 0
+	e.ejectedUntil = b.now().Add(b.cfg.EjectDuration)
+
+	return true
+}
+
+// withLoadBalancer is a middleware which sends each request attempt to an endpoint picked by the load balancer
+// and records the outcome.  It tracks the endpoints tried, so it must be created per call.
+func withLoadBalancer(b *loadBalancer, service string, logger *slog.Logger) S2sMiddleware {
+
+	tried := make(map[string]bool)
+
+	return func(next S2sHandler) S2sHandler {
+		return func(req *http.Request) (*http.Response, error) {
+
+			b.refresh(req.Context(), logger)
+
+			e, done, err := b.pick(tried)
+			if err != nil {
+				return nil, &ErrorHttp{
+					StatusCode: http.StatusServiceUnavailable,
+					Message:    fmt.Sprintf("%s service unavailable: %v", service, err),
+				}
+			}
+			tried[e.base] = true
+
+			// send the attempt to the endpoint, joining its base path with the request's path and keeping the query
+			req = req.Clone(req.Context())
+			req.URL.Scheme, req.URL.Host = e.scheme, e.host
+			if e.path != "" {
+				escaped := e.escapedPath + req.URL.EscapedPath()
+				req.URL.Path = e.path + req.URL.Path
+				req.URL.RawPath = escaped
+			}
+			req.Host = ""
+
+			response, err := next(req)
+
+			if done(isDownstreamFailure(response, err)) {
+				logger.Warn("ejecting failing endpoint",
+					slog.String("endpoint", e.base),
+					slog.Duration("eject_duration", b.cfg.EjectDuration),
+				)
+			}
+
+			return response, err
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package connect
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// mockResolver returns the urls or error, counting resolutions.
+type mockResolver struct {
+	urls  []string
+	err   error
+	calls int
+}
+
+func (m *mockResolver) Resolve(ctx context.Context) ([]string, error) {
+	m.calls++
+	return m.urls, m.err
+}
+
+var _ EndpointResolver = (*mockResolver)(nil)
+
+func TestLoadBalancer_Pick(t *testing.T) {
+
+	urls := []string{"https://10.0.0.1:8443", "https://10.0.0.2:8443", "https://10.0.0.3:8443"}
+
+	t.Run("round_robin", func(t *testing.T) {
+		b := newLoadBalancer(NewStaticResolver(urls...), LoadBalancerConfiguration{})
+		b.refresh(context.Background(), slog.Default())
+
+		var got []string
+		for range 4 {
+			e, done, err := b.pick(nil)
+			if err != nil {
+				t.Fatalf("pick() error: %v", err)
+			}
+			done(false)
+			got = append(got, e.base)
+		}
+
+		want := []string{urls[0], urls[1], urls[2], urls[0]}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("pick %d: want %s, got %s", i, want[i], got[i])
+			}
+		}
+	})
+
+	t.Run("least_outstanding", func(t *testing.T) {
+		b := newLoadBalancer(NewStaticResolver(urls...), LoadBalancerConfiguration{Strategy: LeastOutstanding})
+		b.refresh(context.Background(), slog.Default())
+
+		// two requests in flight on the first endpoint, one on the second
+		first, done1, _ := b.pick(nil)
+		b.pick(nil)
+		b.next = 0
+		b.endpoints[0].outstanding++
+
+		e, _, _ := b.pick(nil)
+		if e.base != urls[2] {
+			t.Errorf("want idle endpoint %s, got %s", urls[2], e.base)
+		}
+
+		done1(false)
+		if first.outstanding != 1 {
+			t.Errorf("outstanding after release: want 1, got %d", first.outstanding)
+		}
+	})
+
+	t.Run("skips_tried", func(t *testing.T) {
+		b := newLoadBalancer(NewStaticResolver(urls...), LoadBalancerConfiguration{})
+		b.refresh(context.Background(), slog.Default())
+
+		tried := map[string]bool{urls[0]: true, urls[1]: true}
+		e, _, _ := b.pick(tried)
+		if e.base != urls[2] {
+			t.Errorf("want untried endpoint %s, got %s", urls[2], e.base)
+		}
+
+		// every endpoint tried: one is tried again
+		tried[urls[2]] = true
+		if _, _, err := b.pick(tried); err != nil {
+			t.Errorf("pick() error: %v", err)
+		}
+	})
+
+	t.Run("ejects_failing_endpoint", func(t *testing.T) {
+		now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		b := newLoadBalancer(NewStaticResolver(urls[:2]...), LoadBalancerConfiguration{EjectAfter: 2, EjectDuration: time.Minute})
+		b.now = func() time.Time { return now }
+		b.refresh(context.Background(), slog.Default())
+
+		bad := b.endpoints[0]
+		for i := range 2 {
+			_, done, _ := b.pick(map[string]bool{urls[1]: true})
+			if ejected := done(true); ejected != (i == 1) {
+				t.Fatalf("failure %d: ejected = %v", i, ejected)
+			}
+		}
+
+		for range 3 {
+			e, done, _ := b.pick(nil)
+			done(false)
+			if e == bad {
+				t.Fatal("ejected endpoint was picked")
+			}
+		}
+
+		now = now.Add(time.Minute)
+		b.next = 0
+		if e, _, _ := b.pick(nil); e != bad {
+			t.Errorf("want endpoint back after eject duration, got %s", e.base)
+		}
+	})
+
+	t.Run("all_ejected_uses_all", func(t *testing.T) {
+		b := newLoadBalancer(NewStaticResolver(urls[0]), LoadBalancerConfiguration{EjectAfter: 1})
+		b.refresh(context.Background(), slog.Default())
+
+		_, done, _ := b.pick(nil)
+		done(true)
+
+		if _, _, err := b.pick(nil); err != nil {
+			t.Errorf("pick() error: %v", err)
+		}
+	})
+
+	t.Run("no_endpoints", func(t *testing.T) {
+		b := newLoadBalancer(&mockResolver{err: errors.New("no such host")}, LoadBalancerConfiguration{})
+		b.refresh(context.Background(), slog.Default())
+
+		if _, _, err := b.pick(nil); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func TestLoadBalancer_Refresh(t *testing.T) {
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	r := &mockResolver{urls: []string{"https://10.0.0.1:8443", "https://10.0.0.2:8443"}}
+	b := newLoadBalancer(r, LoadBalancerConfiguration{RefreshInterval: time.Minute, EjectAfter: 1, EjectDuration: time.Hour})
+	b.now = func() time.Time { return now }
+
+	b.refresh(context.Background(), slog.Default())
+	b.refresh(context.Background(), slog.Default())
+	if r.calls != 1 {
+		t.Fatalf("resolutions within interval: want 1, got %d", r.calls)
+	}
+
+	// eject the first endpoint: its health survives a refresh which still resolves it
+	_, done, _ := b.pick(nil)
+	done(true)
+
+	r.urls = []string{"https://10.0.0.1:8443", "https://10.0.0.3:8443", "not a url", "https://10.0.0.4:8443/api?v=1"}
+	now = now.Add(time.Minute)
+	b.refresh(context.Background(), slog.Default())
+	if r.calls != 2 {
+		t.Fatalf("resolutions after interval: want 2, got %d", r.calls)
+	}
+	if len(b.endpoints) != 2 || b.endpoints[1].base != "https://10.0.0.3:8443" {
+		t.Fatalf("unexpected endpoints after refresh: %v", b.endpoints)
+	}
+	if !now.Before(b.endpoints[0].ejectedUntil) {
+		t.Error("expected the retained endpoint to stay ejected")
+	}
+
+	// a failed resolution keeps the known endpoints
+	r.err = errors.New("no such host")
+	now = now.Add(time.Minute)
+	b.refresh(context.Background(), slog.Default())
+	if len(b.endpoints) != 2 {
+		t.Errorf("want known endpoints kept, got %d", len(b.endpoints))
+	}
+}
+
+func TestS2sCaller_LoadBalancer(t *testing.T) {
+
+	client := &mockTlsClient{responses: []func() (*http.Response, error){
+		respond(http.StatusServiceUnavailable, "application/json", `{"code":503,"message":"down"}`),
+		respond(http.StatusOK, "application/json", `{"id":"1"}`),
+	}}
+	caller := NewS2sCaller("https://gallery.svc/api", "gallery", client,
+		RetryConfiguration{MaxRetries: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		WithLoadBalancer(NewStaticResolver("https://10.0.0.1:8443", "https://10.0.0.2:8443/v1/"), LoadBalancerConfiguration{}),
+	)
+
+	got, err := GetServiceData[testResp](context.Background(), caller, "/albums?page=2", "s2s-token", "")
+	if err != nil {
+		t.Fatalf("GetServiceData() error: %v", err)
+	}
+	if got.Id != "1" {
+		t.Errorf("want id 1, got %q", got.Id)
+	}
+
+	if len(client.requests) != 2 {
+		t.Fatalf("attempts: want 2, got %d", len(client.requests))
+	}
+
+	want := []string{"https://10.0.0.1:8443/api/albums?page=2", "https://10.0.0.2:8443/v1/api/albums?page=2"}
+	for i, req := range client.requests {
+		if req.URL.String() != want[i] {
+			t.Errorf("attempt %d: want %s, got %s", i, want[i], req.URL.String())
+		}
+		if req.Header.Get("Service-Authorization") != "Bearer s2s-token" {
+			t.Errorf("attempt %d: missing service authorization header", i)
+		}
+	}
+}
+
+func TestS2sCaller_LoadBalancerBasePath(t *testing.T) {
+
+	client := &mockTlsClient{responses: []func() (*http.Response, error){
+		respond(http.StatusServiceUnavailable, "application/json", `{"code":503,"message":"down"}`),
+		respond(http.StatusOK, "application/json", `{"id":"1"}`),
+	}}
+	caller := NewS2sCaller("https://gallery.svc", "gallery", client,
+		RetryConfiguration{MaxRetries: 1, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		WithLoadBalancer(NewStaticResolver("https://10.0.0.1:8443/gallery%20api"), LoadBalancerConfiguration{EjectAfter: 5}),
+	)
+
+	if _, err := GetServiceData[testResp](context.Background(), caller, "/albums/a%2Fb", "", ""); err != nil {
+		t.Fatalf("GetServiceData() error: %v", err)
+	}
+
+	// the base path is prefixed once per attempt, including retries to the same endpoint
+	want := "https://10.0.0.1:8443/gallery%20api/albums/a%2Fb"
+	if len(client.requests) != 2 {
+		t.Fatalf("attempts: want 2, got %d", len(client.requests))
+	}
+	for i, req := range client.requests {
+		if req.URL.String() != want {
+			t.Errorf("attempt %d: want %s, got %s", i, want, req.URL.String())
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package connect
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tdeslauriers/carapace/internal/util"
+	"github.com/tdeslauriers/carapace/pkg/connect/telemetry"
+)
+
+// Peer auth failure reasons sent in the ErrorHttp reason field.
+const (
+	ReasonPeerUnauthorized string = "peer_unauthorized"
+	ReasonPeerForbidden    string = "peer_forbidden"
+)
+
+// PeerIdentitySource is the part of the peer's client certificate its identity was taken from.
+type PeerIdentitySource string
+
+const (
+	PeerIdentitySpiffe PeerIdentitySource = "spiffe"  // URI SAN, eg, spiffe://cluster.local/ns/prod/sa/gallery
+	PeerIdentityDns    PeerIdentitySource = "dns_san" // first DNS SAN, eg, gallery.svc.cluster.local
+	PeerIdentityCn     PeerIdentitySource = "cn"      // subject common name, eg, gallery.svc.cluster.local
+)
+
+// PeerIdentity is the identity of the calling service, taken from its verified mTLS client certificate.
+type PeerIdentity struct {
+	ServiceName string             // eg, gallery
+	Source      PeerIdentitySource // where the service name was taken from
+	Name        string             // the full spiffe id, DNS SAN, or common name
+	TrustDomain string             // spiffe trust domain, empty for other sources
+}
+
+// ErrNoPeerIdentity is returned when a client certificate has no spiffe id, DNS SAN, or common name.
+var ErrNoPeerIdentity = errors.New("client certificate has no service identity")
+
+// PeerIdentityFromCertificate returns the identity of the service holding the certificate, taken from, in order
+// of precedence, its spiffe URI SAN, its first DNS SAN, or its common name.
+// The service name is the last path segment of a spiffe id, or the first label of a DNS SAN or common name.
+func PeerIdentityFromCertificate(cert *x509.Certificate) (PeerIdentity, error) {
+
+	if cert == nil {
+		return PeerIdentity{}, ErrNoPeerIdentity
+	}
+
+	for _, uri := range cert.URIs {
+		if uri.Scheme != "spiffe" {
+			continue
+		}
+
+		segments := strings.Split(strings.Trim(uri.Path, "/"), "/")
+		name := segments[len(segments)-1]
+		if uri.Host == "" || name == "" {
+			return PeerIdentity{}, fmt.Errorf("%w: invalid spiffe id %s", ErrNoPeerIdentity, uri.String())
+		}
+
+		return PeerIdentity{
+			ServiceName: name,
+			Source:      PeerIdentitySpiffe,
+			Name:        uri.String(),
+			TrustDomain: uri.Host,
+		}, nil
+	}
+
+	if len(cert.DNSNames) > 0 && cert.DNSNames[0] != "" {
+		return PeerIdentity{
+			ServiceName: firstLabel(cert.DNSNames[0]),
+			Source:      PeerIdentityDns,
+			Name:        cert.DNSNames[0],
+		}, nil
+	}
+
+	if cert.Subject.CommonName != "" {
+		return PeerIdentity{
+			ServiceName: firstLabel(cert.Subject.CommonName),
+			Source:      PeerIdentityCn,
+			Name:        cert.Subject.CommonName,
+		}, nil
+	}
+
+	return PeerIdentity{}, ErrNoPeerIdentity
+}
+
+// firstLabel is a helper function which returns the first label of a domain name.
+func firstLabel(name string) string {
+	label, _, _ := strings.Cut(name, ".")
+	return label
+}
+
+// peerCtxKey is the context key type used to store the peer identity in the request context.
+type peerCtxKey string
+
+const peerIdentityKey peerCtxKey = "peer_identity"
+
+// PeerIdentityFromContext returns the peer identity added to the request context by the PeerAuthorizer.
+func PeerIdentityFromContext(ctx context.Context) (PeerIdentity, bool) {
+	id, ok := ctx.Value(peerIdentityKey).(PeerIdentity)
+	return id, ok
+}
+
+// PeerAuthorizer is an interface for http middleware which authorizes the calling service by the identity in its
+// verified mTLS client certificate, rather than only by the ca which issued it.
+type PeerAuthorizer interface {
+
+	// Authorize wraps the handler so it is only called if the peer's verified client certificate identifies one of
+	// the allowed services.  If the Authorizer verified an s2s token, ie, the handler is wrapped by Authorizer.Authorize
+	// first, the token's subject must be the same service.  The peer identity is added to the request context and
+	// can be retrieved with PeerIdentityFromContext.
+	Authorize(allowed []string, next http.Handler) http.Handler
+}
+
+// PeerAuthorizerOption is a functional option for configuring the PeerAuthorizer.
+type PeerAuthorizerOption func(*peerAuthorizer)
+
+// WithTrustDomain only accepts spiffe ids in the trust domain.  Certificates without a spiffe id are rejected.
+func WithTrustDomain(domain string) PeerAuthorizerOption {
+	return func(p *peerAuthorizer) { p.trustDomain = domain }
+}
+
+// WithS2sSubjects maps s2s token subjects, ie, s2s client ids, to service names for the cross-check, since
+// s2s tokens are issued to client ids.  Tokens with a subject not in the map are rejected.
+// Without it, the subject is compared to the service name as is.
+func WithS2sSubjects(subjects map[string]string) PeerAuthorizerOption {
+	return func(p *peerAuthorizer) { p.subjects = subjects }
+}
+
+// WithRequireS2sToken rejects requests without a verified s2s token in the context, eg, because the
+// PeerAuthorizer wraps the Authorizer rather than the other way round, so the cross-check cannot be skipped.
+func WithRequireS2sToken() PeerAuthorizerOption {
+	return func(p *peerAuthorizer) { p.requireS2s = true }
+}
+
+// NewPeerAuthorizer creates a new PeerAuthorizer interface with an underlying implementation.
+func NewPeerAuthorizer(opts ...PeerAuthorizerOption) PeerAuthorizer {
+
+	p := &peerAuthorizer{
+		logger: slog.Default().
+			With(slog.String(util.FrameworkKey, util.FrameworkCarapace)).
+			With(slog.String(util.PackageKey, util.PackageConnect)).
+			With(slog.String(util.ComponentKey, util.ComponentPeerAuthorizer)),
+	}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+var _ PeerAuthorizer = (*peerAuthorizer)(nil)
+
+// peerAuthorizer is the concrete implementation of the PeerAuthorizer interface.
+type peerAuthorizer struct {
+	trustDomain string            // if set, only spiffe ids in the trust domain are accepted
+	subjects    map[string]string // s2s token subject -> service name, nil to compare the subject as is
+	requireS2s  bool              // requests must carry a verified s2s token
+
+	logger *slog.Logger
+}
+
+// Authorize implements the PeerAuthorizer interface.
+func (p *peerAuthorizer) Authorize(allowed []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		log := p.logger
+		if tel, ok := r.Context().Value(telemetry.TelemetryKey).(*telemetry.Telemetry); ok && tel != nil {
+			log = log.With(tel.TelemetryFields()...)
+		}
+
+		// deny by default: a route must declare the services it allows
+		if len(allowed) == 0 {
+			log.Error("failed to authorize peer", slog.String("err", "no allowed services configured for route"))
+			e := ErrorHttp{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "internal server error",
+			}
+			e.SendJsonErr(w)
+			return
+		}
+
+		// only a certificate the tls handshake verified identifies the peer
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			log.Error("failed to authorize peer", slog.String("err", "no verified client certificate"))
+			e := ErrorHttp{
+				StatusCode: http.StatusUnauthorized,
+				Message:    "unauthorized: verified client certificate required",
+				Reason:     ReasonPeerUnauthorized,
+			}
+			e.SendJsonErr(w)
+			return
+		}
+
+		id, err := p.authorizePeer(r.Context(), r.TLS.VerifiedChains[0][0], allowed)
+		if err != nil {
+			log.Error("failed to authorize peer",
+				slog.String("peer.service", id.ServiceName),
+				slog.String("peer.name", id.Name),
+				slog.String("err", err.Error()),
+			)
+			e := ErrorHttp{
+				StatusCode: http.StatusForbidden,
+				Message:    "forbidden: calling service is not allowed",
+				Reason:     ReasonPeerForbidden,
+			}
+			e.SendJsonErr(w)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), peerIdentityKey, id)))
+	})
+}
+
+// authorizePeer is a helper method which checks the peer's identity against the trust domain, the allowed services,
+// and the subject of the verified s2s token, if any, returning the identity, as far as it was extracted, and the error.
+func (p *peerAuthorizer) authorizePeer(ctx context.Context, cert *x509.Certificate, allowed []string) (PeerIdentity, error) {
+
+	id, err := PeerIdentityFromCertificate(cert)
+	if err != nil {
+		return id, err
+	}
+
+	if p.trustDomain != "" && (id.Source != PeerIdentitySpiffe || id.TrustDomain != p.trustDomain) {
+		return id, fmt.Errorf("peer identity %s is not in trust domain %s", id.Name, p.trustDomain)
+	}
+
+	if !slices.Contains(allowed, id.ServiceName) {
+		return id, fmt.Errorf("peer service %s is not allowed", id.ServiceName)
+	}
+
+	tkn, ok := S2sTokenFromContext(ctx)
+	if !ok {
+		if p.requireS2s {
+			return id, fmt.Errorf("no verified s2s token to cross-check peer service %s", id.ServiceName)
+		}
+		return id, nil
+	}
+
+	service := tkn.Claims.Subject
+	if p.subjects != nil {
+		if service, ok = p.subjects[tkn.Claims.Subject]; !ok {
+			return id, fmt.Errorf("s2s token subject %s is not a known service", tkn.Claims.Subject)
+		}
+	}
+
+	if service != id.ServiceName {
+		return id, fmt.Errorf("s2s token service %s does not match peer service %s", service, id.ServiceName)
+	}
+
+	return id, nil
+}
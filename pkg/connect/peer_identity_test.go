@@ -0,0 +1,240 @@
+package connect
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+)
+
+// testPeerCert builds an unsigned certificate with the identity fields: only the fields are read.
+func testPeerCert(cn string, dns []string, uris ...string) *x509.Certificate {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: dns}
+	for _, u := range uris {
+		parsed, _ := url.Parse(u)
+		cert.URIs = append(cert.URIs, parsed)
+	}
+	return cert
+}
+
+func TestPeerIdentityFromCertificate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		want    PeerIdentity
+		wantErr bool
+	}{
+		{
+			name: "spiffe",
+			cert: testPeerCert("gallery.svc", []string{"gallery.svc"}, "spiffe://cluster.local/ns/prod/sa/gallery"),
+			want: PeerIdentity{ServiceName: "gallery", Source: PeerIdentitySpiffe, Name: "spiffe://cluster.local/ns/prod/sa/gallery", TrustDomain: "cluster.local"},
+		},
+		{
+			name: "non_spiffe_uri_ignored",
+			cert: testPeerCert("", []string{"gallery.svc.cluster.local"}, "https://gallery.test"),
+			want: PeerIdentity{ServiceName: "gallery", Source: PeerIdentityDns, Name: "gallery.svc.cluster.local"},
+		},
+		{
+			name:    "spiffe_without_path",
+			cert:    testPeerCert("gallery", nil, "spiffe://cluster.local"),
+			wantErr: true,
+		},
+		{
+			name: "dns_san",
+			cert: testPeerCert("other.svc", []string{"gallery.svc.cluster.local", "gallery"}),
+			want: PeerIdentity{ServiceName: "gallery", Source: PeerIdentityDns, Name: "gallery.svc.cluster.local"},
+		},
+		{
+			name: "common_name",
+			cert: testPeerCert("gallery", nil),
+			want: PeerIdentity{ServiceName: "gallery", Source: PeerIdentityCn, Name: "gallery"},
+		},
+		{
+			name:    "no_identity",
+			cert:    testPeerCert("", nil),
+			wantErr: true,
+		},
+		{
+			name:    "nil_certificate",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PeerIdentityFromCertificate(tt.cert)
+			if tt.wantErr {
+				if !errors.Is(err, ErrNoPeerIdentity) {
+					t.Fatalf("expected ErrNoPeerIdentity, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PeerIdentityFromCertificate() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("want %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPeerAuthorizer(t *testing.T) {
+
+	gallery := testPeerCert("gallery.svc", nil)
+	spiffeGallery := testPeerCert("", nil, "spiffe://cluster.local/ns/prod/sa/gallery")
+
+	tests := []struct {
+		name       string
+		opts       []PeerAuthorizerOption
+		allowed    []string
+		tls        *tls.ConnectionState
+		s2sSubject string // verified s2s token subject in the context, if not empty
+		wantStatus int
+		wantReason string
+	}{
+		{
+			name:       "allowed",
+			allowed:    []string{"pixie", "gallery"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{gallery}}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "not_allowed",
+			allowed:    []string{"pixie"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{gallery}}},
+			wantStatus: http.StatusForbidden,
+			wantReason: ReasonPeerForbidden,
+		},
+		{
+			name:       "no_tls",
+			allowed:    []string{"gallery"},
+			wantStatus: http.StatusUnauthorized,
+			wantReason: ReasonPeerUnauthorized,
+		},
+		{
+			name:       "unverified_certificate",
+			allowed:    []string{"gallery"},
+			tls:        &tls.ConnectionState{PeerCertificates: []*x509.Certificate{gallery}},
+			wantStatus: http.StatusUnauthorized,
+			wantReason: ReasonPeerUnauthorized,
+		},
+		{
+			name:       "no_allowed_services",
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{gallery}}},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "s2s_subject_matches",
+			allowed:    []string{"gallery"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{gallery}}},
+			s2sSubject: "gallery",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "s2s_subject_mismatch",
+			allowed:    []string{"gallery", "pixie"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{gallery}}},
+			s2sSubject: "pixie",
+			wantStatus: http.StatusForbidden,
+			wantReason: ReasonPeerForbidden,
+		},
+		{
+			name:       "s2s_subject_mapped",
+			opts:       []PeerAuthorizerOption{WithS2sSubjects(map[string]string{"client-uuid-1": "gallery"})},
+			allowed:    []string{"gallery"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{gallery}}},
+			s2sSubject: "client-uuid-1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "s2s_subject_not_mapped",
+			opts:       []PeerAuthorizerOption{WithS2sSubjects(map[string]string{"client-uuid-1": "gallery"})},
+			allowed:    []string{"gallery"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{gallery}}},
+			s2sSubject: "gallery",
+			wantStatus: http.StatusForbidden,
+			wantReason: ReasonPeerForbidden,
+		},
+		{
+			name:       "s2s_token_required",
+			opts:       []PeerAuthorizerOption{WithRequireS2sToken()},
+			allowed:    []string{"gallery"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{gallery}}},
+			wantStatus: http.StatusForbidden,
+			wantReason: ReasonPeerForbidden,
+		},
+		{
+			name:       "trust_domain_matches",
+			opts:       []PeerAuthorizerOption{WithTrustDomain("cluster.local")},
+			allowed:    []string{"gallery"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{spiffeGallery}}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "trust_domain_mismatch",
+			opts:       []PeerAuthorizerOption{WithTrustDomain("other.local")},
+			allowed:    []string{"gallery"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{spiffeGallery}}},
+			wantStatus: http.StatusForbidden,
+			wantReason: ReasonPeerForbidden,
+		},
+		{
+			name:       "trust_domain_requires_spiffe",
+			opts:       []PeerAuthorizerOption{WithTrustDomain("cluster.local")},
+			allowed:    []string{"gallery"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{gallery}}},
+			wantStatus: http.StatusForbidden,
+			wantReason: ReasonPeerForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPeer PeerIdentity
+			var gotOk bool
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPeer, gotOk = PeerIdentityFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/resource", nil)
+			req.TLS = tt.tls
+			if tt.s2sSubject != "" {
+				tkn := &jwt.Token{Claims: jwt.Claims{Subject: tt.s2sSubject}}
+				req = req.WithContext(context.WithValue(req.Context(), s2sTokenKey, tkn))
+			}
+			rec := httptest.NewRecorder()
+
+			NewPeerAuthorizer(tt.opts...).Authorize(tt.allowed, next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status: want %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				var e ErrorHttp
+				if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+					t.Fatalf("unmarshal error response: %v", err)
+				}
+				if e.Reason != tt.wantReason {
+					t.Errorf("reason: want %q, got %q", tt.wantReason, e.Reason)
+				}
+				return
+			}
+
+			if !gotOk || gotPeer.ServiceName != "gallery" {
+				t.Errorf("expected gallery peer identity in context, got %+v", gotPeer)
+			}
+		})
+	}
+}
@@ -0,0 +1,392 @@
+package connect
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/tdeslauriers/carapace/internal/util"
+	"github.com/tdeslauriers/carapace/pkg/config"
+)
+
+// PkiSource returns the current Pki, eg, read from a mounted k8s secret or fetched from a vault,
+// so rotated certificates can be picked up without a restart.
+type PkiSource func() (*Pki, error)
+
+// NewFilePkiSource creates a PkiSource which reads the pem encoded certificate, key, and ca certificates from files,
+// eg, a mounted k8s secret, each time it is called.
+func NewFilePkiSource(certPath, keyPath string, caPaths ...string) PkiSource {
+	return func() (*Pki, error) {
+
+		read := func(path string) (string, error) {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("failed to read %s: %v", path, err)
+			}
+			return base64.StdEncoding.EncodeToString(b), nil
+		}
+
+		cert, err := read(certPath)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := read(keyPath)
+		if err != nil {
+			return nil, err
+		}
+
+		cas := make([]string, 0, len(caPaths))
+		for _, path := range caPaths {
+			ca, err := read(path)
+			if err != nil {
+				return nil, err
+			}
+			cas = append(cas, ca)
+		}
+
+		return &Pki{CertFile: cert, KeyFile: key, CaFiles: cas}, nil
+	}
+}
+
+// PkiReloader is an interface for hot-reloading certificates: tls configs built from it always use the most
+// recently loaded certificate and ca certificates, so rotating them does not require a restart.
+type PkiReloader interface {
+
+	// Reload reads the Pki from its source and, if it changed, swaps it in for new tls handshakes.
+	// It reports whether the Pki changed.  If the new Pki is invalid, the current one is kept.
+	Reload() (bool, error)
+
+	// Watch reloads the Pki on the interval until the context is cancelled.  Errors are logged.
+	Watch(ctx context.Context, interval time.Duration)
+
+	// ServerConfig returns a TlsServerConfig whose tls.Config presents the current certificate and,
+	// for mutual tls, verifies client certificates against the current ca certificates.
+	ServerConfig(tlsType config.ServerTls) TlsServerConfig
+
+	// ClientConfig returns a TlsClientConfig whose tls.Config presents the current certificate and
+	// verifies servers against the system and current ca certificates.
+	ClientConfig() TlsClientConfig
+}
+
+// NewPkiReloader creates a new PkiReloader interface with an underlying implementation,
+// loading the Pki from the source.  It returns an error if the initial Pki cannot be loaded.
+func NewPkiReloader(source PkiSource) (PkiReloader, error) {
+
+	r := &pkiReloader{
+		source: source,
+
+		logger: slog.Default().
+			With(slog.String(util.FrameworkKey, util.FrameworkCarapace)).
+			With(slog.String(util.PackageKey, util.PackageConnect)).
+			With(slog.String(util.ComponentKey, util.ComponentPkiReloader)),
+	}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+var _ PkiReloader = (*pkiReloader)(nil)
+
+// pkiReloader is the concrete implementation of the PkiReloader interface.
+type pkiReloader struct {
+	source  PkiSource
+	current atomic.Pointer[loadedPki]
+
+	logger *slog.Logger
+}
+
+// loadedPki is a parsed Pki, swapped as a whole so a handshake never sees a mix of old and new.
+type loadedPki struct {
+	fingerprint [sha256.Size]byte // of the raw Pki, to detect changes
+	cert        *tls.Certificate
+	clientCAs   *x509.CertPool // ca certificates only
+	rootCAs     *x509.CertPool // system and ca certificates
+}
+
+// Reload implements the PkiReloader interface.
+func (r *pkiReloader) Reload() (bool, error) {
+
+	pki, err := r.source()
+	if err != nil {
+		return false, fmt.Errorf("failed to read pki: %v", err)
+	}
+
+	fingerprint := fingerprintPki(pki)
+	if current := r.current.Load(); current != nil && current.fingerprint == fingerprint {
+		return false, nil
+	}
+
+	loaded, err := parsePki(pki)
+	if err != nil {
+		return false, err
+	}
+	loaded.fingerprint = fingerprint
+
+	previous := r.current.Swap(loaded)
+
+	log := r.logger.With(
+		slog.String("cert.subject", loaded.cert.Leaf.Subject.CommonName),
+		slog.String("cert.serial", loaded.cert.Leaf.SerialNumber.String()),
+		slog.Time("cert.not_after", loaded.cert.Leaf.NotAfter),
+	)
+	if previous == nil {
+		log.Info("loaded certificate")
+	} else {
+		log.Info("reloaded certificate", slog.String("cert.previous_serial", previous.cert.Leaf.SerialNumber.String()))
+	}
+
+	return true, nil
+}
+
+// Watch implements the PkiReloader interface.
+func (r *pkiReloader) Watch(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reload(); err != nil {
+				r.logger.Error("failed to reload certificate, keeping current", slog.String("err", err.Error()))
+			}
+		}
+	}
+}
+
+// ServerConfig implements the PkiReloader interface.
+func (r *pkiReloader) ServerConfig(tlsType config.ServerTls) TlsServerConfig {
+	return &reloadingTlsServerConfig{
+		Type:     tlsType,
+		reloader: r,
+	}
+}
+
+// ClientConfig implements the PkiReloader interface.
+func (r *pkiReloader) ClientConfig() TlsClientConfig {
+	return &reloadingTlsClientConfig{
+		reloader: r,
+	}
+}
+
+// fingerprintPki is a helper function which hashes the raw Pki.
+func fingerprintPki(pki *Pki) [sha256.Size]byte {
+
+	h := sha256.New()
+	for _, v := range append([]string{pki.CertFile, pki.KeyFile}, pki.CaFiles...) {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+
+	return sum
+}
+
+// parsePki is a helper function which decodes and parses the Pki's key pair and ca certificates.
+func parsePki(pki *Pki) (*loadedPki, error) {
+
+	certPem, err := base64.StdEncoding.DecodeString(pki.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not base64 decode cert file: %v", err)
+	}
+
+	keyPem, err := base64.StdEncoding.DecodeString(pki.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not base64 decode key file: %v", err)
+	}
+
+	// public/private key pair
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse x509 key pair: %v", err)
+	}
+
+	// leaf is needed to log the serial and expiry, it is only populated by default since go 1.23
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse x509 certificate: %v", err)
+		}
+	}
+
+	systemCertPool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get system cert pool: %v", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	rootCAs := systemCertPool.Clone()
+	for _, v := range pki.CaFiles {
+		ca, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to base64 decode ca cert: %v", err)
+		}
+		if ok := clientCAs.AppendCertsFromPEM(ca); !ok {
+			return nil, fmt.Errorf("failed to load ca cert")
+		}
+		rootCAs.AppendCertsFromPEM(ca)
+	}
+
+	return &loadedPki{
+		cert:      &cert,
+		clientCAs: clientCAs,
+		rootCAs:   rootCAs,
+	}, nil
+}
+
+// reloadingTlsServerConfig is an implementation of the TlsServerConfig interface backed by a pkiReloader.
+type reloadingTlsServerConfig struct {
+	Type     config.ServerTls // standard or mutual
+	reloader *pkiReloader
+}
+
+var _ TlsServerConfig = (*reloadingTlsServerConfig)(nil)
+
+// Build constructs a tls.Config which looks up the current certificate and client ca pool on each handshake.
+func (cfg *reloadingTlsServerConfig) Build() (*tls.Config, error) {
+
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return cfg.reloader.current.Load().cert, nil
+	}
+
+	switch cfg.Type {
+	case config.StandardTls:
+		return &tls.Config{
+			GetCertificate: getCertificate,
+		}, nil
+	case config.MutualTls:
+		base := &tls.Config{
+			GetCertificate: getCertificate,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			MinVersion:     tls.VersionTLS13,
+		}
+
+		// the client ca pool cannot be looked up per handshake, so each handshake gets a config with the current pool
+		tlsConfig := base.Clone()
+		tlsConfig.ClientCAs = cfg.reloader.current.Load().clientCAs
+		tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c := base.Clone()
+			c.ClientCAs = cfg.reloader.current.Load().clientCAs
+			return c, nil
+		}
+
+		return tlsConfig, nil
+	default:
+		return nil, fmt.Errorf("invalid TLS type")
+	}
+}
+
+// reloadingTlsClientConfig is an implementation of the TlsClientConfig interface backed by a pkiReloader.
+type reloadingTlsClientConfig struct {
+	reloader *pkiReloader
+}
+
+var _ TlsClientConfig = (*reloadingTlsClientConfig)(nil)
+
+// Build constructs a tls.Config which looks up the current certificate and root ca pool on each handshake.
+// Since the root ca pool cannot be looked up per handshake, the server's certificate chain and host name
+// are verified in VerifyConnection rather than by the default verification.
+//
+// The server name is only known to VerifyConnection if it was sent as SNI, which is never the case for ip
+// addresses, so connections without one fail.  The TlsClient dials with dialTLSContext instead, which
+// verifies against the dialed host, including ip addresses.
+func (cfg *reloadingTlsClientConfig) Build() (*tls.Config, error) {
+	return cfg.build(""), nil
+}
+
+// build is a helper method which constructs the tls.Config, verifying the server against the host if it is
+// not empty, or against the SNI server name otherwise.
+func (cfg *reloadingTlsClientConfig) build(host string) *tls.Config {
+	return &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cfg.reloader.current.Load().cert, nil
+		},
+		ServerName:         host,
+		InsecureSkipVerify: true, // verified in VerifyConnection
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			name := host
+			if name == "" {
+				name = cs.ServerName
+			}
+			return verifyServer(cs, name, cfg.reloader.current.Load().rootCAs)
+		},
+		MinVersion: tls.VersionTLS13,
+	}
+}
+
+// dialTLSContext returns a dial function for an http.Transport which verifies each connection's server
+// certificate against the dialed host, whether a DNS name or an ip address.  The transport does not apply
+// its handshake timeout to a custom dial function, so it is applied here.
+func (cfg *reloadingTlsClientConfig) dialTLSContext(
+	dialer *net.Dialer,
+	handshakeTimeout time.Duration,
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %s: %v", addr, err)
+		}
+
+		raw, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		hsCtx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+		defer cancel()
+
+		conn := tls.Client(raw, cfg.build(host))
+		if err := conn.HandshakeContext(hsCtx); err != nil {
+			raw.Close()
+			return nil, err
+		}
+
+		return conn, nil
+	}
+}
+
+// verifyServer is a helper function which verifies the server's certificate chain against the root ca pool
+// and its certificate against the server name or ip address, as the default tls verification does.
+// It fails closed if there is no name to verify against.
+func verifyServer(cs tls.ConnectionState, name string, rootCAs *x509.CertPool) error {
+
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("server presented no certificate")
+	}
+
+	if name == "" {
+		return fmt.Errorf("no server name to verify server certificate against")
+	}
+
+	opts := x509.VerifyOptions{
+		DNSName:       name,
+		Roots:         rootCAs,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+
+	if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+		return fmt.Errorf("failed to verify server certificate: %v", err)
+	}
+
+	return nil
+}
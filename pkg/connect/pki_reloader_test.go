@@ -0,0 +1,322 @@
+package connect
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/config"
+)
+
+func TestPkiReloader_Reload(t *testing.T) {
+
+	pkiA, pkiB := newTestPKI(t), newTestPKI(t)
+
+	current := pkiA.serverPki()
+	var sourceErr error
+	source := func() (*Pki, error) { return current, sourceErr }
+
+	r, err := NewPkiReloader(source)
+	if err != nil {
+		t.Fatalf("NewPkiReloader() error: %v", err)
+	}
+	reloader := r.(*pkiReloader)
+	initial := reloader.current.Load()
+
+	tests := []struct {
+		name        string
+		pki         *Pki
+		sourceErr   error
+		wantChanged bool
+		wantErr     bool
+	}{
+		{name: "unchanged", pki: pkiA.serverPki()},
+		{name: "rotated", pki: pkiB.serverPki(), wantChanged: true},
+		{name: "invalid_keeps_current", pki: &Pki{CertFile: "!!!not-base64", KeyFile: "!!!not-base64"}, wantErr: true},
+		{name: "source_error_keeps_current", pki: pkiA.serverPki(), sourceErr: errors.New("secret not mounted"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := reloader.current.Load()
+			current, sourceErr = tt.pki, tt.sourceErr
+
+			changed, err := r.Reload()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("Reload() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if swapped := reloader.current.Load() != before; swapped != tt.wantChanged {
+				t.Errorf("pki swapped = %v, want %v", swapped, tt.wantChanged)
+			}
+		})
+	}
+
+	if reloader.current.Load() == initial {
+		t.Error("expected the rotated pki to be current")
+	}
+
+	if _, err := NewPkiReloader(func() (*Pki, error) { return nil, errors.New("secret not mounted") }); err == nil {
+		t.Error("expected NewPkiReloader() to fail if the initial pki cannot be loaded")
+	}
+}
+
+// TestPkiReloader_MutualTLS rotates both sides to a new CA without rebuilding the server or client:
+// new handshakes use the reloaded certificates and ca pools.
+func TestPkiReloader_MutualTLS(t *testing.T) {
+
+	pkiA, pkiB := newTestPKI(t), newTestPKI(t)
+
+	serverPki, clientPki := pkiA.serverPki(), pkiA.clientPki()
+	serverReloader, err := NewPkiReloader(func() (*Pki, error) { return serverPki, nil })
+	if err != nil {
+		t.Fatalf("NewPkiReloader() server error: %v", err)
+	}
+	clientReloader, err := NewPkiReloader(func() (*Pki, error) { return clientPki, nil })
+	if err != nil {
+		t.Fatalf("NewPkiReloader() client error: %v", err)
+	}
+
+	serverTLSCfg, err := serverReloader.ServerConfig(config.MutualTls).Build()
+	if err != nil {
+		t.Fatalf("build server TLS config: %v", err)
+	}
+
+	url := startTLSTestServer(t, serverTLSCfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	client, err := NewTlsClient(clientReloader.ClientConfig())
+	if err != nil {
+		t.Fatalf("NewTlsClient: %v", err)
+	}
+
+	// call is a helper which makes a request on a new connection, so a new handshake
+	call := func() error {
+		client.(*tlsClient).httpClient.CloseIdleConnections()
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if err := call(); err != nil {
+		t.Fatalf("Do before rotation: %v", err)
+	}
+
+	// only the server rotates: the client does not trust the new CA, the server does not trust the old client cert
+	serverPki = pkiB.serverPki()
+	if _, err := serverReloader.Reload(); err != nil {
+		t.Fatalf("Reload() server error: %v", err)
+	}
+	if err := call(); err == nil {
+		t.Fatal("expected handshake error while only the server is rotated, got nil")
+	}
+
+	clientPki = pkiB.clientPki()
+	if _, err := clientReloader.Reload(); err != nil {
+		t.Fatalf("Reload() client error: %v", err)
+	}
+	if err := call(); err != nil {
+		t.Fatalf("Do after rotation: %v", err)
+	}
+}
+
+func TestPkiReloader_RejectsWrongServerName(t *testing.T) {
+
+	pki := newTestPKI(t)
+
+	serverReloader, err := NewPkiReloader(func() (*Pki, error) { return pki.serverPki(), nil })
+	if err != nil {
+		t.Fatalf("NewPkiReloader() error: %v", err)
+	}
+	serverTLSCfg, err := serverReloader.ServerConfig(config.StandardTls).Build()
+	if err != nil {
+		t.Fatalf("build server TLS config: %v", err)
+	}
+
+	url := startTLSTestServer(t, serverTLSCfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	clientReloader, err := NewPkiReloader(func() (*Pki, error) { return pki.clientPki(), nil })
+	if err != nil {
+		t.Fatalf("NewPkiReloader() error: %v", err)
+	}
+	clientTLSCfg, err := clientReloader.ClientConfig().Build()
+	if err != nil {
+		t.Fatalf("build client TLS config: %v", err)
+	}
+
+	// the server's certificate is for localhost and 127.0.0.1 only
+	clientTLSCfg.ServerName = "gallery.svc"
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLSCfg}}
+
+	if _, err := client.Get(url); err == nil {
+		t.Fatal("expected server name verification error, got nil")
+	}
+}
+
+func TestFilePkiSource(t *testing.T) {
+
+	pki := newTestPKI(t)
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"tls.crt": pki.serverCertPEM,
+		"tls.key": pki.serverKeyPEM,
+		"ca.crt":  pki.caPEM,
+	}
+	for name, b := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	source := NewFilePkiSource(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt"))
+
+	got, err := source()
+	if err != nil {
+		t.Fatalf("source() error: %v", err)
+	}
+
+	want := pki.serverPki()
+	if got.CertFile != want.CertFile || got.KeyFile != want.KeyFile || len(got.CaFiles) != 1 || got.CaFiles[0] != want.CaFiles[0] {
+		t.Error("file pki does not match the pem files")
+	}
+
+	missing := NewFilePkiSource(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "missing.key"))
+	if _, err := missing(); err == nil {
+		t.Error("expected error for missing key file, got nil")
+	}
+}
+
+// dnsOnlyServerPki is a helper which generates a ca and a server certificate for localhost without ip SANs,
+// returning the server Pki and the ca pem.
+func dnsOnlyServerPki(t *testing.T) (*Pki, []byte) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create CA cert: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("parse CA cert: %v", err)
+	}
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate server key: %v", err)
+	}
+	serverTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caCert, &serverKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create server cert: %v", err)
+	}
+	serverKeyDER, err := x509.MarshalPKCS8PrivateKey(serverKey)
+	if err != nil {
+		t.Fatalf("marshal server key: %v", err)
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	return &Pki{
+		CertFile: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverDER})),
+		KeyFile:  base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: serverKeyDER})),
+		CaFiles:  []string{base64.StdEncoding.EncodeToString(caPEM)},
+	}, caPEM
+}
+
+// TestPkiReloader_RejectsIpWithoutIpSan dials the server by ip address: no SNI is sent,
+// so the server's certificate must still be verified against the ip.
+func TestPkiReloader_RejectsIpWithoutIpSan(t *testing.T) {
+
+	serverPki, caPEM := dnsOnlyServerPki(t)
+
+	serverReloader, err := NewPkiReloader(func() (*Pki, error) { return serverPki, nil })
+	if err != nil {
+		t.Fatalf("NewPkiReloader() server error: %v", err)
+	}
+	serverTLSCfg, err := serverReloader.ServerConfig(config.StandardTls).Build()
+	if err != nil {
+		t.Fatalf("build server TLS config: %v", err)
+	}
+
+	url := startTLSTestServer(t, serverTLSCfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	pki := newTestPKI(t)
+	clientPki := pki.clientPki()
+	clientPki.CaFiles = []string{base64.StdEncoding.EncodeToString(caPEM)}
+	clientReloader, err := NewPkiReloader(func() (*Pki, error) { return clientPki, nil })
+	if err != nil {
+		t.Fatalf("NewPkiReloader() client error: %v", err)
+	}
+
+	client, err := NewTlsClient(clientReloader.ClientConfig())
+	if err != nil {
+		t.Fatalf("NewTlsClient: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if _, err := client.Do(req); err == nil || !strings.Contains(err.Error(), "IP SANs") {
+		t.Fatalf("expected ip SAN verification error, got %v", err)
+	}
+
+	// the same server is trusted by its DNS name
+	req, _ = http.NewRequest(http.MethodGet, strings.Replace(url, "127.0.0.1", "localhost", 1), nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do by DNS name: %v", err)
+	}
+	resp.Body.Close()
+
+	// a tls.Config used without the TlsClient has no dialed host to verify against: it fails closed
+	clientTLSCfg, err := clientReloader.ClientConfig().Build()
+	if err != nil {
+		t.Fatalf("build client TLS config: %v", err)
+	}
+	raw := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLSCfg}}
+	if _, err := raw.Get(url); err == nil {
+		t.Fatal("expected handshake error without a server name, got nil")
+	}
+}
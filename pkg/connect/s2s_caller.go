@@ -3,7 +3,6 @@ package connect
 import (
 	"log/slog"
 	"math/rand"
-	"net/http"
 	"time"
 
 	"github.com/tdeslauriers/carapace/internal/util"
@@ -22,6 +21,9 @@ func init() {
 func addJitter(attempt int, baseBackoff, maxBackoff time.Duration) time.Duration {
 	// Get the next exponential backoff interval
 	backoff := baseBackoff * time.Duration(1<<attempt)
+	if backoff < 2 {
+		return backoff // too small to jitter
+	}
 
 	// Use the custom Rand instance for jitter calculation
 	jitter := backoff/2 + time.Duration(rng.Int63n(int64(backoff/2)))
@@ -34,42 +36,39 @@ func addJitter(attempt int, baseBackoff, maxBackoff time.Duration) time.Duration
 	return jitter
 }
 
-// willRetry checks if we should retry based on the error and attempt number
-func willRetry(statusCode, attempt, maxRetries int) bool {
-	if attempt < maxRetries {
-		return true
-	}
-
-	// 500 is used by upstream services to indicate an internal server error, so we do not retry on that
-	// since whatever the issue is, retrying will not help.
-	if statusCode == http.StatusTooManyRequests ||
-		(statusCode > 500 && statusCode <= 599) {
-		return true
-	}
-
-	return false
-}
-
 // RetryConfiguration is a struct that holds the configuration for retrying service calls.
 type RetryConfiguration struct {
-	MaxRetries  int
+	MaxRetries  int // retries after the first attempt for Do and GetServiceData, ie, 0 makes a single attempt, see writeCaller
 	BaseBackoff time.Duration
 	MaxBackoff  time.Duration
 }
 
 // S2sCaller is used to call downstream services with s2s authentication and retry logic.
 type S2sCaller struct {
-	ServiceUrl  string
+	ServiceUrl  string // only the path is used if the caller has a load balancer
 	ServiceName string
 	TlsClient   TlsClient
 	RetryConfig RetryConfiguration
 
+	middleware []S2sMiddleware // applied to every request attempt, first is outermost
+	breaker    *circuitBreaker // nil if the caller has no circuit breaker
+	balancer   *loadBalancer   // nil if requests are sent to the ServiceUrl's host
+
 	logger *slog.Logger
 }
 
+// S2sCallerOption is a functional option for configuring the S2sCaller.
+type S2sCallerOption func(*S2sCaller)
+
+// WithMiddleware adds middleware which every request attempt passes through, in order, eg, to log or record metrics.
+func WithMiddleware(mw ...S2sMiddleware) S2sCallerOption {
+	return func(c *S2sCaller) { c.middleware = append(c.middleware, mw...) }
+}
+
 // NewS2sCaller creates a new S2sCaller interface with underlying implementation.
-func NewS2sCaller(url, name string, client TlsClient, retry RetryConfiguration) *S2sCaller {
-	return &S2sCaller{
+func NewS2sCaller(url, name string, client TlsClient, retry RetryConfiguration, opts ...S2sCallerOption) *S2sCaller {
+
+	c := &S2sCaller{
 		ServiceUrl:  url,
 		ServiceName: name,
 		TlsClient:   client,
@@ -80,4 +79,23 @@ func NewS2sCaller(url, name string, client TlsClient, retry RetryConfiguration)
 			With(slog.String(util.ComponentKey, util.ComponentS2sCaller)).
 			With(slog.String(util.ServiceKey, util.FrameworkCarapace)),
 	}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// writeCaller is a helper method which returns a copy of the caller for the write helpers, ie, PostToService,
+// PutToService, PatchToService, and DeleteFromService.  They have always made at most MaxRetries attempts,
+// rather than MaxRetries retries after the first, so the same configuration does not repeat writes more often.
+// At least one attempt is made.
+func (c *S2sCaller) writeCaller() *S2sCaller {
+
+	w := *c
+	w.RetryConfig.MaxRetries = max(c.RetryConfig.MaxRetries-1, 0)
+
+	return &w
 }
@@ -1,6 +1,7 @@
 package connect
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -12,9 +13,9 @@ import (
 // Adds in meta data to the logging from the caller struct.
 func (caller *S2sCaller) RespondUpstreamError(err error, w http.ResponseWriter) {
 
-	// checks for expected ErrorHttp type and handles logging and writing to response if different type
-	errMsg, ok := err.(*ErrorHttp)
-	if !ok {
+	// checks for expected ErrorHttp type, which may be wrapped, and handles writing to response if different type
+	var errMsg *ErrorHttp
+	if !errors.As(err, &errMsg) {
 		e := ErrorHttp{
 			StatusCode: http.StatusInternalServerError,
 			Message:    "internal server error",
@@ -34,63 +35,65 @@ func (caller *S2sCaller) RespondUpstreamError(err error, w http.ResponseWriter)
 
 	case http.StatusUnauthorized:
 
+		switch upstreamAuthReason(errMsg, jwt.S2sUnauthorizedErrMsg, jwt.UserUnauthorizedErrMsg) {
+
 		// s2s token unauthorized
-		if strings.Contains(errMsg.Message, jwt.S2sUnauthorizedErrMsg) {
+		case ReasonS2sUnauthorized:
 			e := ErrorHttp{
 				StatusCode: http.StatusInternalServerError,
 				Message:    "internal server error",
 			}
 			e.SendJsonErr(w)
-			break
-		}
 
 		// user token unauthorized
-		if strings.Contains(errMsg.Message, jwt.UserUnauthorizedErrMsg) {
+		case ReasonUserUnauthorized:
 			e := ErrorHttp{
 				StatusCode: http.StatusUnauthorized,
 				Message:    "unauthorized",
+				Reason:     ReasonUserUnauthorized,
 			}
 			e.SendJsonErr(w)
-			break
-		}
 
 		// all other unauthorized errors
-		e := ErrorHttp{
-			StatusCode: http.StatusUnauthorized,
-			Message:    errMsg.Message,
+		default:
+			e := ErrorHttp{
+				StatusCode: http.StatusUnauthorized,
+				Message:    errMsg.Message,
+			}
+			e.SendJsonErr(w)
 		}
-		e.SendJsonErr(w)
 
 	case http.StatusForbidden:
+
+		switch upstreamAuthReason(errMsg, jwt.S2sForbiddenErrMsg, jwt.UserForbdiddenErrMsg) {
+
 		// call returned forbidden for s2s token
-		if strings.Contains(errMsg.Message, jwt.S2sForbiddenErrMsg) {
+		case ReasonS2sForbidden:
 			caller.logger.Error(errMsg.Message)
 			e := ErrorHttp{
 				StatusCode: http.StatusInternalServerError,
 				Message:    "internal server error", // this should never happen --> means I didnt provision the service correctly
 			}
 			e.SendJsonErr(w)
-			break
-		}
 
 		// call returned forbidden for user token
-		if strings.Contains(errMsg.Message, jwt.UserForbdiddenErrMsg) {
+		case ReasonUserForbidden:
 			e := ErrorHttp{
 				StatusCode: http.StatusForbidden,
 				Message:    "forbidden",
+				Reason:     ReasonUserForbidden,
 			}
 			e.SendJsonErr(w)
-			break
-		}
 
 		// call returned forbidden for permissions
-		if strings.Contains(errMsg.Message, permissions.UserForbidden) {
-			e := ErrorHttp{
-				StatusCode: http.StatusForbidden,
-				Message:    "forbidden",
+		default:
+			if strings.Contains(errMsg.Message, permissions.UserForbidden) {
+				e := ErrorHttp{
+					StatusCode: http.StatusForbidden,
+					Message:    "forbidden",
+				}
+				e.SendJsonErr(w)
 			}
-			e.SendJsonErr(w)
-			break
 		}
 	case http.StatusNotFound:
 		e := ErrorHttp{
@@ -145,3 +148,28 @@ func (caller *S2sCaller) RespondUpstreamError(err error, w http.ResponseWriter)
 		e.SendJsonErr(w)
 	}
 }
+
+// upstreamAuthReason is a helper function which returns the auth failure reason of an upstream 401 or 403 error.
+// Upstream services which do not yet send a reason are matched on the standard s2s and user error messages.
+func upstreamAuthReason(errMsg *ErrorHttp, s2sMsg, userMsg string) string {
+
+	if errMsg.Reason != "" {
+		return errMsg.Reason
+	}
+
+	if strings.Contains(errMsg.Message, s2sMsg) {
+		if errMsg.StatusCode == http.StatusForbidden {
+			return ReasonS2sForbidden
+		}
+		return ReasonS2sUnauthorized
+	}
+
+	if strings.Contains(errMsg.Message, userMsg) {
+		if errMsg.StatusCode == http.StatusForbidden {
+			return ReasonUserForbidden
+		}
+		return ReasonUserUnauthorized
+	}
+
+	return ""
+}
@@ -0,0 +1,98 @@
+package connect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	"github.com/tdeslauriers/carapace/pkg/permissions"
+)
+
+func TestRespondUpstreamError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantMsg    string
+	}{
+		{
+			name:       "s2s_unauthorized_reason",
+			err:        &ErrorHttp{StatusCode: http.StatusUnauthorized, Message: "token expired", Reason: ReasonS2sUnauthorized},
+			wantStatus: http.StatusInternalServerError,
+			wantMsg:    "internal server error",
+		},
+		{
+			name:       "user_unauthorized_reason",
+			err:        &ErrorHttp{StatusCode: http.StatusUnauthorized, Message: "token expired", Reason: ReasonUserUnauthorized},
+			wantStatus: http.StatusUnauthorized,
+			wantMsg:    "unauthorized",
+		},
+		{
+			name:       "user_unauthorized_legacy_message",
+			err:        &ErrorHttp{StatusCode: http.StatusUnauthorized, Message: jwt.UserUnauthorizedErrMsg},
+			wantStatus: http.StatusUnauthorized,
+			wantMsg:    "unauthorized",
+		},
+		{
+			name:       "other_unauthorized_passed_through",
+			err:        &ErrorHttp{StatusCode: http.StatusUnauthorized, Message: "invalid credentials"},
+			wantStatus: http.StatusUnauthorized,
+			wantMsg:    "invalid credentials",
+		},
+		{
+			name:       "s2s_forbidden_reason",
+			err:        &ErrorHttp{StatusCode: http.StatusForbidden, Message: "incorrect audience", Reason: ReasonS2sForbidden},
+			wantStatus: http.StatusInternalServerError,
+			wantMsg:    "internal server error",
+		},
+		{
+			name:       "user_forbidden_legacy_message",
+			err:        &ErrorHttp{StatusCode: http.StatusForbidden, Message: jwt.UserForbdiddenErrMsg},
+			wantStatus: http.StatusForbidden,
+			wantMsg:    "forbidden",
+		},
+		{
+			name:       "permissions_forbidden",
+			err:        &ErrorHttp{StatusCode: http.StatusForbidden, Message: permissions.UserForbidden},
+			wantStatus: http.StatusForbidden,
+			wantMsg:    "forbidden",
+		},
+		{
+			name:       "wrapped_error_http",
+			err:        fmt.Errorf("failed to introspect pat token: %w", &ErrorHttp{StatusCode: http.StatusForbidden, Reason: ReasonUserForbidden}),
+			wantStatus: http.StatusForbidden,
+			wantMsg:    "forbidden",
+		},
+		{
+			name:       "not_error_http",
+			err:        errors.New("connection refused"),
+			wantStatus: http.StatusInternalServerError,
+			wantMsg:    "internal server error",
+		},
+	}
+
+	caller := NewS2sCaller("https://localhost:8443", "upstream", nil, RetryConfiguration{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			caller.RespondUpstreamError(tt.err, rec)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status: want %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			var e ErrorHttp
+			if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+				t.Fatalf("failed to decode error response: %v", err)
+			}
+			if e.Message != tt.wantMsg {
+				t.Errorf("message: want %q, got %q", tt.wantMsg, e.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package connect
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/tdeslauriers/carapace/internal/util"
+	"github.com/tdeslauriers/carapace/pkg/connect/telemetry"
+)
+
+// LoggingMiddleware returns an S2sMiddleware which logs every request attempt with its method, target,
+// status code or error, and duration, and the telemetry fields of the request context, if any.
+// Attempts which error or return a 5xx are logged as errors, others as info.
+// Headers, query strings, and bodies are not logged, so tokens and request data are not written to the logs.
+// eg, NewS2sCaller(url, name, client, retry, WithMiddleware(LoggingMiddleware())).
+func LoggingMiddleware() S2sMiddleware {
+
+	logger := slog.Default().
+		With(slog.String(util.FrameworkKey, util.FrameworkCarapace)).
+		With(slog.String(util.PackageKey, util.PackageConnect)).
+		With(slog.String(util.ComponentKey, util.ComponentS2sLogging))
+
+	return func(next S2sHandler) S2sHandler {
+		return func(req *http.Request) (*http.Response, error) {
+
+			log := logger.With(
+				slog.String("method", req.Method),
+				slog.String("target_host", req.URL.Host),
+				slog.String("target_path", req.URL.Path),
+			)
+			if tel, ok := req.Context().Value(telemetry.TelemetryKey).(*telemetry.Telemetry); ok && tel != nil {
+				log = log.With(tel.TelemetryFields()...)
+			}
+
+			start := time.Now()
+			response, err := next(req)
+			log = log.With(slog.Int64("duration_ms", time.Since(start).Milliseconds()))
+
+			switch {
+			case err != nil:
+				log.Error("s2s request attempt failed", slog.String("err", err.Error()))
+			case response.StatusCode >= http.StatusInternalServerError:
+				log.Error("s2s request attempt returned a server error", slog.Int("status_code", response.StatusCode))
+			default:
+				log.Info("s2s request attempt completed", slog.Int("status_code", response.StatusCode))
+			}
+
+			return response, err
+		}
+	}
+}
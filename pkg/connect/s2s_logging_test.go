@@ -0,0 +1,90 @@
+package connect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	client := &mockTlsClient{responses: []func() (*http.Response, error){
+		respond(http.StatusServiceUnavailable, "application/json", `{"code":503,"message":"down"}`),
+		respond(http.StatusOK, "application/json", `{"id":"1"}`),
+	}}
+	caller := NewS2sCaller("https://gallery.test", "gallery", client,
+		RetryConfiguration{MaxRetries: 1, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		WithMiddleware(LoggingMiddleware()),
+	)
+
+	if _, err := GetServiceData[testResp](context.Background(), caller, "/albums?page=2", "s2s-token", "user-token"); err != nil {
+		t.Fatalf("GetServiceData() error: %v", err)
+	}
+
+	// one entry per attempt from the logging middleware
+	var attempts []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("failed to parse log line %q: %v", line, err)
+		}
+		if entry["component"] == "s2s logging" {
+			attempts = append(attempts, entry)
+		}
+	}
+
+	if len(attempts) != 2 {
+		t.Fatalf("logged attempts: want 2, got %d: %s", len(attempts), buf.String())
+	}
+
+	for i, want := range []struct {
+		level  string
+		status float64
+	}{
+		{level: "ERROR", status: http.StatusServiceUnavailable},
+		{level: "INFO", status: http.StatusOK},
+	} {
+		entry := attempts[i]
+		if entry["level"] != want.level || entry["status_code"] != want.status {
+			t.Errorf("attempt %d: want %s %v, got %v %v", i, want.level, want.status, entry["level"], entry["status_code"])
+		}
+		if entry["method"] != http.MethodGet || entry["target_host"] != "gallery.test" || entry["target_path"] != "/albums" {
+			t.Errorf("attempt %d: unexpected target fields: %v", i, entry)
+		}
+		if _, ok := entry["duration_ms"]; !ok {
+			t.Errorf("attempt %d: missing duration_ms", i)
+		}
+	}
+
+	// tokens and query strings are not logged by the middleware
+	logged, err := json.Marshal(attempts)
+	if err != nil {
+		t.Fatalf("failed to marshal logged attempts: %v", err)
+	}
+	for _, secret := range []string{"s2s-token", "user-token", "page=2"} {
+		if strings.Contains(string(logged), secret) {
+			t.Errorf("logged attempts contain %q", secret)
+		}
+	}
+
+	// a transport error is logged with the error
+	buf.Reset()
+	client = &mockTlsClient{responses: []func() (*http.Response, error){fail(errors.New("connection refused"))}}
+	caller = NewS2sCaller("https://gallery.test", "gallery", client, RetryConfiguration{}, WithMiddleware(LoggingMiddleware()))
+	GetServiceData[testResp](context.Background(), caller, "/albums", "", "")
+
+	if !strings.Contains(buf.String(), `"msg":"s2s request attempt failed"`) || !strings.Contains(buf.String(), "connection refused") {
+		t.Errorf("expected a failed attempt log entry, got %s", buf.String())
+	}
+}
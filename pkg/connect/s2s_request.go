@@ -0,0 +1,406 @@
+package connect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tdeslauriers/carapace/pkg/connect/telemetry"
+)
+
+// S2sHandler sends a single s2s request attempt to a downstream service and returns its response.
+type S2sHandler func(req *http.Request) (*http.Response, error)
+
+// S2sMiddleware wraps an S2sHandler, eg, to set headers on, log, or record metrics for every request attempt.
+// A middleware may return an *ErrorHttp to fail the call without sending the request: it is returned to the caller as is.
+type S2sMiddleware func(next S2sHandler) S2sHandler
+
+// Do makes a request to a downstream service's endpoint with s2s authentication and retry logic including
+// exponential backoff + jitter.  The body, if not nil, is sent as json, and a json response body is decoded into TResp:
+// a 2xx response without a body returns the zero value of TResp, except for GET, which requires a json body.
+//
+// Every attempt passes through the circuit breaker and load balancer, if any, the auth header and telemetry
+// middleware, then the caller's middleware in the order they were added, before the caller's TlsClient sends it.
+// Do and GetServiceData make up to RetryConfig.MaxRetries retries after the first attempt, the write helpers,
+// eg, PostToService, make at most MaxRetries attempts.
+// Errors are returned as *ErrorHttp: transport errors other than timeouts are 503s.
+//
+// POST and PATCH requests carry an Idempotency-Key header, the same for every attempt, from WithIdempotencyKey
+// or generated per call.
+func Do[TReq any, TResp any](
+	ctx context.Context,
+	caller *S2sCaller,
+	method,
+	endpoint,
+	s2sToken,
+	authToken string,
+	body *TReq,
+) (TResp, error) {
+
+	// initialize zero value of generic type TResp
+	var data TResp
+
+	// build url
+	url := fmt.Sprintf("%s%s", caller.ServiceUrl, endpoint)
+
+	// extract telemetry from context if exists
+	tel, ok := ctx.Value(telemetry.TelemetryKey).(*telemetry.Telemetry)
+	if !ok {
+		caller.logger.Warn(fmt.Sprintf("failed to extract telemetry from context of s2s %s call", method))
+	}
+
+	// add universal fields to logger
+	logger := caller.logger.With(
+		slog.String("method", method),
+		slog.String("target_service", caller.ServiceName),
+		slog.String("target_url", url),
+		slog.Int("retry.max_retries", caller.RetryConfig.MaxRetries),
+	)
+
+	// add telemetry fields to logger if exists
+	if tel != nil {
+		logger = logger.With(tel.TelemetryFields()...)
+	}
+
+	// marshal request body once: it is replayed for each attempt
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return data, &ErrorHttp{
+				StatusCode: http.StatusInternalServerError,
+				Message:    fmt.Sprintf("failed to marshal data to json: %v", err),
+			}
+		}
+	}
+
+	// set up request: bound to the context so a cancelled inbound request stops calling the downstream service
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return data, &ErrorHttp{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("failed to create %s request: %v", method, err),
+		}
+	}
+
+	// writes carry an idempotency key, the same for every attempt, so the downstream service can drop duplicates
+	if method == http.MethodPost || method == http.MethodPatch {
+		key, ok := IdempotencyKeyFromContext(ctx)
+		if !ok {
+			key = uuid.NewString()
+		}
+		request.Header.Set(IdempotencyKeyHeader, key)
+	}
+
+	// build the middleware chain around the TlsClient: the first middleware is the outermost
+	handler := S2sHandler(caller.TlsClient.Do)
+	for i := len(caller.middleware) - 1; i >= 0; i-- {
+		handler = caller.middleware[i](handler)
+	}
+	handler = withTelemetryHeader(tel, logger)(handler)
+	handler = withAuthHeaders(s2sToken, authToken)(handler)
+	if caller.balancer != nil {
+		handler = withLoadBalancer(caller.balancer, caller.ServiceName, logger)(handler)
+	}
+	if caller.breaker != nil {
+		handler = withCircuitBreaker(caller.breaker, caller.ServiceName, logger)(handler)
+	}
+	handler = withRetry(caller.RetryConfig, logger)(handler)
+
+	response, err := handler(request)
+	if err != nil {
+		return data, toErrorHttp(err, logger)
+	}
+
+	return decodeResponse[TResp](response, method, logger)
+}
+
+// withAuthHeaders is a middleware which sets the json content type, and the service and user
+// authorization headers if their tokens are not empty.
+func withAuthHeaders(s2sToken, authToken string) S2sMiddleware {
+	return func(next S2sHandler) S2sHandler {
+		return func(req *http.Request) (*http.Response, error) {
+
+			// set content type header to application/json
+			req.Header.Set("Content-Type", "application/json")
+
+			// set service token service-authorization header
+			if s2sToken != "" {
+				req.Header.Set("Service-Authorization", fmt.Sprintf("Bearer %s", s2sToken))
+			}
+
+			// set user access token authorization header
+			if authToken != "" {
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authToken))
+			}
+
+			return next(req)
+		}
+	}
+}
+
+// withTelemetryHeader is a middleware which sets the traceparent header from the telemetry, if it exists.
+func withTelemetryHeader(tel *telemetry.Telemetry, logger *slog.Logger) S2sMiddleware {
+	return func(next S2sHandler) S2sHandler {
+		return func(req *http.Request) (*http.Response, error) {
+
+			if tel != nil {
+				req.Header.Set("traceparent", tel.Traceparent.BuildTraceparentString(logger))
+			}
+
+			return next(req)
+		}
+	}
+}
+
+// withRetry is a middleware which retries timeouts, 429s, and 5xx responses other than 500 up to the
+// configured max retries, with exponential backoff + jitter, or the downstream's Retry-After on a 429 or 503
+// if it is longer.  Once retries are exhausted, or if the next attempt could not start before the request
+// context's deadline, the last response or error is returned.  Backoff ends early if the context is cancelled.
+func withRetry(cfg RetryConfiguration, logger *slog.Logger) S2sMiddleware {
+	return func(next S2sHandler) S2sHandler {
+		return func(req *http.Request) (*http.Response, error) {
+
+			for attempt := 0; ; attempt++ {
+
+				// the body was consumed by the previous attempt
+				if attempt > 0 && req.GetBody != nil {
+					body, err := req.GetBody()
+					if err != nil {
+						return nil, &ErrorHttp{
+							StatusCode: http.StatusInternalServerError,
+							Message:    fmt.Sprintf("failed to replay request body: %v", err),
+						}
+					}
+					req = req.Clone(req.Context())
+					req.Body = body
+				}
+
+				response, err := next(req)
+
+				ctx := req.Context()
+				if ctx.Err() != nil || !isRetryable(response, err) || attempt >= cfg.MaxRetries {
+					return response, err
+				}
+
+				attemptLogger := logger.With(slog.Int("retry.attempt", attempt))
+
+				// apply backoff/jitter, or the downstream's Retry-After if it asks for longer
+				backoff := addJitter(attempt, cfg.BaseBackoff, cfg.MaxBackoff)
+				if wait, ok := retryAfter(response, time.Now()); ok {
+					if cfg.MaxBackoff > 0 && wait > cfg.MaxBackoff {
+						attemptLogger.Error("downstream retry-after exceeds max backoff, will not retry",
+							slog.Duration("retry.after", wait))
+						return response, err
+					}
+					backoff = max(backoff, wait)
+				}
+
+				// a retry which cannot start before the deadline would be wasted
+				if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+					attemptLogger.Error("backoff exceeds the remaining request deadline, will not retry",
+						slog.Duration("retry.backoff", backoff))
+					return response, err
+				}
+
+				// discard the failed response before the next attempt
+				if response != nil {
+					attemptLogger = attemptLogger.With(slog.Int("status_code", response.StatusCode))
+					io.Copy(io.Discard, response.Body)
+					response.Body.Close()
+				}
+				if err != nil {
+					attemptLogger = attemptLogger.With(slog.String("err", err.Error()))
+				}
+
+				attemptLogger.Error("retryable error, will retry", slog.Duration("retry.backoff", backoff))
+
+				timer := time.NewTimer(backoff)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+// isRetryable is a helper function which reports whether a request attempt failed in a way that a retry may fix:
+// a timeout, 429, or 5xx other than 500.
+func isRetryable(response *http.Response, err error) bool {
+
+	if err != nil {
+		var nErr net.Error
+		return errors.As(err, &nErr) && nErr.Timeout()
+	}
+
+	return isRetryableStatus(response.StatusCode)
+}
+
+// isRetryableStatus is a helper function which reports whether a status code is retried.
+// Note: 500 itself is not retried because likely an upstream error with the server where a
+// retry will not help, but 502, 503, 504, etc., are retried
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || (statusCode > 500 && statusCode <= 599)
+}
+
+// retryAfter is a helper function which returns the wait requested by a 429 or 503 response's Retry-After header,
+// either delay seconds or an http date.
+func retryAfter(response *http.Response, now time.Time) (time.Duration, bool) {
+
+	if response == nil ||
+		(response.StatusCode != http.StatusTooManyRequests && response.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+
+	header := strings.TrimSpace(response.Header.Get("Retry-After"))
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+
+	return 0, false
+}
+
+// toErrorHttp is a helper function which converts an error sending a request to an *ErrorHttp.
+func toErrorHttp(err error, logger *slog.Logger) error {
+
+	// errors from middleware are returned as is
+	var e *ErrorHttp
+	if errors.As(err, &e) {
+		return e
+	}
+
+	// the request context ended: checked first since a deadline exceeded error is also a net.Error timeout
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.Error("request deadline exceeded", slog.String("err", err.Error()))
+		return &ErrorHttp{
+			StatusCode: http.StatusGatewayTimeout,
+			Message:    "request deadline exceeded",
+		}
+	}
+
+	if errors.Is(err, context.Canceled) {
+		logger.Warn("request cancelled", slog.String("err", err.Error()))
+		return &ErrorHttp{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "request cancelled",
+		}
+	}
+
+	// check if network error such as timeout, etc.
+	var nErr net.Error
+	if errors.As(err, &nErr) {
+		if nErr.Timeout() {
+			logger.Error("retries exhausted: request timed out", slog.String("err", err.Error()))
+			return &ErrorHttp{
+				StatusCode: http.StatusServiceUnavailable,
+				Message:    "retries exhausted: timeout",
+			}
+		}
+
+		logger.Error("request yielded a non-timeout network error", slog.String("err", err.Error()))
+	} else {
+		logger.Error("request yielded a non-network error", slog.String("err", err.Error()))
+	}
+
+	return &ErrorHttp{
+		StatusCode: http.StatusServiceUnavailable,
+		Message:    fmt.Sprintf("service unavailable: %v", err),
+	}
+}
+
+// decodeResponse is a helper function which reads and closes a downstream response, decoding a 2xx json body into T,
+// or an error response body into an *ErrorHttp.
+// GET responses are checked as GetServiceData always has: they must have a json Content-Type, and a 2xx
+// must have a json body.  Other methods may respond without a body, eg, 201 or 204.
+func decodeResponse[T any](response *http.Response, method string, logger *slog.Logger) (T, error) {
+
+	var data T
+	bodyRequired := method == http.MethodGet
+
+	// read response body
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return data, &ErrorHttp{
+			StatusCode: http.StatusInternalServerError,
+			Message:    fmt.Sprintf("failed to read response body: %v", err),
+		}
+	}
+
+	// validate Content-Type is application/json if there is a response body, eg, 201 and 204 may not have one
+	if len(body) > 0 || bodyRequired {
+		contentType := response.Header.Get("Content-Type")
+		if !strings.HasPrefix(contentType, "application/json") {
+			return data, &ErrorHttp{
+				StatusCode: http.StatusUnsupportedMediaType,
+				Message:    fmt.Sprintf("%s request returned unexpected content type: got %v want application/json", method, contentType),
+			}
+		}
+	}
+
+	// 2xx -> success
+	if response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices {
+		if len(body) > 0 || bodyRequired {
+			if err := json.Unmarshal(body, &data); err != nil {
+				return data, &ErrorHttp{
+					StatusCode: http.StatusInternalServerError,
+					Message:    fmt.Sprintf("failed to unmarshal response body json: %v", err),
+				}
+			}
+		}
+		return data, nil
+	}
+
+	e := ErrorHttp{
+		StatusCode: response.StatusCode,
+		Message:    http.StatusText(response.StatusCode),
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &e); err != nil {
+			return data, &ErrorHttp{
+				StatusCode: http.StatusInternalServerError,
+				Message:    fmt.Sprintf("failed to unmarshal response body json: %v", err),
+			}
+		}
+	}
+
+	// the retry middleware only returns a retryable status once retries are exhausted
+	if isRetryableStatus(response.StatusCode) {
+		logger.Error("retries exhausted",
+			slog.Int("status_code", e.StatusCode),
+			slog.String("err", e.Message),
+		)
+		return data, &ErrorHttp{
+			StatusCode: response.StatusCode,
+			Message:    fmt.Sprintf("retries exhausted: %s", e.Message),
+		}
+	}
+
+	// 4xx (and 500) errors -> non-retryable
+	return data, &e
+}
@@ -0,0 +1,556 @@
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mockTlsClient replays the responses, one per request attempt, repeating the last.
+type mockTlsClient struct {
+	responses []func() (*http.Response, error)
+	calls     atomic.Int32
+	requests  []*http.Request
+	bodies    []string
+}
+
+func (m *mockTlsClient) Do(req *http.Request) (*http.Response, error) {
+	i := int(m.calls.Add(1)) - 1
+
+	body, _ := io.ReadAll(req.Body)
+	m.requests = append(m.requests, req)
+	m.bodies = append(m.bodies, string(body))
+
+	return m.responses[min(i, len(m.responses)-1)]()
+}
+
+var _ TlsClient = (*mockTlsClient)(nil)
+
+// timeoutErr implements net.Error as a timeout.
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+// respond builds a mock response with the status, content type, and body.
+func respond(status int, contentType, body string) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		h := http.Header{}
+		if contentType != "" {
+			h.Set("Content-Type", contentType)
+		}
+		return &http.Response{StatusCode: status, Header: h, Body: io.NopCloser(strings.NewReader(body))}, nil
+	}
+}
+
+func fail(err error) func() (*http.Response, error) {
+	return func() (*http.Response, error) { return nil, err }
+}
+
+type testCmd struct {
+	Name string `json:"name"`
+}
+
+type testResp struct {
+	Id string `json:"id"`
+}
+
+func TestDo(t *testing.T) {
+
+	const appJson = "application/json"
+
+	tests := []struct {
+		name       string
+		method     string
+		responses  []func() (*http.Response, error)
+		want       testResp
+		wantStatus int    // 0 if no error
+		wantMsg    string // substring of the error message
+		wantCalls  int32
+	}{
+		{
+			name:      "get_success",
+			method:    http.MethodGet,
+			responses: []func() (*http.Response, error){respond(http.StatusOK, appJson, `{"id":"1"}`)},
+			want:      testResp{Id: "1"},
+			wantCalls: 1,
+		},
+		{
+			name:      "post_created_without_body",
+			method:    http.MethodPost,
+			responses: []func() (*http.Response, error){respond(http.StatusCreated, "", "")},
+			wantCalls: 1,
+		},
+		{
+			// GET keeps the checks GetServiceData always made
+			name:       "get_success_without_body",
+			method:     http.MethodGet,
+			responses:  []func() (*http.Response, error){respond(http.StatusOK, appJson, "")},
+			wantStatus: http.StatusInternalServerError,
+			wantMsg:    "failed to unmarshal response body json",
+			wantCalls:  1,
+		},
+		{
+			name:       "get_without_content_type",
+			method:     http.MethodGet,
+			responses:  []func() (*http.Response, error){respond(http.StatusNoContent, "", "")},
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantMsg:    "GET request returned unexpected content type",
+			wantCalls:  1,
+		},
+		{
+			name:      "delete_no_content",
+			method:    http.MethodDelete,
+			responses: []func() (*http.Response, error){respond(http.StatusNoContent, "", "")},
+			wantCalls: 1,
+		},
+		{
+			name:   "retry_then_success",
+			method: http.MethodPut,
+			responses: []func() (*http.Response, error){
+				respond(http.StatusBadGateway, appJson, `{"code":502,"message":"bad gateway"}`),
+				respond(http.StatusOK, appJson, `{"id":"2"}`),
+			},
+			want:      testResp{Id: "2"},
+			wantCalls: 2,
+		},
+		{
+			name:       "retries_exhausted",
+			method:     http.MethodPatch,
+			responses:  []func() (*http.Response, error){respond(http.StatusServiceUnavailable, appJson, `{"code":503,"message":"down"}`)},
+			wantStatus: http.StatusServiceUnavailable,
+			wantMsg:    "retries exhausted: down",
+			wantCalls:  3,
+		},
+		{
+			name:       "internal_server_error_not_retried",
+			method:     http.MethodGet,
+			responses:  []func() (*http.Response, error){respond(http.StatusInternalServerError, appJson, `{"code":500,"message":"boom"}`)},
+			wantStatus: http.StatusInternalServerError,
+			wantMsg:    "boom",
+			wantCalls:  1,
+		},
+		{
+			name:       "client_error_not_retried",
+			method:     http.MethodPost,
+			responses:  []func() (*http.Response, error){respond(http.StatusNotFound, appJson, `{"code":404,"message":"no such album"}`)},
+			wantStatus: http.StatusNotFound,
+			wantMsg:    "no such album",
+			wantCalls:  1,
+		},
+		{
+			name:       "client_error_without_body",
+			method:     http.MethodDelete,
+			responses:  []func() (*http.Response, error){respond(http.StatusNotFound, "", "")},
+			wantStatus: http.StatusNotFound,
+			wantMsg:    "Not Found",
+			wantCalls:  1,
+		},
+		{
+			// the timeout branches used to dereference a nil response
+			name:       "timeouts_retried_then_exhausted",
+			method:     http.MethodGet,
+			responses:  []func() (*http.Response, error){fail(timeoutErr{})},
+			wantStatus: http.StatusServiceUnavailable,
+			wantMsg:    "retries exhausted: timeout",
+			wantCalls:  3,
+		},
+		{
+			name:   "timeout_then_success",
+			method: http.MethodPost,
+			responses: []func() (*http.Response, error){
+				fail(timeoutErr{}),
+				respond(http.StatusCreated, appJson, `{"id":"3"}`),
+			},
+			want:      testResp{Id: "3"},
+			wantCalls: 2,
+		},
+		{
+			name:       "connection_error_not_retried",
+			method:     http.MethodPost,
+			responses:  []func() (*http.Response, error){fail(errors.New("connection refused"))},
+			wantStatus: http.StatusServiceUnavailable,
+			wantMsg:    "service unavailable",
+			wantCalls:  1,
+		},
+		{
+			name:       "unexpected_content_type",
+			method:     http.MethodGet,
+			responses:  []func() (*http.Response, error){respond(http.StatusOK, "text/html", "<html></html>")},
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantMsg:    "GET request returned unexpected content type",
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockTlsClient{responses: tt.responses}
+			caller := NewS2sCaller("https://gallery.test", "gallery", client, RetryConfiguration{
+				MaxRetries:  2,
+				BaseBackoff: time.Millisecond,
+				MaxBackoff:  time.Millisecond,
+			})
+
+			var body *testCmd
+			if tt.method != http.MethodGet && tt.method != http.MethodDelete {
+				body = &testCmd{Name: "album"}
+			}
+
+			got, err := Do[testCmd, testResp](context.Background(), caller, tt.method, "/albums", "s2s-token", "user-token", body)
+
+			if client.calls.Load() != tt.wantCalls {
+				t.Errorf("attempts: want %d, got %d", tt.wantCalls, client.calls.Load())
+			}
+
+			if tt.wantStatus != 0 {
+				var e *ErrorHttp
+				if !errors.As(err, &e) {
+					t.Fatalf("expected *ErrorHttp, got %v", err)
+				}
+				if e.StatusCode != tt.wantStatus || !strings.Contains(e.Message, tt.wantMsg) {
+					t.Errorf("error: want %d containing %q, got %d %q", tt.wantStatus, tt.wantMsg, e.StatusCode, e.Message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("response: want %+v, got %+v", tt.want, got)
+			}
+
+			// every attempt carries the headers and the full body
+			for i, req := range client.requests {
+				if req.Method != tt.method || req.URL.String() != "https://gallery.test/albums" {
+					t.Errorf("attempt %d: unexpected request %s %s", i, req.Method, req.URL)
+				}
+				if req.Header.Get("Service-Authorization") != "Bearer s2s-token" || req.Header.Get("Authorization") != "Bearer user-token" {
+					t.Errorf("attempt %d: missing authorization headers: %v", i, req.Header)
+				}
+				if body != nil && client.bodies[i] != `{"name":"album"}` {
+					t.Errorf("attempt %d: body: got %q", i, client.bodies[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDo_Middleware(t *testing.T) {
+
+	var order []string
+	trace := func(name string) S2sMiddleware {
+		return func(next S2sHandler) S2sHandler {
+			return func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next(req)
+			}
+		}
+	}
+
+	client := &mockTlsClient{responses: []func() (*http.Response, error){
+		respond(http.StatusTooManyRequests, "application/json", `{"code":429,"message":"slow down"}`),
+		respond(http.StatusOK, "application/json", `{"id":"1"}`),
+	}}
+	caller := NewS2sCaller("https://gallery.test", "gallery", client,
+		RetryConfiguration{MaxRetries: 1, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		WithMiddleware(trace("first"), trace("second")),
+	)
+
+	if _, err := GetServiceData[testResp](context.Background(), caller, "/albums", "s2s-token", ""); err != nil {
+		t.Fatalf("GetServiceData() error: %v", err)
+	}
+
+	// middleware runs in order, once per attempt
+	if got := strings.Join(order, ","); got != "first,second,first,second" {
+		t.Errorf("middleware order: want first,second,first,second, got %s", got)
+	}
+
+	// a middleware error fails the call without sending the request, and is returned as is
+	reject := func(next S2sHandler) S2sHandler {
+		return func(req *http.Request) (*http.Response, error) {
+			return nil, &ErrorHttp{StatusCode: http.StatusServiceUnavailable, Message: "circuit open"}
+		}
+	}
+	client = &mockTlsClient{responses: []func() (*http.Response, error){respond(http.StatusOK, "application/json", `{}`)}}
+	caller = NewS2sCaller("https://gallery.test", "gallery", client, RetryConfiguration{MaxRetries: 2}, WithMiddleware(reject))
+
+	_, err := PostToService[testCmd, testResp](context.Background(), caller, "/albums", "s2s-token", "", testCmd{Name: "album"})
+	var e *ErrorHttp
+	if !errors.As(err, &e) || e.Message != "circuit open" {
+		t.Fatalf("expected middleware error, got %v", err)
+	}
+	if client.calls.Load() != 0 {
+		t.Errorf("expected no request to be sent, got %d", client.calls.Load())
+	}
+}
+
+func TestWriteHelpers_Attempts(t *testing.T) {
+
+	badGateway := respond(http.StatusBadGateway, "application/json", `{"code":502,"message":"bad gateway"}`)
+
+	calls := map[string]func(ctx context.Context, caller *S2sCaller) error{
+		http.MethodPost: func(ctx context.Context, caller *S2sCaller) error {
+			_, err := PostToService[testCmd, testResp](ctx, caller, "/albums", "s2s-token", "", testCmd{Name: "album"})
+			return err
+		},
+		http.MethodPut: func(ctx context.Context, caller *S2sCaller) error {
+			_, err := PutToService[testCmd, testResp](ctx, caller, "/albums/1", "s2s-token", "", testCmd{Name: "album"})
+			return err
+		},
+		http.MethodPatch: func(ctx context.Context, caller *S2sCaller) error {
+			_, err := PatchToService[testCmd, testResp](ctx, caller, "/albums/1", "s2s-token", "", testCmd{Name: "album"})
+			return err
+		},
+		http.MethodDelete: func(ctx context.Context, caller *S2sCaller) error {
+			_, err := DeleteFromService[testResp](ctx, *caller, "/albums/1", "s2s-token", "")
+			return err
+		},
+	}
+
+	tests := []struct {
+		name       string
+		maxRetries int
+		responses  []func() (*http.Response, error)
+		wantStatus int
+		wantCalls  int32
+	}{
+		{name: "max_retries_attempts", maxRetries: 3, responses: []func() (*http.Response, error){badGateway}, wantStatus: http.StatusBadGateway, wantCalls: 3},
+		{name: "one_attempt_for_one", maxRetries: 1, responses: []func() (*http.Response, error){badGateway}, wantStatus: http.StatusBadGateway, wantCalls: 1},
+		{name: "one_attempt_for_zero", maxRetries: 0, responses: []func() (*http.Response, error){badGateway}, wantStatus: http.StatusBadGateway, wantCalls: 1},
+		{name: "transport_error_unavailable", maxRetries: 3, responses: []func() (*http.Response, error){fail(errors.New("connection refused"))}, wantStatus: http.StatusServiceUnavailable, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		for method, call := range calls {
+			t.Run(tt.name+"_"+strings.ToLower(method), func(t *testing.T) {
+				client := &mockTlsClient{responses: tt.responses}
+				caller := NewS2sCaller("https://gallery.test", "gallery", client, RetryConfiguration{
+					MaxRetries:  tt.maxRetries,
+					BaseBackoff: time.Millisecond,
+					MaxBackoff:  time.Millisecond,
+				})
+
+				err := call(context.Background(), caller)
+
+				var e *ErrorHttp
+				if !errors.As(err, &e) || e.StatusCode != tt.wantStatus {
+					t.Fatalf("error: want %d, got %v", tt.wantStatus, err)
+				}
+				if client.calls.Load() != tt.wantCalls {
+					t.Errorf("attempts: want %d, got %d", tt.wantCalls, client.calls.Load())
+				}
+
+				// the caller's configuration is not changed
+				if caller.RetryConfig.MaxRetries != tt.maxRetries {
+					t.Errorf("max retries: want %d, got %d", tt.maxRetries, caller.RetryConfig.MaxRetries)
+				}
+			})
+		}
+	}
+}
+
+func TestDo_NoBodyForDelete(t *testing.T) {
+
+	client := &mockTlsClient{responses: []func() (*http.Response, error){respond(http.StatusOK, "application/json", `{"id":"1"}`)}}
+	caller := NewS2sCaller("https://gallery.test", "gallery", client, RetryConfiguration{})
+
+	if _, err := DeleteFromService[testResp](context.Background(), *caller, "/albums/1", "s2s-token", ""); err != nil {
+		t.Fatalf("DeleteFromService() error: %v", err)
+	}
+	if client.bodies[0] != "" {
+		t.Errorf("expected no request body, got %q", client.bodies[0])
+	}
+}
+
+func TestDo_Context(t *testing.T) {
+
+	retryConfig := RetryConfiguration{MaxRetries: 3, BaseBackoff: time.Hour, MaxBackoff: time.Hour}
+	unavailable := respond(http.StatusServiceUnavailable, "application/json", `{"code":503,"message":"down"}`)
+
+	t.Run("cancelled_during_backoff", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		client := &mockTlsClient{responses: []func() (*http.Response, error){
+			func() (*http.Response, error) {
+				time.AfterFunc(10*time.Millisecond, cancel)
+				return unavailable()
+			},
+		}}
+		caller := NewS2sCaller("https://gallery.test", "gallery", client, retryConfig)
+
+		start := time.Now()
+		_, err := GetServiceData[testResp](ctx, caller, "/albums", "s2s-token", "")
+		var e *ErrorHttp
+		if !errors.As(err, &e) || e.Message != "request cancelled" {
+			t.Fatalf("expected request cancelled error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("backoff was not interrupted, took %v", elapsed)
+		}
+		if client.calls.Load() != 1 {
+			t.Errorf("attempts: want 1, got %d", client.calls.Load())
+		}
+		if client.requests[0].Context() != ctx {
+			t.Error("request is not bound to the context")
+		}
+	})
+
+	t.Run("backoff_exceeds_deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		client := &mockTlsClient{responses: []func() (*http.Response, error){unavailable}}
+		caller := NewS2sCaller("https://gallery.test", "gallery", client, retryConfig)
+
+		_, err := GetServiceData[testResp](ctx, caller, "/albums", "s2s-token", "")
+		var e *ErrorHttp
+		if !errors.As(err, &e) || e.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected the last 503 to be returned, got %v", err)
+		}
+		if client.calls.Load() != 1 {
+			t.Errorf("attempts: want 1, got %d", client.calls.Load())
+		}
+	})
+
+	t.Run("deadline_exceeded_is_gateway_timeout", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+
+		client := &mockTlsClient{responses: []func() (*http.Response, error){
+			fail(&url.Error{Op: "Get", URL: "https://gallery.test/albums", Err: context.DeadlineExceeded}),
+		}}
+		caller := NewS2sCaller("https://gallery.test", "gallery", client, retryConfig)
+
+		_, err := GetServiceData[testResp](ctx, caller, "/albums", "s2s-token", "")
+		var e *ErrorHttp
+		if !errors.As(err, &e) || e.StatusCode != http.StatusGatewayTimeout {
+			t.Fatalf("expected 504, got %v", err)
+		}
+		if client.calls.Load() != 1 {
+			t.Errorf("attempts: want 1, got %d", client.calls.Load())
+		}
+	})
+
+	t.Run("retry_after_exceeds_max_backoff", func(t *testing.T) {
+		client := &mockTlsClient{responses: []func() (*http.Response, error){
+			func() (*http.Response, error) {
+				r, _ := respond(http.StatusTooManyRequests, "application/json", `{"code":429,"message":"slow down"}`)()
+				r.Header.Set("Retry-After", "120")
+				return r, nil
+			},
+		}}
+		caller := NewS2sCaller("https://gallery.test", "gallery", client,
+			RetryConfiguration{MaxRetries: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Minute})
+
+		_, err := GetServiceData[testResp](context.Background(), caller, "/albums", "s2s-token", "")
+		var e *ErrorHttp
+		if !errors.As(err, &e) || e.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("expected the 429 to be returned, got %v", err)
+		}
+		if client.calls.Load() != 1 {
+			t.Errorf("attempts: want 1, got %d", client.calls.Load())
+		}
+	})
+}
+
+func TestDo_IdempotencyKey(t *testing.T) {
+
+	retryConfig := RetryConfiguration{MaxRetries: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	tests := []struct {
+		name    string
+		method  string
+		ctxKey  string
+		wantKey bool
+	}{
+		{name: "post_generated", method: http.MethodPost, wantKey: true},
+		{name: "patch_generated", method: http.MethodPatch, wantKey: true},
+		{name: "post_from_context", method: http.MethodPost, ctxKey: "order-123", wantKey: true},
+		{name: "put_none", method: http.MethodPut},
+		{name: "get_none", method: http.MethodGet, ctxKey: "order-123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockTlsClient{responses: []func() (*http.Response, error){
+				respond(http.StatusBadGateway, "application/json", `{"code":502,"message":"bad gateway"}`),
+				respond(http.StatusOK, "application/json", `{"id":"1"}`),
+			}}
+			caller := NewS2sCaller("https://gallery.test", "gallery", client, retryConfig)
+
+			ctx := context.Background()
+			if tt.ctxKey != "" {
+				ctx = WithIdempotencyKey(ctx, tt.ctxKey)
+			}
+
+			if _, err := Do[testCmd, testResp](ctx, caller, tt.method, "/albums", "s2s-token", "", &testCmd{Name: "summer"}); err != nil {
+				t.Fatalf("Do() error: %v", err)
+			}
+			if len(client.requests) != 2 {
+				t.Fatalf("attempts: want 2, got %d", len(client.requests))
+			}
+
+			first := client.requests[0].Header.Get(IdempotencyKeyHeader)
+			if !tt.wantKey {
+				if first != "" {
+					t.Errorf("expected no %s header, got %q", IdempotencyKeyHeader, first)
+				}
+				return
+			}
+
+			if first == "" {
+				t.Fatalf("expected %s header", IdempotencyKeyHeader)
+			}
+			if tt.ctxKey != "" && first != tt.ctxKey {
+				t.Errorf("key: want %q, got %q", tt.ctxKey, first)
+			}
+			if retried := client.requests[1].Header.Get(IdempotencyKeyHeader); retried != first {
+				t.Errorf("key changed on retry: %q then %q", first, retried)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		status int
+		header string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "seconds", status: http.StatusTooManyRequests, header: "30", want: 30 * time.Second, wantOk: true},
+		{name: "http_date", status: http.StatusServiceUnavailable, header: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute, wantOk: true},
+		{name: "http_date_in_past", status: http.StatusServiceUnavailable, header: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, wantOk: true},
+		{name: "missing", status: http.StatusTooManyRequests},
+		{name: "negative", status: http.StatusTooManyRequests, header: "-1"},
+		{name: "invalid", status: http.StatusTooManyRequests, header: "soon"},
+		{name: "ignored_for_bad_gateway", status: http.StatusBadGateway, header: "30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.header != "" {
+				r.Header.Set("Retry-After", tt.header)
+			}
+
+			got, ok := retryAfter(r, now)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("retryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
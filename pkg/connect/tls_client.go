@@ -139,15 +139,22 @@ func NewTlsClient(config TlsClientConfig, opts ...TlsClientOption) (TlsClient, e
 		idleConnTimeout = 90 * time.Second
 	}
 
-	c.httpClient = &http.Client{
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	transport := &http.Transport{
+		TLSClientConfig:       tlsConfig,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		IdleConnTimeout:       idleConnTimeout,
+	}
 
-		Transport: &http.Transport{
-			TLSClientConfig:       tlsConfig,
-			DialContext:           (&net.Dialer{Timeout: dialTimeout}).DialContext,
-			TLSHandshakeTimeout:   tlsHandshakeTimeout,
-			ResponseHeaderTimeout: responseHeaderTimeout,
-			IdleConnTimeout:       idleConnTimeout,
-		},
+	// reloading configs verify the server in the handshake, so they need the dialed host, see pki_reloader.go
+	if reloading, ok := config.(*reloadingTlsClientConfig); ok {
+		transport.DialTLSContext = reloading.dialTLSContext(dialer, tlsHandshakeTimeout)
+	}
+
+	c.httpClient = &http.Client{
+		Transport: transport,
 	}
 
 	return c, nil
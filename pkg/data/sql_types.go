@@ -50,6 +50,10 @@ func (ct *CustomTime) Scan(value interface{}) error {
 		}
 	case time.Time:
 		t = v
+	case nil:
+		// NULL, ie, the zero time written by Value
+		ct.Time = time.Time{}
+		return nil
 	default:
 		return errors.New("unsupported data type")
 	}
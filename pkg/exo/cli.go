@@ -8,6 +8,7 @@ import (
 
 	"github.com/tdeslauriers/carapace/internal/util"
 	"github.com/tdeslauriers/carapace/pkg/data"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
 	"github.com/tdeslauriers/carapace/pkg/sign"
 )
 
@@ -81,10 +82,15 @@ func Parse() (*Config, error) {
 	flag.StringVar(blindIndex, "bi", "", blindIndexMsg)
 
 	// jwt signing key pair
-	keyPairMsg := "invokes ecdsa jwt signing key pair generation"
+	keyPairMsg := "invokes jwt signing key pair generation"
 	keyPair := flag.Bool("key-pair", false, keyPairMsg)
 	flag.BoolVar(keyPair, "k", false, keyPairMsg)
 
+	// jwt signing key pair algorithm
+	keyAlgMsg := "jwt signing algorithm of the key pair: ES512, ES256, or EdDSA, defaults to ES512 if not set"
+	keyAlg := flag.String("alg", jwt.ES512, keyAlgMsg)
+	flag.StringVar(keyAlg, "a", jwt.ES512, keyAlgMsg)
+
 	// environment
 	envMsg := "applies environment tag/instruction to applicable fields in exo commands"
 	env := flag.String("env", "", envMsg)
@@ -107,6 +113,7 @@ func Parse() (*Config, error) {
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fmt.Fprintf(os.Stderr, "  -c,   --certs       %s\n", certMsg)
 		fmt.Fprintf(os.Stderr, "  -k,   --key-pair    %s\n", keyPairMsg)
+		fmt.Fprintf(os.Stderr, "  -a,   --alg         %s\n", keyAlgMsg)
 		fmt.Fprintf(os.Stderr, "  -sec, --secrets     %s\n", secretsMsg)
 		fmt.Fprintf(os.Stderr, "  -bl,  --byte-length %s\n", byteLengthMsg)
 		fmt.Fprintf(os.Stderr, "  -bi,  --blind-index %s\n", blindIndexMsg)
@@ -129,6 +136,7 @@ func Parse() (*Config, error) {
 		Secret:     *secrets,
 		BlindIndex: *blindIndex,
 		KeyPair:    *keyPair,
+		KeyAlg:     *keyAlg,
 		ByteLength: *byteLength,
 	}, nil
 }
@@ -1,13 +1,35 @@
 package exo
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+	"github.com/tdeslauriers/carapace/pkg/sign"
+)
 
 // keyPairExecution() is a helper function that executes the key pair generation process.
 func (e *exoskeleton) keyPairExecution() error {
 
-	// generate jwt key pair
-	if err := e.keyGen.GenerateEcdsaSigningKey(e.config.ServiceName, e.config.Env); err != nil {
-		return fmt.Errorf("failed to generate ecdsa keys: %v", err)
+	alg := e.config.KeyAlg
+	if alg == "" {
+		alg = jwt.ES512
+	}
+
+	// generate jwt key pair: algorithms other than ES512 require a SigningKeyGenerator
+	if alg == jwt.ES512 {
+		if err := e.keyGen.GenerateEcdsaSigningKey(e.config.ServiceName, e.config.Env); err != nil {
+			return fmt.Errorf("failed to generate %s keys: %v", alg, err)
+		}
+		return nil
+	}
+
+	kg, ok := e.keyGen.(sign.SigningKeyGenerator)
+	if !ok {
+		return fmt.Errorf("failed to generate %s keys: key generator only supports %s", alg, jwt.ES512)
+	}
+
+	if err := kg.GenerateSigningKey(e.config.ServiceName, e.config.Env, alg); err != nil {
+		return fmt.Errorf("failed to generate %s keys: %v", alg, err)
 	}
 
 	return nil
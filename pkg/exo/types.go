@@ -13,7 +13,8 @@ type Config struct {
 	Secret      string // name of secret to generate
 	BlindIndex  string // record field value to generate blind index for
 	KeyPair     bool
-	ByteLength  int // length of secret to generate; need to set defaults if not set
+	KeyAlg      string // jwt signing algorithm of the key pair to generate; defaults to ES512 if not set
+	ByteLength  int    // length of secret to generate; need to set defaults if not set
 }
 
 // Certs is a struct for the exo cli command to consume.
@@ -0,0 +1,237 @@
+package jwks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tdeslauriers/carapace/internal/util"
+	"github.com/tdeslauriers/carapace/pkg/connect"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+)
+
+const (
+	defaultRefreshInterval    = 15 * time.Minute
+	defaultMinRefreshInterval = 30 * time.Second
+	defaultFetchTimeout       = 10 * time.Second
+
+	// maxDocumentSize caps the size of a jwks or discovery document read from an issuer.
+	maxDocumentSize = 1 << 20
+)
+
+// Fetcher is an interface for a client-side cache of an issuer's json web key set.
+// It is a jwt.KeySource, so it can be passed to jwt.NewKeySourceVerifier: keys are refreshed periodically,
+// and when a token signed with an unknown key id is verified, so a rotated key is picked up without a redeploy.
+type Fetcher interface {
+	jwt.KeySource
+
+	// Refresh fetches the issuer's json web key set, replacing the cached keys.
+	// It can be called at startup so the first verification does not wait on the fetch.
+	Refresh(ctx context.Context) error
+}
+
+// FetcherOption is a functional option for configuring the Fetcher.
+type FetcherOption func(*fetcher)
+
+// WithRefreshInterval sets how long fetched keys are used before they are refreshed.  Defaults to 15 minutes.
+func WithRefreshInterval(d time.Duration) FetcherOption {
+	return func(f *fetcher) { f.refreshInterval = d }
+}
+
+// WithMinRefreshInterval sets the minimum time between fetches, so tokens with unknown key ids
+// cannot be used to flood the issuer with requests.  Defaults to 30 seconds.
+func WithMinRefreshInterval(d time.Duration) FetcherOption {
+	return func(f *fetcher) { f.minRefreshInterval = d }
+}
+
+// WithFetchTimeout sets the timeout of fetches made during verification.  Defaults to 10 seconds.
+func WithFetchTimeout(d time.Duration) FetcherOption {
+	return func(f *fetcher) { f.fetchTimeout = d }
+}
+
+// NewFetcher creates a new Fetcher interface with an underlying implementation
+// which fetches the json web key set at the jwks url with the client, eg, a connect.TlsClient.
+func NewFetcher(jwksUrl string, client connect.TlsClient, opts ...FetcherOption) Fetcher {
+
+	f := &fetcher{
+		url:                jwksUrl,
+		client:             client,
+		refreshInterval:    defaultRefreshInterval,
+		minRefreshInterval: defaultMinRefreshInterval,
+		fetchTimeout:       defaultFetchTimeout,
+
+		logger: slog.Default().
+			With(slog.String(util.FrameworkKey, util.FrameworkCarapace)).
+			With(slog.String(util.PackageKey, util.PackageJwks)).
+			With(slog.String(util.ComponentKey, util.ComponentJwksFetcher)),
+	}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+var _ Fetcher = (*fetcher)(nil)
+
+// fetcher is the concrete implementation of the Fetcher interface.
+type fetcher struct {
+	url                string
+	client             connect.TlsClient
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	fetchTimeout       time.Duration
+
+	fetchMu sync.Mutex // serializes fetches
+
+	mu          sync.RWMutex
+	keys        []jwt.VerifyingKey
+	fetchedAt   time.Time // last successful fetch
+	attemptedAt time.Time // last fetch, successful or not
+
+	logger *slog.Logger
+}
+
+// VerifyingKeys implements the jwt.KeySource interface.  Cached keys are returned if a refresh fails,
+// so a brief issuer outage does not fail every verification.
+func (f *fetcher) VerifyingKeys(kid string) ([]jwt.VerifyingKey, error) {
+
+	f.mu.RLock()
+	keys, fetchedAt, attemptedAt := f.keys, f.fetchedAt, f.attemptedAt
+	f.mu.RUnlock()
+
+	now := time.Now()
+	stale := len(keys) == 0 || now.Sub(fetchedAt) > f.refreshInterval
+	unknown := kid != "" && !hasKeyId(keys, kid)
+
+	if (stale || unknown) && now.Sub(attemptedAt) >= f.minRefreshInterval {
+
+		ctx, cancel := context.WithTimeout(context.Background(), f.fetchTimeout)
+		defer cancel()
+
+		if err := f.refresh(ctx, attemptedAt, false); err != nil {
+			f.logger.Error("failed to refresh jwks", slog.String("jwks_url", f.url), slog.String("err", err.Error()))
+		}
+
+		f.mu.RLock()
+		keys = f.keys
+		f.mu.RUnlock()
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no verifying keys available from %s", f.url)
+	}
+
+	return keys, nil
+}
+
+// Refresh implements the Fetcher interface.
+func (f *fetcher) Refresh(ctx context.Context) error {
+	return f.refresh(ctx, time.Time{}, true)
+}
+
+// refresh is a helper method which fetches the json web key set.  Unless forced, it does not fetch if another
+// fetch was attempted after the caller's last seen attempt, ie, concurrent callers share one fetch.
+func (f *fetcher) refresh(ctx context.Context, seenAttempt time.Time, force bool) error {
+
+	f.fetchMu.Lock()
+	defer f.fetchMu.Unlock()
+
+	f.mu.RLock()
+	attemptedAt := f.attemptedAt
+	f.mu.RUnlock()
+
+	if !force && attemptedAt.After(seenAttempt) {
+		return nil
+	}
+
+	f.mu.Lock()
+	f.attemptedAt = time.Now()
+	f.mu.Unlock()
+
+	var set jwt.JWKSet
+	if err := getJson(ctx, f.client, f.url, &set); err != nil {
+		return fmt.Errorf("failed to fetch jwks: %v", err)
+	}
+
+	keys, err := set.VerifyingKeys()
+	if err != nil {
+		return fmt.Errorf("invalid jwks from %s: %v", f.url, err)
+	}
+
+	f.mu.Lock()
+	f.keys = keys
+	f.fetchedAt = time.Now()
+	f.mu.Unlock()
+
+	return nil
+}
+
+// DiscoverJwksUri fetches an issuer's OpenID Connect discovery document and returns its jwks uri.
+// The document's issuer must match the issuer url exactly, as OpenID Connect Discovery requires.
+func DiscoverJwksUri(ctx context.Context, client connect.TlsClient, issuer string) (string, error) {
+
+	var doc Discovery
+	if err := getJson(ctx, client, strings.TrimSuffix(issuer, "/")+DiscoveryPath, &doc); err != nil {
+		return "", fmt.Errorf("failed to fetch discovery document: %v", err)
+	}
+
+	if doc.Issuer != issuer {
+		return "", fmt.Errorf("discovery document issuer %q does not match issuer %q", doc.Issuer, issuer)
+	}
+
+	if doc.JwksUri == "" {
+		return "", fmt.Errorf("discovery document for issuer %q has no jwks uri", issuer)
+	}
+
+	return doc.JwksUri, nil
+}
+
+// getJson is a helper function which GETs a json document and unmarshals it into v.
+func getJson(ctx context.Context, client connect.TlsClient, url string, v any) error {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %v", url, err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response body from %s: %v", url, err)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to unmarshal json response from %s: %v", url, err)
+	}
+
+	return nil
+}
+
+// hasKeyId is a helper function which reports whether a key with the key id, or with no key id, is in the keys.
+func hasKeyId(keys []jwt.VerifyingKey, kid string) bool {
+	for _, k := range keys {
+		if k.KeyId == "" || k.KeyId == kid {
+			return true
+		}
+	}
+	return false
+}
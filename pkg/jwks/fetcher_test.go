@@ -0,0 +1,234 @@
+package jwks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+)
+
+// testServer serves the handler's jwks and discovery documents, counting jwks requests.
+// The jwks endpoint returns 503 while down is set.
+func testServer(t *testing.T, h Handler) (*httptest.Server, *atomic.Int32, *atomic.Bool) {
+	t.Helper()
+
+	var hits atomic.Int32
+	var down atomic.Bool
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(JwksPath, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		h.HandleJwks(w, r)
+	})
+	mux.HandleFunc(DiscoveryPath, h.HandleDiscovery)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv, &hits, &down
+}
+
+// mintToken signs a token for the audience with the signer, using the verifying key's alg, failing the test on error.
+func mintToken(t *testing.T, key jwt.VerifyingKey, signer jwt.Signer, aud string) string {
+	t.Helper()
+	now := time.Now().UTC()
+	tok := &jwt.Token{
+		Header: jwt.Header{Alg: key.Alg, Typ: jwt.TokenType},
+		Claims: jwt.Claims{
+			Issuer:   testDiscovery.Issuer,
+			Subject:  "user@example.com",
+			Audience: []string{aud},
+			IssuedAt: now.Unix(),
+			Expires:  now.Add(time.Hour).Unix(),
+			Scopes:   "r:service-a:*",
+		},
+	}
+	if err := signer.Mint(tok); err != nil {
+		t.Fatalf("failed to mint token: %v", err)
+	}
+	return tok.Raw
+}
+
+func TestFetcher_KeyRotation(t *testing.T) {
+
+	k1, priv1 := testKey(t, "k1")
+	k1.Alg = jwt.EdDSA
+	k2, priv2 := testKey(t, "k2")
+	k2.Alg = jwt.EdDSA
+
+	h, err := NewHandler(testDiscovery, []jwt.VerifyingKey{k1})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+	srv, hits, _ := testServer(t, h)
+
+	f := NewFetcher(srv.URL+JwksPath, srv.Client(), WithMinRefreshInterval(0))
+	v, err := jwt.NewKeySourceVerifier("service-a", f)
+	if err != nil {
+		t.Fatalf("NewKeySourceVerifier() error: %v", err)
+	}
+
+	raw1 := mintToken(t, k1, jwt.NewSigner(priv1, jwt.WithKeyId("k1")), "service-a")
+	if _, err := v.BuildAuthorized([]string{"r:service-a:album"}, raw1); err != nil {
+		t.Fatalf("token signed with k1: unexpected error: %v", err)
+	}
+
+	// cached: a second verification does not fetch
+	if _, err := v.BuildAuthorized([]string{"r:service-a:album"}, raw1); err != nil {
+		t.Fatalf("token signed with k1: unexpected error: %v", err)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("jwks fetches = %d, want 1", got)
+	}
+
+	// rotate: the issuer publishes k2, so a token with the unknown kid triggers a refresh
+	if err := h.SetKeys([]jwt.VerifyingKey{k1, k2}); err != nil {
+		t.Fatalf("SetKeys() error: %v", err)
+	}
+
+	raw2 := mintToken(t, k2, jwt.NewSigner(priv2, jwt.WithKeyId("k2")), "service-a")
+	if _, err := v.BuildAuthorized([]string{"r:service-a:album"}, raw2); err != nil {
+		t.Fatalf("token signed with rotated k2: unexpected error: %v", err)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("jwks fetches = %d, want 2", got)
+	}
+}
+
+func TestFetcher_MinRefreshInterval(t *testing.T) {
+
+	k1, _ := testKey(t, "k1")
+
+	h, err := NewHandler(testDiscovery, []jwt.VerifyingKey{k1})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+	srv, hits, _ := testServer(t, h)
+
+	f := NewFetcher(srv.URL+JwksPath, srv.Client(), WithMinRefreshInterval(time.Hour))
+
+	// unknown key ids cannot force a fetch more often than the minimum refresh interval
+	for _, kid := range []string{"unknown-1", "unknown-2", "unknown-3"} {
+		if _, err := f.VerifyingKeys(kid); err != nil {
+			t.Fatalf("VerifyingKeys(%q) error: %v", kid, err)
+		}
+	}
+
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("jwks fetches = %d, want 1", got)
+	}
+}
+
+func TestFetcher_StaleKeysOnOutage(t *testing.T) {
+
+	k1, _ := testKey(t, "k1")
+
+	h, err := NewHandler(testDiscovery, []jwt.VerifyingKey{k1})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+	srv, _, down := testServer(t, h)
+
+	f := NewFetcher(srv.URL+JwksPath, srv.Client(), WithRefreshInterval(0), WithMinRefreshInterval(0))
+
+	if err := f.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error: %v", err)
+	}
+
+	down.Store(true)
+
+	if err := f.Refresh(context.Background()); err == nil {
+		t.Fatal("expected Refresh() error while issuer is down, got nil")
+	}
+
+	keys, err := f.VerifyingKeys("k1")
+	if err != nil {
+		t.Fatalf("VerifyingKeys() error: %v", err)
+	}
+	if len(keys) != 1 || keys[0].KeyId != "k1" {
+		t.Fatalf("keys = %+v, want cached kid %q", keys, "k1")
+	}
+}
+
+func TestFetcher_NoKeys(t *testing.T) {
+
+	k1, _ := testKey(t, "k1")
+
+	h, err := NewHandler(testDiscovery, []jwt.VerifyingKey{k1})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+	srv, _, down := testServer(t, h)
+	down.Store(true)
+
+	f := NewFetcher(srv.URL+JwksPath, srv.Client())
+
+	if _, err := f.VerifyingKeys("k1"); err == nil || !strings.Contains(err.Error(), "no verifying keys available") {
+		t.Fatalf("expected no verifying keys error, got %v", err)
+	}
+}
+
+func TestDiscoverJwksUri(t *testing.T) {
+
+	k1, _ := testKey(t, "k1")
+
+	tests := []struct {
+		name      string
+		issuer    func(srvUrl string) string
+		docIssuer func(srvUrl string) string
+		errSubstr string
+	}{
+		{
+			name:      "matching_issuer",
+			issuer:    func(u string) string { return u },
+			docIssuer: func(u string) string { return u },
+		},
+		{
+			name:      "mismatched_issuer",
+			issuer:    func(u string) string { return u },
+			docIssuer: func(u string) string { return "https://evil.example.com" },
+			errSubstr: "does not match issuer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// the handler needs the server url, so it is served through an indirection
+			var h Handler
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				h.HandleDiscovery(w, r)
+			}))
+			defer srv.Close()
+
+			var err error
+			h, err = NewHandler(Discovery{Issuer: tt.docIssuer(srv.URL), JwksUri: srv.URL + JwksPath}, []jwt.VerifyingKey{k1})
+			if err != nil {
+				t.Fatalf("NewHandler() error: %v", err)
+			}
+
+			uri, err := DiscoverJwksUri(context.Background(), srv.Client(), tt.issuer(srv.URL))
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %v", tt.errSubstr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if uri != srv.URL+JwksPath {
+				t.Errorf("jwks uri = %q, want %q", uri, srv.URL+JwksPath)
+			}
+		})
+	}
+}
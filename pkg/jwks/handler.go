@@ -0,0 +1,231 @@
+package jwks
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tdeslauriers/carapace/internal/util"
+	"github.com/tdeslauriers/carapace/pkg/connect"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+)
+
+const (
+	// JwksPath is the conventional path of an issuer's json web key set endpoint.
+	JwksPath string = "/.well-known/jwks.json"
+
+	// DiscoveryPath is the OpenID Connect discovery path, relative to the issuer url.
+	DiscoveryPath string = "/.well-known/openid-configuration"
+
+	// defaultCacheMaxAge is how long clients may cache the jwks and discovery documents.
+	defaultCacheMaxAge = 5 * time.Minute
+)
+
+// Discovery is the OpenID Connect provider metadata served at the discovery path.
+// Issuer and JwksUri are required; the endpoints are only published if the issuing service implements them.
+type Discovery struct {
+	Issuer                           string   `json:"issuer"`
+	JwksUri                          string   `json:"jwks_uri"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                    string   `json:"token_endpoint,omitempty"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint,omitempty"`
+	ResponseTypesSupported           []string `json:"response_types_supported,omitempty"`
+	SubjectTypesSupported            []string `json:"subject_types_supported,omitempty"`
+	IdTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	ScopesSupported                  []string `json:"scopes_supported,omitempty"`
+	ClaimsSupported                  []string `json:"claims_supported,omitempty"`
+}
+
+// Handler is an interface for the http handlers an issuing service uses to publish its verifying keys.
+type Handler interface {
+
+	// HandleJwks serves the json web key set of the currently trusted verifying keys.
+	// Keys past their NotAfter time are not published.
+	HandleJwks(w http.ResponseWriter, r *http.Request)
+
+	// HandleDiscovery serves the OpenID Connect discovery document.
+	// If no signing algs are configured, the algs of the published keys are listed.
+	HandleDiscovery(w http.ResponseWriter, r *http.Request)
+
+	// SetKeys replaces the published verifying keys, eg, when a signing key is rotated.
+	SetKeys(keys []jwt.VerifyingKey) error
+}
+
+// HandlerOption is a functional option for configuring the Handler.
+type HandlerOption func(*handler)
+
+// WithCacheMaxAge sets how long clients may cache the jwks and discovery documents.  Defaults to 5 minutes.
+func WithCacheMaxAge(maxAge time.Duration) HandlerOption {
+	return func(h *handler) { h.cacheMaxAge = maxAge }
+}
+
+// NewHandler creates a new Handler interface with an underlying implementation.
+// Every key must convert to a json web key, and must have a unique key id if more than one is provided.
+func NewHandler(discovery Discovery, keys []jwt.VerifyingKey, opts ...HandlerOption) (Handler, error) {
+
+	if discovery.Issuer == "" {
+		return nil, fmt.Errorf("discovery issuer is required")
+	}
+
+	if discovery.JwksUri == "" {
+		return nil, fmt.Errorf("discovery jwks uri is required")
+	}
+
+	h := &handler{
+		discovery:   discovery,
+		cacheMaxAge: defaultCacheMaxAge,
+
+		logger: slog.Default().
+			With(slog.String(util.FrameworkKey, util.FrameworkCarapace)).
+			With(slog.String(util.PackageKey, util.PackageJwks)).
+			With(slog.String(util.ComponentKey, util.ComponentJwksHandler)),
+	}
+
+	if err := h.SetKeys(keys); err != nil {
+		return nil, err
+	}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h, nil
+}
+
+var _ Handler = (*handler)(nil)
+
+// handler is the concrete implementation of the Handler interface.
+type handler struct {
+	discovery   Discovery
+	cacheMaxAge time.Duration
+
+	mu   sync.RWMutex
+	keys []publishedKey
+
+	logger *slog.Logger
+}
+
+// publishedKey is a verifying key converted to its json web key, with the time it is no longer trusted.
+type publishedKey struct {
+	jwk      jwt.JWK
+	notAfter time.Time
+}
+
+// SetKeys implements the Handler interface.
+func (h *handler) SetKeys(keys []jwt.VerifyingKey) error {
+
+	if len(keys) == 0 {
+		return fmt.Errorf("at least one verifying key is required")
+	}
+
+	published := make([]publishedKey, 0, len(keys))
+	seen := make(map[string]struct{}, len(keys))
+	for i, k := range keys {
+
+		if len(keys) > 1 && k.KeyId == "" {
+			return fmt.Errorf("verifying key at index %d is missing its key id: required when more than one key is provided", i)
+		}
+
+		if _, ok := seen[k.KeyId]; ok {
+			return fmt.Errorf("duplicate verifying key id %q", k.KeyId)
+		}
+		seen[k.KeyId] = struct{}{}
+
+		jwk, err := jwt.NewJWK(k)
+		if err != nil {
+			return fmt.Errorf("verifying key at index %d: %v", i, err)
+		}
+
+		published = append(published, publishedKey{jwk: jwk, notAfter: k.NotAfter})
+	}
+
+	h.mu.Lock()
+	h.keys = published
+	h.mu.Unlock()
+
+	return nil
+}
+
+// HandleJwks implements the Handler interface.
+func (h *handler) HandleJwks(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.logger.Error(fmt.Sprintf("only GET requests are allowed to %s", JwksPath))
+		e := connect.ErrorHttp{
+			StatusCode: http.StatusMethodNotAllowed,
+			Message:    "only GET requests are allowed",
+		}
+		e.SendJsonErr(w)
+		return
+	}
+
+	h.writeJson(w, jwt.JWKSet{Keys: h.currentKeys()})
+}
+
+// HandleDiscovery implements the Handler interface.
+func (h *handler) HandleDiscovery(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.logger.Error(fmt.Sprintf("only GET requests are allowed to %s", DiscoveryPath))
+		e := connect.ErrorHttp{
+			StatusCode: http.StatusMethodNotAllowed,
+			Message:    "only GET requests are allowed",
+		}
+		e.SendJsonErr(w)
+		return
+	}
+
+	doc := h.discovery
+	if len(doc.IdTokenSigningAlgValuesSupported) == 0 {
+		for _, k := range h.currentKeys() {
+			if !slices.Contains(doc.IdTokenSigningAlgValuesSupported, k.Alg) {
+				doc.IdTokenSigningAlgValuesSupported = append(doc.IdTokenSigningAlgValuesSupported, k.Alg)
+			}
+		}
+	}
+
+	h.writeJson(w, doc)
+}
+
+// currentKeys is a helper method which returns the json web keys which are still trusted.
+func (h *handler) currentKeys() []jwt.JWK {
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]jwt.JWK, 0, len(h.keys))
+	for _, k := range h.keys {
+		if !k.notAfter.IsZero() && now.After(k.notAfter) {
+			continue
+		}
+		keys = append(keys, k.jwk)
+	}
+
+	return keys
+}
+
+// writeJson is a helper method which writes a cacheable json response.
+func (h *handler) writeJson(w http.ResponseWriter, v any) {
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error("failed to marshal jwks response", slog.String("err", err.Error()))
+		e := connect.ErrorHttp{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "internal server error",
+		}
+		e.SendJsonErr(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.cacheMaxAge.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,196 @@
+package jwks
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+)
+
+// testDiscovery is a minimal valid discovery document for tests.
+var testDiscovery = Discovery{
+	Issuer:  "https://auth.example.com",
+	JwksUri: "https://auth.example.com" + JwksPath,
+}
+
+// testKey generates an ed25519 verifying key with the key id, failing the test on error.
+func testKey(t *testing.T, kid string) (jwt.VerifyingKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+	return jwt.VerifyingKey{KeyId: kid, PublicKey: pub}, priv
+}
+
+func TestNewHandler(t *testing.T) {
+
+	k1, _ := testKey(t, "k1")
+	noKid, _ := testKey(t, "")
+
+	tests := []struct {
+		name      string
+		discovery Discovery
+		keys      []jwt.VerifyingKey
+		errSubstr string
+	}{
+		{
+			name:      "valid",
+			discovery: testDiscovery,
+			keys:      []jwt.VerifyingKey{k1},
+		},
+		{
+			name:      "missing_issuer",
+			discovery: Discovery{JwksUri: testDiscovery.JwksUri},
+			keys:      []jwt.VerifyingKey{k1},
+			errSubstr: "issuer is required",
+		},
+		{
+			name:      "missing_jwks_uri",
+			discovery: Discovery{Issuer: testDiscovery.Issuer},
+			keys:      []jwt.VerifyingKey{k1},
+			errSubstr: "jwks uri is required",
+		},
+		{
+			name:      "no_keys",
+			discovery: testDiscovery,
+			errSubstr: "at least one verifying key",
+		},
+		{
+			name:      "missing_kid_in_key_set",
+			discovery: testDiscovery,
+			keys:      []jwt.VerifyingKey{k1, noKid},
+			errSubstr: "missing its key id",
+		},
+		{
+			name:      "duplicate_kid",
+			discovery: testDiscovery,
+			keys:      []jwt.VerifyingKey{k1, k1},
+			errSubstr: "duplicate verifying key id",
+		},
+		{
+			name:      "unsupported_key",
+			discovery: testDiscovery,
+			keys:      []jwt.VerifyingKey{{KeyId: "k", PublicKey: "not a key"}},
+			errSubstr: "verifying key at index 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHandler(tt.discovery, tt.keys)
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %v", tt.errSubstr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestHandleJwks(t *testing.T) {
+
+	current, _ := testKey(t, "current")
+	retired, _ := testKey(t, "retired")
+	retired.NotAfter = time.Now().Add(-time.Minute)
+
+	h, err := NewHandler(testDiscovery, []jwt.VerifyingKey{current, retired}, WithCacheMaxAge(time.Minute))
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	t.Run("publishes_current_keys", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.HandleJwks(rec, httptest.NewRequest(http.MethodGet, JwksPath, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status: want %d, got %d", http.StatusOK, rec.Code)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != "public, max-age=60" {
+			t.Errorf("Cache-Control = %q, want %q", got, "public, max-age=60")
+		}
+
+		var set jwt.JWKSet
+		if err := json.NewDecoder(rec.Body).Decode(&set); err != nil {
+			t.Fatalf("failed to decode jwks: %v", err)
+		}
+		if len(set.Keys) != 1 || set.Keys[0].Kid != "current" {
+			t.Fatalf("jwks keys = %+v, want only kid %q", set.Keys, "current")
+		}
+		if set.Keys[0].Kty != jwt.KtyOkp || set.Keys[0].Alg != jwt.EdDSA {
+			t.Errorf("jwk kty/alg = %q/%q, want %q/%q", set.Keys[0].Kty, set.Keys[0].Alg, jwt.KtyOkp, jwt.EdDSA)
+		}
+	})
+
+	t.Run("method_not_allowed", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.HandleJwks(rec, httptest.NewRequest(http.MethodPost, JwksPath, nil))
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("status: want %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+		}
+	})
+}
+
+func TestHandleDiscovery(t *testing.T) {
+
+	key, _ := testKey(t, "k1")
+
+	tests := []struct {
+		name      string
+		discovery Discovery
+		wantAlgs  []string
+	}{
+		{
+			name:      "algs_from_keys",
+			discovery: testDiscovery,
+			wantAlgs:  []string{jwt.EdDSA},
+		},
+		{
+			name: "configured_algs",
+			discovery: Discovery{
+				Issuer:                           testDiscovery.Issuer,
+				JwksUri:                          testDiscovery.JwksUri,
+				IdTokenSigningAlgValuesSupported: []string{jwt.ES512},
+			},
+			wantAlgs: []string{jwt.ES512},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHandler(tt.discovery, []jwt.VerifyingKey{key})
+			if err != nil {
+				t.Fatalf("NewHandler() error: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			h.HandleDiscovery(rec, httptest.NewRequest(http.MethodGet, DiscoveryPath, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status: want %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var doc Discovery
+			if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+				t.Fatalf("failed to decode discovery document: %v", err)
+			}
+			if doc.Issuer != tt.discovery.Issuer || doc.JwksUri != tt.discovery.JwksUri {
+				t.Errorf("issuer/jwks_uri = %q/%q, want %q/%q", doc.Issuer, doc.JwksUri, tt.discovery.Issuer, tt.discovery.JwksUri)
+			}
+			if strings.Join(doc.IdTokenSigningAlgValuesSupported, ",") != strings.Join(tt.wantAlgs, ",") {
+				t.Errorf("signing algs = %v, want %v", doc.IdTokenSigningAlgValuesSupported, tt.wantAlgs)
+			}
+		})
+	}
+}
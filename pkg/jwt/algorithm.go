@@ -0,0 +1,245 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+const (
+	ES256 string = "ES256" // alg: ecdsa P-256 with sha256
+	EdDSA string = "EdDSA" // alg: ed25519
+
+	// algNone is the unsigned jwt alg value, which can never be registered.
+	algNone string = "none"
+)
+
+// Algorithm is a jwt signing algorithm, identified by its header alg value.
+// Each algorithm is bound to a single key type: a token's alg must match the key verifying it.
+type Algorithm interface {
+
+	// Name returns the jwt header alg value, eg, "ES512".
+	Name() string
+
+	// Supports reports whether the private or public key is the key type and curve of this algorithm.
+	Supports(key any) bool
+
+	// Sign creates a raw jwt signature over the message with the private key.
+	Sign(key crypto.Signer, msg []byte) ([]byte, error)
+
+	// Verify checks a raw jwt signature over the message with the public key.
+	Verify(key crypto.PublicKey, msg, sig []byte) error
+}
+
+var (
+	algMu sync.RWMutex
+
+	// algorithms is the registry of jwt signing algorithms, keyed by alg header value.
+	algorithms = map[string]Algorithm{
+		ES512: &ecdsaAlgorithm{name: ES512, curve: elliptic.P521(), hash: crypto.SHA512, keySize: Keysize},
+		ES256: &ecdsaAlgorithm{name: ES256, curve: elliptic.P256(), hash: crypto.SHA256, keySize: 32},
+		EdDSA: &eddsaAlgorithm{},
+	}
+)
+
+// RegisterAlgorithm adds a signing algorithm to the registry so it can be used by signers and verifiers.
+// The "none" algorithm is rejected, as are empty names and names already registered.
+func RegisterAlgorithm(alg Algorithm) error {
+
+	if alg == nil || alg.Name() == "" {
+		return fmt.Errorf("algorithm name is required")
+	}
+
+	if strings.EqualFold(alg.Name(), algNone) {
+		return fmt.Errorf("algorithm %q cannot be registered", alg.Name())
+	}
+
+	algMu.Lock()
+	defer algMu.Unlock()
+
+	if _, ok := algorithms[alg.Name()]; ok {
+		return fmt.Errorf("algorithm %q is already registered", alg.Name())
+	}
+	algorithms[alg.Name()] = alg
+
+	return nil
+}
+
+// LookupAlgorithm returns the registered signing algorithm for a jwt header alg value.
+func LookupAlgorithm(name string) (Algorithm, error) {
+
+	algMu.RLock()
+	defer algMu.RUnlock()
+
+	alg, ok := algorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported jwt signing algorithm %q", name)
+	}
+
+	return alg, nil
+}
+
+// AlgorithmForKey returns the registered signing algorithm bound to the private or public key's type.
+func AlgorithmForKey(key any) (Algorithm, error) {
+
+	if key == nil {
+		return nil, fmt.Errorf("key is required to determine jwt signing algorithm")
+	}
+
+	algMu.RLock()
+	defer algMu.RUnlock()
+
+	for _, alg := range algorithms {
+		if alg.Supports(key) {
+			return alg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported jwt signing key type %T", key)
+}
+
+// ecdsaAlgorithm is an ecdsa jwt algorithm (ES256, ES512) with a raw r‖s signature serialization.
+type ecdsaAlgorithm struct {
+	name    string
+	curve   elliptic.Curve
+	hash    crypto.Hash
+	keySize int // bytes per signature component: r and s are each keySize bytes
+}
+
+// Name implements the Algorithm interface.
+func (a *ecdsaAlgorithm) Name() string { return a.name }
+
+// Supports implements the Algorithm interface.
+func (a *ecdsaAlgorithm) Supports(key any) bool {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return k != nil && k.Curve == a.curve
+	case *ecdsa.PublicKey:
+		return k != nil && k.Curve == a.curve
+	default:
+		return false
+	}
+}
+
+// Sign implements the Algorithm interface.
+func (a *ecdsaAlgorithm) Sign(key crypto.Signer, msg []byte) ([]byte, error) {
+
+	priv, ok := key.(*ecdsa.PrivateKey)
+	if !ok || !a.Supports(priv) {
+		return nil, fmt.Errorf("%s requires an ecdsa %s private key", a.name, a.curve.Params().Name)
+	}
+
+	hasher := a.hash.New()
+	hasher.Write(msg)
+	hashedMsg := hasher.Sum(nil)
+
+	r, s, err := ecdsa.Sign(rand.Reader, priv, hashedMsg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign jwt token msg: %w", err)
+	}
+
+	// serialize r and s
+	out := make([]byte, 2*a.keySize)
+	r.FillBytes(out[0:a.keySize])
+	s.FillBytes(out[a.keySize:])
+
+	return out, nil
+}
+
+// Verify implements the Algorithm interface.
+func (a *ecdsaAlgorithm) Verify(key crypto.PublicKey, msg, sig []byte) error {
+
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok || !a.Supports(pub) {
+		return tokenErrorf(ErrInvalidSignature, "%s requires an ecdsa %s public key", a.name, a.curve.Params().Name)
+	}
+
+	// raw r‖s serialization is always exactly 2*keySize bytes.
+	if len(sig) != 2*a.keySize {
+		return tokenErrorf(ErrInvalidSignature, "invalid signature length: expected %d bytes, got %d", 2*a.keySize, len(sig))
+	}
+
+	hasher := a.hash.New()
+	hasher.Write(msg)
+	hashedMsg := hasher.Sum(nil)
+
+	// divide signature in half to get r and s
+	r := big.NewInt(0).SetBytes(sig[:a.keySize])
+	s := big.NewInt(0).SetBytes(sig[a.keySize:])
+
+	if !ecdsa.Verify(pub, hashedMsg, r, s) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// eddsaAlgorithm is the ed25519 jwt algorithm (EdDSA).
+type eddsaAlgorithm struct{}
+
+// Name implements the Algorithm interface.
+func (a *eddsaAlgorithm) Name() string { return EdDSA }
+
+// Supports implements the Algorithm interface.
+func (a *eddsaAlgorithm) Supports(key any) bool {
+	switch key.(type) {
+	case ed25519.PrivateKey, *ed25519.PrivateKey, ed25519.PublicKey, *ed25519.PublicKey:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sign implements the Algorithm interface.
+func (a *eddsaAlgorithm) Sign(key crypto.Signer, msg []byte) ([]byte, error) {
+
+	var priv ed25519.PrivateKey
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		priv = k
+	case *ed25519.PrivateKey:
+		priv = *k
+	default:
+		return nil, fmt.Errorf("%s requires an ed25519 private key", EdDSA)
+	}
+
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%s private key must be %d bytes", EdDSA, ed25519.PrivateKeySize)
+	}
+
+	return ed25519.Sign(priv, msg), nil
+}
+
+// Verify implements the Algorithm interface.
+func (a *eddsaAlgorithm) Verify(key crypto.PublicKey, msg, sig []byte) error {
+
+	var pub ed25519.PublicKey
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		pub = k
+	case *ed25519.PublicKey:
+		pub = *k
+	default:
+		return tokenErrorf(ErrInvalidSignature, "%s requires an ed25519 public key", EdDSA)
+	}
+
+	if len(pub) != ed25519.PublicKeySize {
+		return tokenErrorf(ErrInvalidSignature, "%s public key must be %d bytes", EdDSA, ed25519.PublicKeySize)
+	}
+
+	if len(sig) != ed25519.SignatureSize {
+		return tokenErrorf(ErrInvalidSignature, "invalid signature length: expected %d bytes, got %d", ed25519.SignatureSize, len(sig))
+	}
+
+	if !ed25519.Verify(pub, msg, sig) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ---- Registry --------------------------------------------------------------
+
+// stubAlgorithm is a minimal Algorithm used to exercise registration.
+type stubAlgorithm struct{ name string }
+
+func (a *stubAlgorithm) Name() string                                  { return a.name }
+func (a *stubAlgorithm) Supports(key any) bool                         { return false }
+func (a *stubAlgorithm) Sign(crypto.Signer, []byte) ([]byte, error)    { return nil, nil }
+func (a *stubAlgorithm) Verify(crypto.PublicKey, []byte, []byte) error { return nil }
+
+func TestRegisterAlgorithm(t *testing.T) {
+	tests := []struct {
+		name      string
+		alg       Algorithm
+		wantErr   bool
+		errSubstr string
+	}{
+		{
+			name:      "nil_algorithm",
+			alg:       nil,
+			wantErr:   true,
+			errSubstr: "name is required",
+		},
+		{
+			name:      "empty_name",
+			alg:       &stubAlgorithm{name: ""},
+			wantErr:   true,
+			errSubstr: "name is required",
+		},
+		{
+			name:      "none_rejected",
+			alg:       &stubAlgorithm{name: "none"},
+			wantErr:   true,
+			errSubstr: "cannot be registered",
+		},
+		{
+			name:      "none_mixed_case_rejected",
+			alg:       &stubAlgorithm{name: "NONE"},
+			wantErr:   true,
+			errSubstr: "cannot be registered",
+		},
+		{
+			name:      "builtin_already_registered",
+			alg:       &stubAlgorithm{name: ES512},
+			wantErr:   true,
+			errSubstr: "already registered",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RegisterAlgorithm(tt.alg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAlgorithmForKey(t *testing.T) {
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     any
+		wantAlg string
+		wantErr bool
+	}{
+		{name: "p521_private", key: p521, wantAlg: ES512},
+		{name: "p521_public", key: &p521.PublicKey, wantAlg: ES512},
+		{name: "p256_private", key: p256, wantAlg: ES256},
+		{name: "p256_public", key: &p256.PublicKey, wantAlg: ES256},
+		{name: "ed25519_private", key: edPriv, wantAlg: EdDSA},
+		{name: "ed25519_public", key: edPub, wantAlg: EdDSA},
+		{name: "p384_unsupported", key: p384, wantErr: true},
+		{name: "nil_key", key: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alg, err := AlgorithmForKey(tt.key)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got alg %q", alg.Name())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if alg.Name() != tt.wantAlg {
+				t.Errorf("alg: want %q, got %q", tt.wantAlg, alg.Name())
+			}
+		})
+	}
+}
+
+// ---- Round trip ------------------------------------------------------------
+
+func TestAlgorithms_MintAndVerify(t *testing.T) {
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		alg     string
+		priv    crypto.Signer
+		pub     crypto.PublicKey
+		sigSize int
+	}{
+		{name: "es512", alg: ES512, priv: p521, pub: &p521.PublicKey, sigSize: 2 * Keysize},
+		{name: "es256", alg: ES256, priv: p256, pub: &p256.PublicKey, sigSize: 64},
+		{name: "eddsa", alg: EdDSA, priv: edPriv, pub: edPub, sigSize: ed25519.SignatureSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now().UTC()
+			tok := &Token{
+				Header: Header{Alg: tt.alg, Typ: TokenType},
+				Claims: Claims{
+					Issuer:   "https://auth.example.com",
+					Subject:  "user@example.com",
+					Audience: []string{"service-a"},
+					IssuedAt: now.Unix(),
+					Expires:  now.Add(time.Hour).Unix(),
+					Scopes:   "r:service-a:*",
+				},
+			}
+			if err := NewSigner(tt.priv).Mint(tok); err != nil {
+				t.Fatalf("unexpected mint error: %v", err)
+			}
+			if len(tok.Signature) != tt.sigSize {
+				t.Errorf("signature length: want %d, got %d", tt.sigSize, len(tok.Signature))
+			}
+
+			if _, err := NewVerifier("service-a", tt.pub).BuildAuthorized([]string{"r:service-a:*"}, tok.Raw); err != nil {
+				t.Fatalf("unexpected verify error: %v", err)
+			}
+
+			// a verifier bound to a different algorithm must reject the token
+			other := &p521.PublicKey
+			if tt.alg == ES512 {
+				other = &p256.PublicKey
+			}
+			_, err := NewVerifier("service-a", other).BuildAuthorized([]string{"r:service-a:*"}, tok.Raw)
+			if err == nil || !strings.Contains(err.Error(), "does not match the verifying key alg") {
+				t.Fatalf("expected alg mismatch error, got %v", err)
+			}
+		})
+	}
+}
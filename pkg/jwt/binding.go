@@ -0,0 +1,71 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+)
+
+// Confirmation is the RFC 7800 confirmation (cnf) claim, which binds a token to a key its presenter must hold.
+// Tokens are bound to a client certificate per RFC 8705, so a token lifted from logs cannot be replayed
+// from a host without the certificate's private key.
+type Confirmation struct {
+	X5tS256 string `json:"x5t#S256,omitempty"` // base64url encoded sha-256 thumbprint of the client certificate
+}
+
+// CertificateThumbprint returns the RFC 8705 x5t#S256 thumbprint of a certificate:
+// the base64url encoded sha-256 hash of its der encoding.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// BindCertificate binds the claims to a client certificate by setting the cnf claim to its thumbprint.
+func (c *Claims) BindCertificate(cert *x509.Certificate) error {
+
+	if cert == nil || len(cert.Raw) == 0 {
+		return fmt.Errorf("certificate is required to bind token")
+	}
+
+	c.Confirmation = &Confirmation{X5tS256: CertificateThumbprint(cert)}
+
+	return nil
+}
+
+// MintBound binds the token to the client certificate, stamping its thumbprint into the cnf claim, then mints it
+// with the signer.  The token is only accepted when presented over an mTLS connection authenticated with the same certificate.
+func MintBound(s Signer, jot *Token, cert *x509.Certificate) error {
+
+	if err := jot.Claims.BindCertificate(cert); err != nil {
+		return fmt.Errorf("failed to bind jwt to client certificate: %w", err)
+	}
+
+	return s.Mint(jot)
+}
+
+// IsCertificateBound reports whether the claims carry a certificate thumbprint confirmation.
+func (c *Claims) IsCertificateBound() bool {
+	return c.Confirmation != nil && c.Confirmation.X5tS256 != ""
+}
+
+// VerifyCertificateBinding checks that a certificate bound token is presented with its certificate,
+// eg, the peer certificate of the mTLS connection it was received on.  Tokens which are not bound pass:
+// use IsCertificateBound to require binding.
+func (c *Claims) VerifyCertificateBinding(cert *x509.Certificate) error {
+
+	if !c.IsCertificateBound() {
+		return nil
+	}
+
+	if cert == nil {
+		return tokenErrorf(ErrCertificateMismatch, "certificate bound token presented without a client certificate")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.Confirmation.X5tS256), []byte(CertificateThumbprint(cert))) != 1 {
+		return ErrCertificateMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCertificate creates a self-signed client certificate for binding tests, failing the test on error.
+func testCertificate(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate certificate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	return cert
+}
+
+// ---- certificate binding ----
+
+func TestVerifyCertificateBinding(t *testing.T) {
+
+	bound := testCertificate(t, "service-a")
+	other := testCertificate(t, "service-b")
+
+	tests := []struct {
+		name    string
+		bindTo  *x509.Certificate
+		peer    *x509.Certificate
+		wantErr bool
+	}{
+		{name: "unbound_token_no_peer", wantErr: false},
+		{name: "unbound_token_with_peer", peer: other, wantErr: false},
+		{name: "bound_token_matching_peer", bindTo: bound, peer: bound, wantErr: false},
+		{name: "bound_token_other_peer", bindTo: bound, peer: other, wantErr: true},
+		{name: "bound_token_no_peer", bindTo: bound, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Claims
+			if tt.bindTo != nil {
+				if err := c.BindCertificate(tt.bindTo); err != nil {
+					t.Fatalf("BindCertificate() error: %v", err)
+				}
+			}
+
+			err := c.VerifyCertificateBinding(tt.peer)
+			if tt.wantErr {
+				if !errors.Is(err, ErrCertificateMismatch) || !errors.Is(err, ErrUnauthorized) {
+					t.Fatalf("expected errors.Is(err, ErrCertificateMismatch), got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	var c Claims
+	if err := c.BindCertificate(nil); err == nil {
+		t.Error("expected error binding to nil certificate, got nil")
+	}
+}
+
+func TestMintBound(t *testing.T) {
+	const svcName = "service-a"
+
+	s, v, _ := testVerifierSetup(t, svcName)
+	cert := testCertificate(t, "service-b")
+
+	now := time.Now().UTC()
+	jot := &Token{
+		Header: Header{Alg: ES512, Typ: TokenType},
+		Claims: Claims{
+			Issuer:   "https://auth.example.com",
+			Subject:  "service-b",
+			Audience: []string{svcName},
+			IssuedAt: now.Unix(),
+			Expires:  now.Add(time.Hour).Unix(),
+			Scopes:   "r:service-a:*",
+		},
+	}
+	if err := MintBound(s, jot, cert); err != nil {
+		t.Fatalf("MintBound() error: %v", err)
+	}
+
+	verified, err := v.BuildAuthorized([]string{"r:service-a:album"}, jot.Raw)
+	if err != nil {
+		t.Fatalf("BuildAuthorized() error: %v", err)
+	}
+
+	if !verified.Claims.IsCertificateBound() {
+		t.Fatal("verified token is not certificate bound")
+	}
+	if got, want := verified.Claims.Confirmation.X5tS256, CertificateThumbprint(cert); got != want {
+		t.Errorf("cnf x5t#S256 = %q, want %q", got, want)
+	}
+	if err := verified.Claims.VerifyCertificateBinding(cert); err != nil {
+		t.Errorf("VerifyCertificateBinding() error: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ErrClaimNotFound is returned by GetClaim when a token does not carry the requested custom claim.
+var ErrClaimNotFound = errors.New("claim not found")
+
+// registeredClaims is the set of claim names with a Claims struct field, derived from the json tags,
+// which cannot be used as custom claim names.
+var registeredClaims = func() map[string]struct{} {
+
+	names := make(map[string]struct{})
+	t := reflect.TypeOf(Claims{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = struct{}{}
+		}
+	}
+
+	return names
+}()
+
+// claimsAlias has the fields of Claims without its json methods, so they can call the default encoding.
+type claimsAlias Claims
+
+// MarshalJSON implements the json.Marshaler interface.  Custom claims in Extra are appended after
+// the registered claims in name order, so the output is deterministic; claims without extras marshal as before.
+func (c Claims) MarshalJSON() ([]byte, error) {
+
+	registered, err := json.Marshal(claimsAlias(c))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.Extra) == 0 {
+		return registered, nil
+	}
+
+	names := make([]string, 0, len(c.Extra))
+	for name := range c.Extra {
+		if _, ok := registeredClaims[name]; ok {
+			return nil, fmt.Errorf("custom claim %q conflicts with a registered claim", name)
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var buf bytes.Buffer
+	buf.Write(registered[:len(registered)-1]) // drop the closing brace
+	for _, name := range names {
+
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+
+		// marshaling the raw message validates and compacts it
+		val, err := json.Marshal(c.Extra[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for custom claim %q: %v", name, err)
+		}
+
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.  Claims without a Claims struct field are
+// preserved in Extra, so custom claims round trip through BuildTokenFromRaw.
+func (c *Claims) UnmarshalJSON(data []byte) error {
+
+	var alias claimsAlias
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	for name := range registeredClaims {
+		delete(all, name)
+	}
+
+	*c = Claims(alias)
+	c.Extra = nil
+	if len(all) > 0 {
+		c.Extra = all
+	}
+
+	return nil
+}
+
+// SetClaim sets a custom claim on the claims, eg, SetClaim(&claims, "tenant", "gallery-team").
+// The value must marshal to json.  Registered claim names, eg, "sub", are rejected: use the Claims fields.
+func SetClaim[T any](c *Claims, name string, value T) error {
+
+	if name == "" {
+		return fmt.Errorf("custom claim name is required")
+	}
+
+	if _, ok := registeredClaims[name]; ok {
+		return fmt.Errorf("custom claim %q conflicts with a registered claim", name)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal custom claim %q: %v", name, err)
+	}
+
+	if c.Extra == nil {
+		c.Extra = make(map[string]json.RawMessage)
+	}
+	c.Extra[name] = raw
+
+	return nil
+}
+
+// GetClaim unmarshals a custom claim into the type T, eg, GetClaim[[]string](&token.Claims, "album_ids").
+// It returns an error wrapping ErrClaimNotFound if the claims do not carry the claim.
+func GetClaim[T any](c *Claims, name string) (T, error) {
+
+	var value T
+
+	raw, ok := c.Extra[name]
+	if !ok {
+		return value, fmt.Errorf("%w: %q", ErrClaimNotFound, name)
+	}
+
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return value, fmt.Errorf("failed to unmarshal custom claim %q: %v", name, err)
+	}
+
+	return value, nil
+}
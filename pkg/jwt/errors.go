@@ -0,0 +1,80 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Token verification errors.  Every error returned by the Verifier wraps exactly one of the specific errors below,
+// each of which wraps either ErrUnauthorized or ErrForbidden, so callers can decide on a response
+// with errors.Is rather than by inspecting error messages, eg, errors.Is(err, ErrForbidden) -> 403.
+var (
+	// ErrUnauthorized is the category of errors where the token itself is not valid: 401.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is the category of errors where the token is valid but does not grant access: 403.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrMissingToken is returned when no token is provided.
+	ErrMissingToken = fmt.Errorf("%w: missing token", ErrUnauthorized)
+
+	// ErrMalformedToken is returned when a token cannot be parsed or its header or claims are not valid.
+	ErrMalformedToken = fmt.Errorf("%w: malformed token", ErrUnauthorized)
+
+	// ErrUnknownSigningKey is returned when no trusted verifying key matches the token's key id and alg.
+	ErrUnknownSigningKey = fmt.Errorf("%w: unknown signing key", ErrUnauthorized)
+
+	// ErrInvalidSignature is returned when a token's signature does not verify.
+	ErrInvalidSignature = fmt.Errorf("%w: failed to verify jwt signature", ErrUnauthorized)
+
+	// ErrTokenExpired is returned when a token is past its expiry.
+	ErrTokenExpired = fmt.Errorf("%w: token expired", ErrUnauthorized)
+
+	// ErrTokenNotYetValid is returned when a token is used before it was issued or before its not before time.
+	ErrTokenNotYetValid = fmt.Errorf("%w: token not yet valid", ErrUnauthorized)
+
+	// ErrInvalidIssuer is returned when a token's issuer is not one of the verifier's trusted issuers.
+	ErrInvalidIssuer = fmt.Errorf("%w: untrusted issuer", ErrUnauthorized)
+
+	// ErrCertificateMismatch is returned when a certificate bound token is not presented with its certificate.
+	ErrCertificateMismatch = fmt.Errorf("%w: token certificate binding mismatch", ErrUnauthorized)
+
+	// ErrDecryptionFailed is returned when an encrypted token (jwe) cannot be decrypted with the recipient key.
+	ErrDecryptionFailed = fmt.Errorf("%w: failed to decrypt token", ErrUnauthorized)
+
+	// ErrTokenRevoked is returned when a token has been revoked.
+	ErrTokenRevoked = fmt.Errorf("%w: token revoked", ErrUnauthorized)
+
+	// ErrInvalidAudience is returned when the verifying service is not in a token's audiences.
+	ErrInvalidAudience = fmt.Errorf("%w: incorrect audience", ErrForbidden)
+
+	// ErrMissingScope is returned when a token does not grant the required scopes.
+	ErrMissingScope = fmt.Errorf("%w: incorrect or missing scopes", ErrForbidden)
+)
+
+// tokenError is a token verification error with a detailed message which unwraps to one of the errors above.
+type tokenError struct {
+	kind error
+	msg  string
+}
+
+// Error implements the error interface.
+func (e *tokenError) Error() string { return e.msg }
+
+// Unwrap returns the specific verification error so errors.Is matches both it and its category.
+func (e *tokenError) Unwrap() error { return e.kind }
+
+// tokenErrorf is a helper function which creates a verification error of the given kind,
+// prefixing the formatted detail with the kind's category, eg, "unauthorized: invalid signature length: ...".
+func tokenErrorf(kind error, format string, args ...any) error {
+
+	category := ErrUnauthorized
+	if errors.Is(kind, ErrForbidden) {
+		category = ErrForbidden
+	}
+
+	return &tokenError{
+		kind: kind,
+		msg:  category.Error() + ": " + fmt.Sprintf(format, args...),
+	}
+}
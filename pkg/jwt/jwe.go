@@ -0,0 +1,411 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	JweAlgEcdhEs  string = "ECDH-ES" // jwe alg: ephemeral-static ecdh key agreement, used directly as the content key
+	JweEncA256Gcm string = "A256GCM" // jwe enc: aes-256 gcm content encryption
+
+	// ContentTypeJwt is the jwe cty value of a nested, ie, signed then encrypted, token.
+	ContentTypeJwt string = "JWT"
+
+	CrvX25519 string = "X25519"
+
+	// JweMax is the maximum length of a jwe compact serialization accepted for decryption.
+	JweMax int = 8192
+
+	jweIvSize  = 12 // bytes: gcm standard nonce size
+	jweTagSize = 16 // bytes: gcm tag size
+	jweKeyBits = 256
+)
+
+// JweHeader is the protected header of a jwe.
+type JweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Cty string `json:"cty,omitempty"`
+	Kid string `json:"kid,omitempty"` // recipient key id
+	Epk JWK    `json:"epk"`           // ephemeral public key of the sender
+}
+
+// Encrypter is an interface that encrypts signed tokens for a recipient, so claims such as
+// email and birthdate are not readable wherever the token is stored, eg, browser storage.
+type Encrypter interface {
+
+	// Encrypt wraps a signed token's compact serialization, eg, Token.Raw, in an ECDH-ES + A256GCM jwe
+	// for the recipient's public key, returning the jwe compact serialization.
+	Encrypt(raw string) (string, error)
+}
+
+// Decrypter is an interface that decrypts jwe wrapped tokens with the recipient's private key.
+type Decrypter interface {
+
+	// Decrypt decrypts a jwe compact serialization, returning the signed token it wraps.
+	// The signed token must still be verified, eg, with Verifier.BuildAuthorized.
+	Decrypt(jwe string) (string, error)
+}
+
+// EncrypterOption is a functional option for configuring the Encrypter.
+type EncrypterOption func(*encrypter)
+
+// WithRecipientKeyId sets the recipient key id (kid) stamped into the jwe header,
+// so a recipient holding more than one key can select the correct one.
+func WithRecipientKeyId(kid string) EncrypterOption {
+	return func(e *encrypter) { e.kid = kid }
+}
+
+// NewEncrypter creates a new Encrypter for the recipient's public key: an *ecdh.PublicKey,
+// eg, X25519 or P-256, or an *ecdsa.PublicKey on a P-256, P-384, or P-521 curve.
+func NewEncrypter(recipient crypto.PublicKey, opts ...EncrypterOption) (Encrypter, error) {
+
+	pub, err := toEcdhPublicKey(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &encrypter{pub: pub}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	if len(e.kid) > KeyIdMax {
+		return nil, fmt.Errorf("recipient key id must not exceed %d characters", KeyIdMax)
+	}
+
+	return e, nil
+}
+
+var _ Encrypter = (*encrypter)(nil)
+
+type encrypter struct {
+	pub *ecdh.PublicKey
+	kid string
+}
+
+// Encrypt implements the Encrypter interface.
+func (e *encrypter) Encrypt(raw string) (string, error) {
+
+	if raw == "" {
+		return "", fmt.Errorf("token is required for encryption")
+	}
+
+	// ephemeral key pair: a new content key for every token
+	eph, err := e.pub.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate ephemeral key: %v", err)
+	}
+
+	z, err := eph.ECDH(e.pub)
+	if err != nil {
+		return "", fmt.Errorf("failed to perform ecdh key agreement: %v", err)
+	}
+
+	epk, err := ecdhJWK(eph.PublicKey())
+	if err != nil {
+		return "", err
+	}
+
+	jsonHeader, err := json.Marshal(JweHeader{
+		Alg: JweAlgEcdhEs,
+		Enc: JweEncA256Gcm,
+		Cty: ContentTypeJwt,
+		Kid: e.kid,
+		Epk: epk,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal jwe header to json: %v", err)
+	}
+	protected := base64.RawURLEncoding.EncodeToString(jsonHeader)
+
+	gcm, err := newJweGcm(concatKDF(z, JweEncA256Gcm, nil, nil, jweKeyBits))
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, jweIvSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("failed to generate jwe iv: %v", err)
+	}
+
+	// the protected header is authenticated as additional data
+	sealed := gcm.Seal(nil, iv, []byte(raw), []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-jweTagSize], sealed[len(sealed)-jweTagSize:]
+
+	// direct key agreement: the encrypted key segment is empty
+	return protected + ".." +
+		base64.RawURLEncoding.EncodeToString(iv) + "." +
+		base64.RawURLEncoding.EncodeToString(ciphertext) + "." +
+		base64.RawURLEncoding.EncodeToString(tag), nil
+}
+
+// DecrypterOption is a functional option for configuring the Decrypter.
+type DecrypterOption func(*decrypter)
+
+// WithDecrypterKeyId sets the key id of the recipient key: jwe headers with a different kid are rejected.
+func WithDecrypterKeyId(kid string) DecrypterOption {
+	return func(d *decrypter) { d.kid = kid }
+}
+
+// NewDecrypter creates a new Decrypter with the recipient's private key: an *ecdh.PrivateKey,
+// or an *ecdsa.PrivateKey on a P-256, P-384, or P-521 curve.
+func NewDecrypter(priv crypto.PrivateKey, opts ...DecrypterOption) (Decrypter, error) {
+
+	var key *ecdh.PrivateKey
+	switch k := priv.(type) {
+	case *ecdh.PrivateKey:
+		key = k
+	case *ecdsa.PrivateKey:
+		converted, err := k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("unsupported ecdsa private key for jwe decryption: %v", err)
+		}
+		key = converted
+	default:
+		return nil, fmt.Errorf("unsupported jwe decryption key type %T", priv)
+	}
+
+	d := &decrypter{priv: key}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d, nil
+}
+
+var _ Decrypter = (*decrypter)(nil)
+
+type decrypter struct {
+	priv *ecdh.PrivateKey
+	kid  string
+}
+
+// Decrypt implements the Decrypter interface.
+func (d *decrypter) Decrypt(jwe string) (string, error) {
+
+	jwe = strings.TrimPrefix(strings.TrimSpace(jwe), "Bearer ")
+
+	if len(jwe) > JweMax {
+		return "", tokenErrorf(ErrMalformedToken, "jwe must not exceed %d characters", JweMax)
+	}
+
+	segments := strings.Split(jwe, ".")
+	if len(segments) != 5 {
+		return "", tokenErrorf(ErrMalformedToken, "jwe not properly formatted into 5 segments separated by '.'")
+	}
+
+	// parse and check the protected header
+	decodedHeader, err := base64.RawURLEncoding.DecodeString(segments[0])
+	if err != nil {
+		return "", tokenErrorf(ErrMalformedToken, "failed to base64 decode jwe header: %v", err)
+	}
+
+	var header JweHeader
+	if err := json.Unmarshal(decodedHeader, &header); err != nil {
+		return "", tokenErrorf(ErrMalformedToken, "failed to unmarshal json to jwe header: %v", err)
+	}
+
+	if header.Alg != JweAlgEcdhEs || header.Enc != JweEncA256Gcm {
+		return "", tokenErrorf(ErrMalformedToken, "unsupported jwe alg/enc %q/%q", header.Alg, header.Enc)
+	}
+
+	if header.Cty != ContentTypeJwt {
+		return "", tokenErrorf(ErrMalformedToken, "jwe cty must be %s, got %q", ContentTypeJwt, header.Cty)
+	}
+
+	if d.kid != "" && header.Kid != "" && header.Kid != d.kid {
+		return "", tokenErrorf(ErrUnknownSigningKey, "jwe encrypted for unknown key %q", header.Kid)
+	}
+
+	// direct key agreement: there is no encrypted key
+	if segments[1] != "" {
+		return "", tokenErrorf(ErrMalformedToken, "jwe encrypted key must be empty for %s", JweAlgEcdhEs)
+	}
+
+	epk, err := header.Epk.ecdhPublicKey(d.priv.Curve())
+	if err != nil {
+		return "", tokenErrorf(ErrMalformedToken, "invalid jwe epk: %v", err)
+	}
+
+	iv, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil || len(iv) != jweIvSize {
+		return "", tokenErrorf(ErrMalformedToken, "jwe iv must be %d base64url encoded bytes", jweIvSize)
+	}
+
+	ciphertext, err := base64.RawURLEncoding.DecodeString(segments[3])
+	if err != nil {
+		return "", tokenErrorf(ErrMalformedToken, "failed to base64 decode jwe ciphertext: %v", err)
+	}
+
+	tag, err := base64.RawURLEncoding.DecodeString(segments[4])
+	if err != nil || len(tag) != jweTagSize {
+		return "", tokenErrorf(ErrMalformedToken, "jwe tag must be %d base64url encoded bytes", jweTagSize)
+	}
+
+	z, err := d.priv.ECDH(epk)
+	if err != nil {
+		return "", tokenErrorf(ErrDecryptionFailed, "ecdh key agreement failed: %v", err)
+	}
+
+	gcm, err := newJweGcm(concatKDF(z, JweEncA256Gcm, nil, nil, jweKeyBits))
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(segments[0]))
+	if err != nil {
+		return "", ErrDecryptionFailed
+	}
+
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether a token is in jwe compact serialization (5 segments)
+// rather than jws compact serialization (3 segments).
+func IsEncrypted(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// newJweGcm is a helper function which creates an aes gcm cipher from a content encryption key.
+func newJweGcm(cek []byte) (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create aes cipher: %v", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm cipher: %v", err)
+	}
+
+	return gcm, nil
+}
+
+// concatKDF derives a key from the shared secret z using the NIST SP 800-56A single step
+// concatenation kdf with sha-256, as specified for ECDH-ES by RFC 7518 section 4.6.2.
+func concatKDF(z []byte, algId string, apu, apv []byte, keyBits int) []byte {
+
+	otherInfo := lengthPrefixed([]byte(algId))
+	otherInfo = append(otherInfo, lengthPrefixed(apu)...)
+	otherInfo = append(otherInfo, lengthPrefixed(apv)...)
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(keyBits))
+
+	keyLen := keyBits / 8
+	var out []byte
+	for counter := uint32(1); len(out) < keyLen; counter++ {
+		h := sha256.New()
+		h.Write(binary.BigEndian.AppendUint32(nil, counter))
+		h.Write(z)
+		h.Write(otherInfo)
+		out = h.Sum(out)
+	}
+
+	return out[:keyLen]
+}
+
+// lengthPrefixed is a helper function which prefixes data with its 32 bit big endian length.
+func lengthPrefixed(data []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(data))), data...)
+}
+
+// toEcdhPublicKey is a helper function which converts a supported recipient public key to an ecdh public key.
+func toEcdhPublicKey(key crypto.PublicKey) (*ecdh.PublicKey, error) {
+	switch k := key.(type) {
+	case *ecdh.PublicKey:
+		return k, nil
+	case *ecdsa.PublicKey:
+		pub, err := k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("unsupported ecdsa public key for jwe encryption: %v", err)
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported jwe encryption key type %T", key)
+	}
+}
+
+// ecdhCurveName is a helper function which returns the json web key type and curve name of an ecdh curve.
+func ecdhCurveName(curve ecdh.Curve) (kty, crv string, err error) {
+	switch curve {
+	case ecdh.X25519():
+		return KtyOkp, CrvX25519, nil
+	case ecdh.P256():
+		return KtyEc, CrvP256, nil
+	case ecdh.P384():
+		return KtyEc, CrvP384, nil
+	case ecdh.P521():
+		return KtyEc, CrvP521, nil
+	default:
+		return "", "", fmt.Errorf("unsupported ecdh curve %v", curve)
+	}
+}
+
+// ecdhJWK is a helper function which creates the json web key of an ephemeral ecdh public key.
+func ecdhJWK(pub *ecdh.PublicKey) (JWK, error) {
+
+	kty, crv, err := ecdhCurveName(pub.Curve())
+	if err != nil {
+		return JWK{}, err
+	}
+
+	point := pub.Bytes()
+	if kty == KtyOkp {
+		return JWK{Kty: kty, Crv: crv, X: base64.RawURLEncoding.EncodeToString(point)}, nil
+	}
+
+	// uncompressed point: 0x04 || x || y
+	size := (len(point) - 1) / 2
+	return JWK{
+		Kty: kty,
+		Crv: crv,
+		X:   base64.RawURLEncoding.EncodeToString(point[1 : 1+size]),
+		Y:   base64.RawURLEncoding.EncodeToString(point[1+size:]),
+	}, nil
+}
+
+// ecdhPublicKey is a helper method which parses an ephemeral json web key into an ecdh public key on the curve.
+// Points not on the curve are rejected by the ecdh parser.
+func (j JWK) ecdhPublicKey(curve ecdh.Curve) (*ecdh.PublicKey, error) {
+
+	kty, crv, err := ecdhCurveName(curve)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.Kty != kty || j.Crv != crv {
+		return nil, fmt.Errorf("epk must be a %s %s key, got %q %q", kty, crv, j.Kty, j.Crv)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(j.X)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64 decode x: %v", err)
+	}
+
+	if kty == KtyOkp {
+		return curve.NewPublicKey(x)
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(j.Y)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64 decode y: %v", err)
+	}
+
+	return curve.NewPublicKey(append(append([]byte{4}, x...), y...))
+}
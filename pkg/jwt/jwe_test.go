@@ -0,0 +1,286 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ---- concatKDF ----
+
+// RFC 7518 appendix C: ECDH-ES key agreement computation example.
+func TestConcatKDF_RFC7518(t *testing.T) {
+
+	z := []byte{158, 86, 217, 29, 129, 113, 53, 211, 114, 131, 66, 131, 191,
+		132, 38, 156, 251, 49, 110, 163, 218, 128, 106, 72, 246, 218, 167,
+		121, 140, 254, 144, 196}
+
+	got := base64.RawURLEncoding.EncodeToString(concatKDF(z, "A128GCM", []byte("Alice"), []byte("Bob"), 128))
+	if want := "VqqN6vgjbSBcIijNcacQGg"; got != want {
+		t.Errorf("concatKDF() = %q, want %q", got, want)
+	}
+}
+
+// ---- Encrypt / Decrypt ----
+
+func TestJwe_RoundTrip(t *testing.T) {
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate P-256 key: %v", err)
+	}
+	p521, err := ecdh.P521().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate P-521 key: %v", err)
+	}
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate X25519 key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		pub     crypto.PublicKey
+		priv    crypto.PrivateKey
+		wantKty string
+		wantCrv string
+	}{
+		{name: "ecdsa_p256", pub: &p256.PublicKey, priv: p256, wantKty: KtyEc, wantCrv: CrvP256},
+		{name: "ecdh_p521", pub: p521.PublicKey(), priv: p521, wantKty: KtyEc, wantCrv: CrvP521},
+		{name: "x25519", pub: x25519.PublicKey(), priv: x25519, wantKty: KtyOkp, wantCrv: CrvX25519},
+	}
+
+	const signed = "eyJhbGciOiJFUzUxMiJ9.eyJzdWIiOiJ1c2VyQGV4YW1wbGUuY29tIn0.c2ln"
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := NewEncrypter(tt.pub, WithRecipientKeyId("enc-1"))
+			if err != nil {
+				t.Fatalf("NewEncrypter() error: %v", err)
+			}
+			dec, err := NewDecrypter(tt.priv, WithDecrypterKeyId("enc-1"))
+			if err != nil {
+				t.Fatalf("NewDecrypter() error: %v", err)
+			}
+
+			jwe, err := enc.Encrypt(signed)
+			if err != nil {
+				t.Fatalf("Encrypt() error: %v", err)
+			}
+			if !IsEncrypted(jwe) || IsEncrypted(signed) {
+				t.Fatalf("IsEncrypted() did not distinguish jwe from jws")
+			}
+			if strings.Contains(jwe, strings.Split(signed, ".")[1]) {
+				t.Fatal("jwe contains the plaintext claims segment")
+			}
+
+			header := decodeJweHeader(t, jwe)
+			if header.Alg != JweAlgEcdhEs || header.Enc != JweEncA256Gcm || header.Cty != ContentTypeJwt || header.Kid != "enc-1" {
+				t.Errorf("header = %+v, want alg %s enc %s cty %s kid enc-1", header, JweAlgEcdhEs, JweEncA256Gcm, ContentTypeJwt)
+			}
+			if header.Epk.Kty != tt.wantKty || header.Epk.Crv != tt.wantCrv {
+				t.Errorf("epk kty/crv = %q/%q, want %q/%q", header.Epk.Kty, header.Epk.Crv, tt.wantKty, tt.wantCrv)
+			}
+
+			got, err := dec.Decrypt(jwe)
+			if err != nil {
+				t.Fatalf("Decrypt() error: %v", err)
+			}
+			if got != signed {
+				t.Errorf("Decrypt() = %q, want %q", got, signed)
+			}
+
+			// a new ephemeral key and iv every time
+			again, err := enc.Encrypt(signed)
+			if err != nil {
+				t.Fatalf("Encrypt() error: %v", err)
+			}
+			if again == jwe {
+				t.Error("encrypting the same token twice produced the same jwe")
+			}
+		})
+	}
+}
+
+func TestJwe_Decrypt_Invalid(t *testing.T) {
+
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate P-256 key: %v", err)
+	}
+	other, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate P-256 key: %v", err)
+	}
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate X25519 key: %v", err)
+	}
+
+	encrypt := func(pub crypto.PublicKey, opts ...EncrypterOption) string {
+		t.Helper()
+		enc, err := NewEncrypter(pub, opts...)
+		if err != nil {
+			t.Fatalf("NewEncrypter() error: %v", err)
+		}
+		jwe, err := enc.Encrypt("a.b.c")
+		if err != nil {
+			t.Fatalf("Encrypt() error: %v", err)
+		}
+		return jwe
+	}
+
+	valid := encrypt(priv.PublicKey())
+	segments := strings.Split(valid, ".")
+
+	// flip a bit in a decoded segment and re-encode it
+	tamper := func(i int) string {
+		b, _ := base64.RawURLEncoding.DecodeString(segments[i])
+		b[0] ^= 0x01
+		s := append([]string{}, segments...)
+		s[i] = base64.RawURLEncoding.EncodeToString(b)
+		return strings.Join(s, ".")
+	}
+
+	// a re-encoded header: valid json, but no longer the authenticated header
+	header := decodeJweHeader(t, valid)
+	header.Kid = "swapped"
+	reheadered := append([]string{encodeSegment(header)}, segments[1:]...)
+
+	// a header with an unsupported enc
+	header = decodeJweHeader(t, valid)
+	header.Enc = "A128CBC-HS256"
+	wrongEnc := append([]string{encodeSegment(header)}, segments[1:]...)
+
+	tests := []struct {
+		name   string
+		jwe    string
+		opts   []DecrypterOption
+		wantIs error
+	}{
+		{name: "jws_not_jwe", jwe: "a.b.c", wantIs: ErrMalformedToken},
+		{name: "too_long", jwe: strings.Repeat("a", JweMax+1), wantIs: ErrMalformedToken},
+		{name: "tampered_ciphertext", jwe: tamper(3), wantIs: ErrDecryptionFailed},
+		{name: "tampered_tag", jwe: tamper(4), wantIs: ErrDecryptionFailed},
+		{name: "tampered_iv", jwe: tamper(2), wantIs: ErrDecryptionFailed},
+		{name: "tampered_header", jwe: strings.Join(reheadered, "."), wantIs: ErrDecryptionFailed},
+		{name: "unsupported_enc", jwe: strings.Join(wrongEnc, "."), wantIs: ErrMalformedToken},
+		{name: "encrypted_key_present", jwe: segments[0] + ".a2V5." + strings.Join(segments[2:], "."), wantIs: ErrMalformedToken},
+		{name: "wrong_recipient", jwe: encrypt(other.PublicKey()), wantIs: ErrDecryptionFailed},
+		{name: "epk_wrong_curve", jwe: encrypt(x25519.PublicKey()), wantIs: ErrMalformedToken},
+		{
+			name:   "unknown_recipient_kid",
+			jwe:    encrypt(priv.PublicKey(), WithRecipientKeyId("enc-old")),
+			opts:   []DecrypterOption{WithDecrypterKeyId("enc-new")},
+			wantIs: ErrUnknownSigningKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec, err := NewDecrypter(priv, tt.opts...)
+			if err != nil {
+				t.Fatalf("NewDecrypter() error: %v", err)
+			}
+			_, err = dec.Decrypt(tt.jwe)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !errors.Is(err, tt.wantIs) || !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("expected error wrapping %v, got %v", tt.wantIs, err)
+			}
+		})
+	}
+}
+
+func TestNewEncrypter_UnsupportedKey(t *testing.T) {
+
+	if _, err := NewEncrypter("not a key"); err == nil {
+		t.Error("expected error for unsupported recipient key type, got nil")
+	}
+
+	if _, err := NewDecrypter("not a key"); err == nil {
+		t.Error("expected error for unsupported decryption key type, got nil")
+	}
+}
+
+// ---- Decrypt then BuildAuthorized ----
+
+func TestJwe_DecryptThenBuildAuthorized(t *testing.T) {
+	const svcName = "service-a"
+
+	s, v, _ := testVerifierSetup(t, svcName)
+
+	recipient, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate X25519 key: %v", err)
+	}
+
+	now := time.Now().UTC()
+	raw := mintRaw(t, s, &Token{
+		Header: Header{Alg: ES512, Typ: TokenType},
+		Claims: Claims{
+			Jti:       "3bb72d75-dcfa-400a-a78e-5a4ecd0d3f09",
+			Issuer:    "https://auth.example.com",
+			Subject:   "user@example.com",
+			Audience:  []string{svcName},
+			IssuedAt:  now.Unix(),
+			Expires:   now.Add(time.Hour).Unix(),
+			Scopes:    "r:service-a:*",
+			Birthdate: "1990-01-01",
+		},
+	})
+
+	enc, err := NewEncrypter(recipient.PublicKey())
+	if err != nil {
+		t.Fatalf("NewEncrypter() error: %v", err)
+	}
+	jwe, err := enc.Encrypt(raw)
+	if err != nil {
+		t.Fatalf("Encrypt() error: %v", err)
+	}
+
+	// the encrypted token is not a jws
+	if _, err := v.BuildAuthorized([]string{"r:service-a:*"}, jwe); !errors.Is(err, ErrMalformedToken) {
+		t.Errorf("BuildAuthorized(jwe) error = %v, want %v", err, ErrMalformedToken)
+	}
+
+	dec, err := NewDecrypter(recipient)
+	if err != nil {
+		t.Fatalf("NewDecrypter() error: %v", err)
+	}
+	signed, err := dec.Decrypt("Bearer " + jwe)
+	if err != nil {
+		t.Fatalf("Decrypt() error: %v", err)
+	}
+
+	jot, err := v.BuildAuthorized([]string{"r:service-a:*"}, signed)
+	if err != nil {
+		t.Fatalf("BuildAuthorized() error: %v", err)
+	}
+	if jot.Claims.Birthdate != "1990-01-01" {
+		t.Errorf("birthdate = %q, want %q", jot.Claims.Birthdate, "1990-01-01")
+	}
+}
+
+// decodeJweHeader is a helper which decodes the protected header of a jwe, failing the test on error.
+func decodeJweHeader(t *testing.T, jwe string) JweHeader {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(strings.Split(jwe, ".")[0])
+	if err != nil {
+		t.Fatalf("failed to decode jwe header: %v", err)
+	}
+	var h JweHeader
+	if err := json.Unmarshal(b, &h); err != nil {
+		t.Fatalf("failed to unmarshal jwe header: %v", err)
+	}
+	return h
+}
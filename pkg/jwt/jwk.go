@@ -0,0 +1,244 @@
+package jwt
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+const (
+	KtyEc  string = "EC"  // jwk key type: elliptic curve
+	KtyOkp string = "OKP" // jwk key type: octet key pair, eg, ed25519
+
+	CrvP256    string = "P-256"
+	CrvP384    string = "P-384"
+	CrvP521    string = "P-521"
+	CrvEd25519 string = "Ed25519"
+
+	// UseSig is the jwk use value of keys which verify signatures.
+	UseSig string = "sig"
+)
+
+// JWK is an RFC 7517 json web key holding a public verifying key.
+// Only the parameters for ecdsa and ed25519 public keys are supported.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+}
+
+// JWKSet is an RFC 7517 json web key set document, eg, the response of an issuer's jwks endpoint.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK creates a json web key from a verifying key.
+// The alg is the key's alg, or determined by the public key type if empty.
+func NewJWK(key VerifyingKey) (JWK, error) {
+
+	alg, err := bindAlgorithm(key)
+	if err != nil {
+		return JWK{}, err
+	}
+
+	jwk := JWK{
+		Kid: key.KeyId,
+		Alg: alg.Name(),
+		Use: UseSig,
+	}
+
+	switch pub := key.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+
+		crv, size, err := curveParams(pub.Curve)
+		if err != nil {
+			return JWK{}, err
+		}
+
+		// uncompressed point: 0x04 || x || y
+		ecdhPub, err := pub.ECDH()
+		if err != nil {
+			return JWK{}, fmt.Errorf("invalid ecdsa public key: %v", err)
+		}
+		point := ecdhPub.Bytes()
+
+		jwk.Kty = KtyEc
+		jwk.Crv = crv
+		jwk.X = base64.RawURLEncoding.EncodeToString(point[1 : 1+size])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(point[1+size:])
+
+	case ed25519.PublicKey:
+		jwk.Kty = KtyOkp
+		jwk.Crv = CrvEd25519
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+
+	case *ed25519.PublicKey:
+		jwk.Kty = KtyOkp
+		jwk.Crv = CrvEd25519
+		jwk.X = base64.RawURLEncoding.EncodeToString(*pub)
+
+	default:
+		return JWK{}, fmt.Errorf("unsupported jwk public key type %T", key.PublicKey)
+	}
+
+	return jwk, nil
+}
+
+// VerifyingKey parses the json web key into a verifying key bound to its algorithm.
+// Elliptic curve points are checked to be on the curve.
+func (j JWK) VerifyingKey() (VerifyingKey, error) {
+
+	if j.Use != "" && j.Use != UseSig {
+		return VerifyingKey{}, fmt.Errorf("jwk %q: use %q is not a signature key", j.Kid, j.Use)
+	}
+
+	if len(j.Kid) > KeyIdMax {
+		return VerifyingKey{}, fmt.Errorf("jwk kid must not exceed %d characters", KeyIdMax)
+	}
+
+	var key VerifyingKey
+	switch j.Kty {
+	case KtyEc:
+		pub, err := j.ecdsaPublicKey()
+		if err != nil {
+			return VerifyingKey{}, fmt.Errorf("jwk %q: %v", j.Kid, err)
+		}
+		key = VerifyingKey{KeyId: j.Kid, Alg: j.Alg, PublicKey: pub}
+
+	case KtyOkp:
+		if j.Crv != CrvEd25519 {
+			return VerifyingKey{}, fmt.Errorf("jwk %q: unsupported OKP curve %q", j.Kid, j.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return VerifyingKey{}, fmt.Errorf("jwk %q: x must be a %d byte base64url encoded ed25519 public key", j.Kid, ed25519.PublicKeySize)
+		}
+		key = VerifyingKey{KeyId: j.Kid, Alg: j.Alg, PublicKey: ed25519.PublicKey(x)}
+
+	default:
+		return VerifyingKey{}, fmt.Errorf("jwk %q: unsupported key type %q", j.Kid, j.Kty)
+	}
+
+	alg, err := bindAlgorithm(key)
+	if err != nil {
+		return VerifyingKey{}, fmt.Errorf("jwk %q: %v", j.Kid, err)
+	}
+	key.Alg = alg.Name()
+
+	return key, nil
+}
+
+// VerifyingKeys parses every key in the set into verifying keys.
+// Keys which cannot be used to verify signatures, eg, unsupported key types, are skipped as RFC 7517 requires;
+// an error is returned only if the set has no usable keys or duplicate key ids.
+func (s JWKSet) VerifyingKeys() ([]VerifyingKey, error) {
+
+	keys := make([]VerifyingKey, 0, len(s.Keys))
+	seen := make(map[string]struct{}, len(s.Keys))
+	for _, j := range s.Keys {
+
+		key, err := j.VerifyingKey()
+		if err != nil {
+			continue
+		}
+
+		if _, ok := seen[key.KeyId]; ok {
+			return nil, fmt.Errorf("duplicate jwk kid %q", key.KeyId)
+		}
+		seen[key.KeyId] = struct{}{}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwk set contains no usable verifying keys")
+	}
+
+	return keys, nil
+}
+
+// ecdsaPublicKey is a helper method which decodes an EC json web key's coordinates into an ecdsa public key.
+func (j JWK) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+
+	var (
+		curve elliptic.Curve
+		ecdhc ecdh.Curve
+	)
+	switch j.Crv {
+	case CrvP256:
+		curve, ecdhc = elliptic.P256(), ecdh.P256()
+	case CrvP384:
+		curve, ecdhc = elliptic.P384(), ecdh.P384()
+	case CrvP521:
+		curve, ecdhc = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("unsupported EC curve %q", j.Crv)
+	}
+
+	_, size, _ := curveParams(curve)
+
+	x, err := base64.RawURLEncoding.DecodeString(j.X)
+	if err != nil || len(x) != size {
+		return nil, fmt.Errorf("x must be a %d byte base64url encoded coordinate", size)
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(j.Y)
+	if err != nil || len(y) != size {
+		return nil, fmt.Errorf("y must be a %d byte base64url encoded coordinate", size)
+	}
+
+	// the ecdh parser rejects points which are not on the curve
+	point := append(append([]byte{4}, x...), y...)
+	if _, err := ecdhc.NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("invalid %s public key: %v", j.Crv, err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// curveParams is a helper function which returns the jwk curve name and coordinate size in bytes of an elliptic curve.
+func curveParams(curve elliptic.Curve) (string, int, error) {
+	switch curve {
+	case elliptic.P256():
+		return CrvP256, 32, nil
+	case elliptic.P384():
+		return CrvP384, 48, nil
+	case elliptic.P521():
+		return CrvP521, 66, nil
+	default:
+		return "", 0, fmt.Errorf("unsupported elliptic curve")
+	}
+}
+
+// bindAlgorithm is a helper function which returns the registered algorithm of a verifying key:
+// its alg if set, which must support the public key, or the algorithm determined by the public key type.
+func bindAlgorithm(key VerifyingKey) (Algorithm, error) {
+
+	if key.Alg == "" {
+		return AlgorithmForKey(key.PublicKey)
+	}
+
+	alg, err := LookupAlgorithm(key.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !alg.Supports(key.PublicKey) {
+		return nil, fmt.Errorf("public key type %T is not valid for alg %s", key.PublicKey, key.Alg)
+	}
+
+	return alg, nil
+}
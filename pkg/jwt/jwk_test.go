@@ -0,0 +1,207 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// ---- NewJWK / JWK.VerifyingKey ----
+
+func TestJWK_RoundTrip(t *testing.T) {
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate P-256 key: %v", err)
+	}
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate P-521 key: %v", err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     VerifyingKey
+		wantKty string
+		wantCrv string
+		wantAlg string
+	}{
+		{
+			name:    "es256",
+			key:     VerifyingKey{KeyId: "k-256", PublicKey: &p256.PublicKey},
+			wantKty: KtyEc,
+			wantCrv: CrvP256,
+			wantAlg: ES256,
+		},
+		{
+			name:    "es512",
+			key:     VerifyingKey{KeyId: "k-521", PublicKey: &p521.PublicKey},
+			wantKty: KtyEc,
+			wantCrv: CrvP521,
+			wantAlg: ES512,
+		},
+		{
+			name:    "eddsa",
+			key:     VerifyingKey{KeyId: "k-ed", PublicKey: edPub},
+			wantKty: KtyOkp,
+			wantCrv: CrvEd25519,
+			wantAlg: EdDSA,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwk, err := NewJWK(tt.key)
+			if err != nil {
+				t.Fatalf("NewJWK() error: %v", err)
+			}
+			if jwk.Kty != tt.wantKty || jwk.Crv != tt.wantCrv || jwk.Alg != tt.wantAlg {
+				t.Fatalf("jwk = %+v, want kty %q crv %q alg %q", jwk, tt.wantKty, tt.wantCrv, tt.wantAlg)
+			}
+			if jwk.Kid != tt.key.KeyId || jwk.Use != UseSig {
+				t.Errorf("jwk kid/use = %q/%q, want %q/%q", jwk.Kid, jwk.Use, tt.key.KeyId, UseSig)
+			}
+
+			// through json, as it would be served
+			b, err := json.Marshal(jwk)
+			if err != nil {
+				t.Fatalf("failed to marshal jwk: %v", err)
+			}
+			var parsed JWK
+			if err := json.Unmarshal(b, &parsed); err != nil {
+				t.Fatalf("failed to unmarshal jwk: %v", err)
+			}
+
+			key, err := parsed.VerifyingKey()
+			if err != nil {
+				t.Fatalf("VerifyingKey() error: %v", err)
+			}
+			if key.KeyId != tt.key.KeyId || key.Alg != tt.wantAlg {
+				t.Errorf("key id/alg = %q/%q, want %q/%q", key.KeyId, key.Alg, tt.key.KeyId, tt.wantAlg)
+			}
+
+			eq, ok := tt.key.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+			if ok && !eq.Equal(key.PublicKey) {
+				t.Errorf("round tripped public key does not equal the original")
+			}
+		})
+	}
+}
+
+func TestJWK_VerifyingKey_Invalid(t *testing.T) {
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate P-256 key: %v", err)
+	}
+	valid, err := NewJWK(VerifyingKey{KeyId: "k", PublicKey: &p256.PublicKey})
+	if err != nil {
+		t.Fatalf("NewJWK() error: %v", err)
+	}
+
+	// a point which is not on the curve
+	offCurve := valid
+	y, _ := base64.RawURLEncoding.DecodeString(valid.Y)
+	y[len(y)-1] ^= 0x01
+	offCurve.Y = base64.RawURLEncoding.EncodeToString(y)
+
+	wrongAlg := valid
+	wrongAlg.Alg = EdDSA
+
+	encUse := valid
+	encUse.Use = "enc"
+
+	shortX := valid
+	shortX.X = valid.X[:10]
+
+	tests := []struct {
+		name      string
+		jwk       JWK
+		errSubstr string
+	}{
+		{name: "point_not_on_curve", jwk: offCurve, errSubstr: "invalid P-256 public key"},
+		{name: "alg_does_not_match_key", jwk: wrongAlg, errSubstr: "not valid for alg"},
+		{name: "encryption_key", jwk: encUse, errSubstr: "not a signature key"},
+		{name: "short_coordinate", jwk: shortX, errSubstr: "x must be"},
+		{name: "unsupported_kty", jwk: JWK{Kty: "RSA", Kid: "r"}, errSubstr: "unsupported key type"},
+		{name: "unsupported_curve", jwk: JWK{Kty: KtyEc, Crv: "secp256k1"}, errSubstr: "unsupported EC curve"},
+		{name: "bad_ed25519_length", jwk: JWK{Kty: KtyOkp, Crv: CrvEd25519, X: "AAAA"}, errSubstr: "ed25519 public key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.jwk.VerifyingKey()
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.errSubstr) {
+				t.Errorf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+			}
+		})
+	}
+}
+
+// ---- JWKSet.VerifyingKeys ----
+
+func TestJWKSet_VerifyingKeys(t *testing.T) {
+
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+	jwk, err := NewJWK(VerifyingKey{KeyId: "k-ed", PublicKey: edPub})
+	if err != nil {
+		t.Fatalf("NewJWK() error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		set       JWKSet
+		wantKeys  int
+		errSubstr string
+	}{
+		{
+			name:     "unusable_keys_skipped",
+			set:      JWKSet{Keys: []JWK{{Kty: "RSA", Kid: "rsa"}, jwk}},
+			wantKeys: 1,
+		},
+		{
+			name:      "no_usable_keys",
+			set:       JWKSet{Keys: []JWK{{Kty: "RSA", Kid: "rsa"}}},
+			errSubstr: "no usable verifying keys",
+		},
+		{
+			name:      "duplicate_kid",
+			set:       JWKSet{Keys: []JWK{jwk, jwk}},
+			errSubstr: "duplicate jwk kid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := tt.set.VerifyingKeys()
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %v", tt.errSubstr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(keys) != tt.wantKeys {
+				t.Errorf("got %d keys, want %d", len(keys), tt.wantKeys)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package jwt
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// revocationGrace is how long a revoked jti is retained past its token's expiry,
+// so clock skew between services cannot reopen the revocation window.
+const revocationGrace = time.Minute
+
+// RevocationStore is a denylist of revoked tokens which the Verifier checks after a token's signature is verified.
+// Tokens are revoked individually by jti, or in bulk by subject for all tokens issued at or before a cutoff,
+// eg, to kill every session of a compromised account immediately rather than waiting for token expiry.
+type RevocationStore interface {
+
+	// IsRevoked reports whether the token with the given jti, subject, and issued at (unix seconds) is revoked.
+	IsRevoked(jti, subject string, issuedAt int64) (bool, error)
+
+	// RevokeJti revokes a single token by jti.
+	// The revocation is retained until the token's expiry, after which the token is invalid regardless.
+	RevokeJti(jti string, expires time.Time) error
+
+	// RevokeSubject revokes all tokens for the subject issued at or before the cutoff.
+	// Tokens issued after the cutoff, eg, after re-authentication, are not affected.
+	RevokeSubject(subject string, before time.Time) error
+
+	// PurgeExpired removes revocations which can no longer match an unexpired token.
+	PurgeExpired() error
+}
+
+// NewMemoryRevocationStore creates a new in-memory RevocationStore.
+// maxTokenLifetime is the longest lifetime of any token checked against the store:
+// a subject revocation is dropped once every token it covers has expired.
+// Note: revocations are not shared between instances and are lost on restart.
+func NewMemoryRevocationStore(maxTokenLifetime time.Duration) RevocationStore {
+	return &memoryRevocationStore{
+		maxTokenLifetime: maxTokenLifetime,
+		jtis:             make(map[string]time.Time),
+		subjects:         make(map[string]time.Time),
+	}
+}
+
+var _ RevocationStore = (*memoryRevocationStore)(nil)
+
+// memoryRevocationStore is the concrete in-memory implementation of the RevocationStore interface.
+type memoryRevocationStore struct {
+	maxTokenLifetime time.Duration
+
+	mu       sync.RWMutex
+	jtis     map[string]time.Time // jti -> token expiry
+	subjects map[string]time.Time // subject -> revoked before cutoff
+}
+
+// IsRevoked implements the RevocationStore interface.
+func (s *memoryRevocationStore) IsRevoked(jti, subject string, issuedAt int64) (bool, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if jti != "" {
+		if _, ok := s.jtis[jti]; ok {
+			return true, nil
+		}
+	}
+
+	if cutoff, ok := s.subjects[subject]; ok && issuedAt <= cutoff.Unix() {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// RevokeJti implements the RevocationStore interface.
+func (s *memoryRevocationStore) RevokeJti(jti string, expires time.Time) error {
+
+	if jti == "" {
+		return fmt.Errorf("jti is required to revoke a token")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(time.Now())
+
+	if existing, ok := s.jtis[jti]; !ok || expires.After(existing) {
+		s.jtis[jti] = expires
+	}
+
+	return nil
+}
+
+// RevokeSubject implements the RevocationStore interface.
+func (s *memoryRevocationStore) RevokeSubject(subject string, before time.Time) error {
+
+	if subject == "" {
+		return fmt.Errorf("subject is required to revoke tokens")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(time.Now())
+
+	// never move a cutoff backwards
+	if existing, ok := s.subjects[subject]; !ok || before.After(existing) {
+		s.subjects[subject] = before
+	}
+
+	return nil
+}
+
+// PurgeExpired implements the RevocationStore interface.
+func (s *memoryRevocationStore) PurgeExpired() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(time.Now())
+
+	return nil
+}
+
+// purge removes expired revocations.  The caller must hold the write lock.
+func (s *memoryRevocationStore) purge(now time.Time) {
+
+	for jti, expires := range s.jtis {
+		if now.After(expires.Add(revocationGrace)) {
+			delete(s.jtis, jti)
+		}
+	}
+
+	for subject, cutoff := range s.subjects {
+		if now.After(cutoff.Add(s.maxTokenLifetime + revocationGrace)) {
+			delete(s.subjects, subject)
+		}
+	}
+}
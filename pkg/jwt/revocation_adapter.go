@@ -0,0 +1,156 @@
+package jwt
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/data"
+)
+
+// RevokedJtiRecord is the database model of a token revoked by jti.
+type RevokedJtiRecord struct {
+	Jti       string          `db:"jti"`
+	ExpiresAt data.CustomTime `db:"expires_at"`
+}
+
+// RevokedSubjectRecord is the database model of a subject whose tokens issued at or before a cutoff are revoked.
+// The subject is stored as a blind index since it is often an email address.
+type RevokedSubjectRecord struct {
+	SubjectIndex  string          `db:"subject_index"`
+	RevokedBefore data.CustomTime `db:"revoked_before"`
+}
+
+// NewSqlRevocationStore creates a new RevocationStore backed by the revoked_jti and revoked_subject tables,
+// so revocations are shared between service instances and survive restarts.
+// maxTokenLifetime is the longest lifetime of any token checked against the store, used when purging.
+func NewSqlRevocationStore(db *sql.DB, indexer data.Indexer, maxTokenLifetime time.Duration) RevocationStore {
+	return &sqlRevocationStore{
+		sql:              db,
+		indexer:          indexer,
+		maxTokenLifetime: maxTokenLifetime,
+	}
+}
+
+var _ RevocationStore = (*sqlRevocationStore)(nil)
+
+// sqlDB combines Selector and Execer so the store field can be satisfied by
+// *sql.DB in production and by a mock in tests.
+type sqlDB interface {
+	data.Selector
+	data.Execer
+}
+
+// sqlRevocationStore is the concrete sql implementation of the RevocationStore interface.
+type sqlRevocationStore struct {
+	sql              sqlDB
+	indexer          data.Indexer
+	maxTokenLifetime time.Duration
+}
+
+// IsRevoked implements the RevocationStore interface.
+func (s *sqlRevocationStore) IsRevoked(jti, subject string, issuedAt int64) (bool, error) {
+
+	index, err := s.indexer.ObtainBlindIndex(subject)
+	if err != nil {
+		return false, fmt.Errorf("failed to obtain blind index for subject: %v", err)
+	}
+
+	qry := `
+		SELECT
+			EXISTS (
+				SELECT 1
+				FROM revoked_jti
+				WHERE jti = ?
+			)
+			OR EXISTS (
+				SELECT 1
+				FROM revoked_subject
+				WHERE subject_index = ?
+					AND revoked_before >= ?
+			)`
+
+	revoked, err := data.SelectExists(s.sql, qry, jti, index, time.Unix(issuedAt, 0).UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to look up token revocation: %v", err)
+	}
+
+	return revoked, nil
+}
+
+// RevokeJti implements the RevocationStore interface.
+func (s *sqlRevocationStore) RevokeJti(jti string, expires time.Time) error {
+
+	if jti == "" {
+		return fmt.Errorf("jti is required to revoke a token")
+	}
+
+	qry := `
+		INSERT INTO revoked_jti (
+			jti,
+			expires_at
+		) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE expires_at = GREATEST(expires_at, VALUES(expires_at))`
+
+	record := RevokedJtiRecord{
+		Jti:       jti,
+		ExpiresAt: data.CustomTime{Time: expires.UTC()},
+	}
+
+	if err := data.InsertRecord(s.sql, qry, record); err != nil {
+		return fmt.Errorf("failed to revoke jti: %v", err)
+	}
+
+	return nil
+}
+
+// RevokeSubject implements the RevocationStore interface.
+func (s *sqlRevocationStore) RevokeSubject(subject string, before time.Time) error {
+
+	if subject == "" {
+		return fmt.Errorf("subject is required to revoke tokens")
+	}
+
+	index, err := s.indexer.ObtainBlindIndex(subject)
+	if err != nil {
+		return fmt.Errorf("failed to obtain blind index for subject: %v", err)
+	}
+
+	// never move a cutoff backwards
+	qry := `
+		INSERT INTO revoked_subject (
+			subject_index,
+			revoked_before
+		) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE revoked_before = GREATEST(revoked_before, VALUES(revoked_before))`
+
+	record := RevokedSubjectRecord{
+		SubjectIndex: index,
+		// truncated to the second to match token issued at precision
+		RevokedBefore: data.CustomTime{Time: before.UTC().Truncate(time.Second)},
+	}
+
+	if err := data.InsertRecord(s.sql, qry, record); err != nil {
+		return fmt.Errorf("failed to revoke subject: %v", err)
+	}
+
+	return nil
+}
+
+// PurgeExpired implements the RevocationStore interface.
+func (s *sqlRevocationStore) PurgeExpired() error {
+
+	now := time.Now().UTC()
+
+	qry := `DELETE FROM revoked_jti WHERE expires_at < ?`
+	if err := data.DeleteRecord(s.sql, qry, now.Add(-revocationGrace)); err != nil {
+		return fmt.Errorf("failed to purge expired jti revocations: %v", err)
+	}
+
+	qry = `DELETE FROM revoked_subject WHERE revoked_before < ?`
+	if err := data.DeleteRecord(s.sql, qry, now.Add(-(s.maxTokenLifetime + revocationGrace))); err != nil {
+		return fmt.Errorf("failed to purge expired subject revocations: %v", err)
+	}
+
+	return nil
+}
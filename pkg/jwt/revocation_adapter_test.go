@@ -0,0 +1,152 @@
+package jwt
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Adapter tests verify SQL query structure and error propagation at the DB boundary.
+//
+// Success paths for IsRevoked require constructing a real *sql.Row,
+// which is not possible without a registered driver.
+
+// mockSqlDB implements the sqlDB interface for testing.
+type mockSqlDB struct {
+	prepareFunc func(string) (*sql.Stmt, error)
+}
+
+func (m *mockSqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) { return nil, nil }
+func (m *mockSqlDB) QueryRow(query string, args ...interface{}) *sql.Row        { return nil }
+func (m *mockSqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *mockSqlDB) Prepare(query string) (*sql.Stmt, error) {
+	if m.prepareFunc != nil {
+		return m.prepareFunc(query)
+	}
+	return nil, nil
+}
+
+var _ sqlDB = (*mockSqlDB)(nil)
+
+// mockIndexer implements data.Indexer for testing.
+type mockIndexer struct {
+	err error
+}
+
+func (m *mockIndexer) ObtainBlindIndex(input string) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	return "idx-" + input, nil
+}
+
+func TestSqlRevocationStore_Revoke(t *testing.T) {
+	tests := []struct {
+		name       string
+		revoke     func(RevocationStore) error
+		indexErr   error
+		prepareErr error
+		wantErr    bool
+		errSubstr  string
+		checkQuery func(*testing.T, string)
+	}{
+		{
+			name:      "jti_empty",
+			revoke:    func(s RevocationStore) error { return s.RevokeJti("", time.Now()) },
+			wantErr:   true,
+			errSubstr: "jti is required",
+		},
+		{
+			name:       "jti_prepare_error_propagated",
+			revoke:     func(s RevocationStore) error { return s.RevokeJti("some-jti", time.Now()) },
+			prepareErr: errors.New("too many connections"),
+			wantErr:    true,
+			errSubstr:  "too many connections",
+			checkQuery: func(t *testing.T, q string) {
+				for _, expected := range []string{"INSERT INTO revoked_jti", "jti", "expires_at", "ON DUPLICATE KEY UPDATE"} {
+					if !strings.Contains(q, expected) {
+						t.Errorf("query missing %q:\n%s", expected, q)
+					}
+				}
+			},
+		},
+		{
+			name:      "subject_empty",
+			revoke:    func(s RevocationStore) error { return s.RevokeSubject("", time.Now()) },
+			wantErr:   true,
+			errSubstr: "subject is required",
+		},
+		{
+			name:      "subject_index_error_propagated",
+			revoke:    func(s RevocationStore) error { return s.RevokeSubject("user@example.com", time.Now()) },
+			indexErr:  errors.New("hmac failure"),
+			wantErr:   true,
+			errSubstr: "hmac failure",
+		},
+		{
+			name:       "subject_prepare_error_propagated",
+			revoke:     func(s RevocationStore) error { return s.RevokeSubject("user@example.com", time.Now()) },
+			prepareErr: errors.New("too many connections"),
+			wantErr:    true,
+			errSubstr:  "too many connections",
+			checkQuery: func(t *testing.T, q string) {
+				for _, expected := range []string{"INSERT INTO revoked_subject", "subject_index", "revoked_before", "GREATEST"} {
+					if !strings.Contains(q, expected) {
+						t.Errorf("query missing %q:\n%s", expected, q)
+					}
+				}
+			},
+		},
+		{
+			name:       "purge_prepare_error_propagated",
+			revoke:     func(s RevocationStore) error { return s.PurgeExpired() },
+			prepareErr: errors.New("too many connections"),
+			wantErr:    true,
+			errSubstr:  "too many connections",
+			checkQuery: func(t *testing.T, q string) {
+				if !strings.Contains(q, "DELETE FROM revoked_jti") {
+					t.Errorf("query missing %q:\n%s", "DELETE FROM revoked_jti", q)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capturedQuery string
+			db := &mockSqlDB{
+				prepareFunc: func(query string) (*sql.Stmt, error) {
+					capturedQuery = query
+					return nil, tt.prepareErr
+				},
+			}
+			store := &sqlRevocationStore{sql: db, indexer: &mockIndexer{err: tt.indexErr}, maxTokenLifetime: time.Hour}
+			err := tt.revoke(store)
+
+			if tt.checkQuery != nil {
+				tt.checkQuery(t, capturedQuery)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("error %q does not contain %q", err.Error(), tt.errSubstr)
+				}
+			}
+		})
+	}
+}
+
+func TestSqlRevocationStore_IsRevoked_IndexError(t *testing.T) {
+	store := &sqlRevocationStore{sql: &mockSqlDB{}, indexer: &mockIndexer{err: errors.New("hmac failure")}}
+
+	if _, err := store.IsRevoked("some-jti", "user@example.com", time.Now().Unix()); err == nil || !strings.Contains(err.Error(), "hmac failure") {
+		t.Fatalf("expected index error, got %v", err)
+	}
+}
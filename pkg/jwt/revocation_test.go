@@ -0,0 +1,169 @@
+package jwt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// ---- MemoryRevocationStore -------------------------------------------------
+
+func TestMemoryRevocationStore_IsRevoked(t *testing.T) {
+	now := time.Now()
+
+	store := NewMemoryRevocationStore(time.Hour)
+	if err := store.RevokeJti("revoked-jti", now.Add(time.Hour)); err != nil {
+		t.Fatalf("unexpected error revoking jti: %v", err)
+	}
+	if err := store.RevokeSubject("compromised@example.com", now); err != nil {
+		t.Fatalf("unexpected error revoking subject: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		jti      string
+		subject  string
+		issuedAt int64
+		want     bool
+	}{
+		{
+			name:     "jti_revoked",
+			jti:      "revoked-jti",
+			subject:  "user@example.com",
+			issuedAt: now.Unix(),
+			want:     true,
+		},
+		{
+			name:     "jti_not_revoked",
+			jti:      "other-jti",
+			subject:  "user@example.com",
+			issuedAt: now.Unix(),
+			want:     false,
+		},
+		{
+			name:     "subject_token_issued_before_cutoff",
+			jti:      "other-jti",
+			subject:  "compromised@example.com",
+			issuedAt: now.Add(-time.Minute).Unix(),
+			want:     true,
+		},
+		{
+			// iat has second precision, so a token issued in the cutoff second is revoked
+			name:     "subject_token_issued_in_cutoff_second",
+			jti:      "other-jti",
+			subject:  "compromised@example.com",
+			issuedAt: now.Unix(),
+			want:     true,
+		},
+		{
+			name:     "subject_token_issued_after_cutoff",
+			jti:      "other-jti",
+			subject:  "compromised@example.com",
+			issuedAt: now.Add(time.Minute).Unix(),
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.IsRevoked(tt.jti, tt.subject, tt.issuedAt)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IsRevoked: want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationStore_Revoke(t *testing.T) {
+	tests := []struct {
+		name      string
+		revoke    func(RevocationStore) error
+		wantErr   bool
+		errSubstr string
+	}{
+		{
+			name:      "empty_jti",
+			revoke:    func(s RevocationStore) error { return s.RevokeJti("", time.Now().Add(time.Hour)) },
+			wantErr:   true,
+			errSubstr: "jti is required",
+		},
+		{
+			name:      "empty_subject",
+			revoke:    func(s RevocationStore) error { return s.RevokeSubject("", time.Now()) },
+			wantErr:   true,
+			errSubstr: "subject is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.revoke(NewMemoryRevocationStore(time.Hour))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationStore_SubjectCutoffNeverMovesBackwards(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryRevocationStore(time.Hour)
+
+	if err := store.RevokeSubject("user@example.com", now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.RevokeSubject("user@example.com", now.Add(-time.Hour)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	revoked, err := store.IsRevoked("", "user@example.com", now.Add(-time.Minute).Unix())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !revoked {
+		t.Error("earlier cutoff replaced the later one")
+	}
+}
+
+func TestMemoryRevocationStore_PurgeExpired(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryRevocationStore(time.Minute)
+
+	// both revocations can no longer match an unexpired token
+	if err := store.RevokeJti("expired-jti", now.Add(-2*revocationGrace)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.RevokeSubject("user@example.com", now.Add(-time.Minute-2*revocationGrace)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.RevokeJti("live-jti", now.Add(time.Hour)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := store.PurgeExpired(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m := store.(*memoryRevocationStore)
+	if _, ok := m.jtis["expired-jti"]; ok {
+		t.Error("expired jti revocation was not purged")
+	}
+	if _, ok := m.subjects["user@example.com"]; ok {
+		t.Error("expired subject revocation was not purged")
+	}
+	if _, ok := m.jtis["live-jti"]; !ok {
+		t.Error("live jti revocation was purged")
+	}
+}
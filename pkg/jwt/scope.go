@@ -0,0 +1,145 @@
+package jwt
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// ScopeWildcard grants every resource at its level of a scope's resource hierarchy, eg, w:gallery:*.
+	ScopeWildcard string = "*"
+
+	// scopeSeparator separates a scope's action, service, and resource hierarchy, eg, w:gallery:album:photo.
+	scopeSeparator string = ":"
+)
+
+// ScopeMatch is the matching mode used when checking granted scopes against required scopes.
+type ScopeMatch int
+
+const (
+	// MatchAny authorizes when at least one required scope is satisfied by a granted scope.
+	MatchAny ScopeMatch = iota
+
+	// MatchAll authorizes only when every required scope is satisfied by a granted scope.
+	MatchAll
+)
+
+// Scope is a parsed scope value: an action, eg, r, w, or d, a service name,
+// and a resource which may be hierarchical (album:photo) and end in a wildcard (album:*).
+type Scope struct {
+	Action   string
+	Service  string
+	Resource string // empty if the scope has no resource part, eg, r:gallery
+}
+
+// ParseScope parses a scope string in the format action:service[:resource[:...]].
+func ParseScope(s string) (Scope, error) {
+
+	parts := strings.SplitN(strings.TrimSpace(s), scopeSeparator, 3)
+	if len(parts) < 2 {
+		return Scope{}, fmt.Errorf("invalid scope %q: must contain an action and a service name", s)
+	}
+
+	scope := Scope{
+		Action:  parts[0],
+		Service: parts[1],
+	}
+	if len(parts) == 3 {
+		scope.Resource = parts[2]
+	}
+
+	if scope.Action == "" || scope.Service == "" {
+		return Scope{}, fmt.Errorf("invalid scope %q: action and service name must not be empty", s)
+	}
+
+	if len(parts) == 3 {
+		for _, seg := range strings.Split(scope.Resource, scopeSeparator) {
+			if seg == "" {
+				return Scope{}, fmt.Errorf("invalid scope %q: resource segments must not be empty", s)
+			}
+		}
+	}
+
+	return scope, nil
+}
+
+// String returns the scope in its string format.
+func (s Scope) String() string {
+	if s.Resource == "" {
+		return s.Action + scopeSeparator + s.Service
+	}
+	return s.Action + scopeSeparator + s.Service + scopeSeparator + s.Resource
+}
+
+// Satisfies reports whether the granted scope s satisfies the required scope.
+// The action and service must match exactly.  A granted resource wildcard satisfies any resource at or below
+// its level, eg, w:gallery:* satisfies w:gallery:album and w:gallery:album:* satisfies w:gallery:album:photo.
+// A wildcard in the required scope is literal: r:gallery:* is only satisfied by a granted r:gallery:*.
+func (s Scope) Satisfies(required Scope) bool {
+
+	if s.Action != required.Action || s.Service != required.Service {
+		return false
+	}
+
+	if s.Resource == required.Resource {
+		return true
+	}
+
+	if s.Resource == ScopeWildcard {
+		return true
+	}
+
+	// hierarchical wildcard, eg, album:* covers album:photo and album:photo:exif
+	if prefix, ok := strings.CutSuffix(s.Resource, scopeSeparator+ScopeWildcard); ok {
+		return strings.HasPrefix(required.Resource, prefix+scopeSeparator)
+	}
+
+	return false
+}
+
+// MatchScopes reports whether the granted scopes satisfy the required scopes under the matching mode.
+// A granted scope always satisfies the identical required scope, so scopes which are not in the
+// action:service[:resource] format, eg, admin, still match exactly; only parsed scopes match by wildcard.
+// No required scopes never matches: authorization is deny-by-default.
+func MatchScopes(granted, required []string, mode ScopeMatch) bool {
+
+	if len(granted) == 0 || len(required) == 0 {
+		return false
+	}
+
+	grants := make([]Scope, 0, len(granted))
+	for _, g := range granted {
+		if scope, err := ParseScope(g); err == nil {
+			grants = append(grants, scope)
+		}
+	}
+
+	for _, r := range required {
+
+		satisfied := slices.Contains(granted, r)
+		if !satisfied {
+			req, err := ParseScope(r)
+			satisfied = err == nil && satisfiedBy(req, grants)
+		}
+
+		switch {
+		case mode == MatchAll && !satisfied:
+			return false
+		case mode != MatchAll && satisfied:
+			return true
+		}
+	}
+
+	return mode == MatchAll
+}
+
+// satisfiedBy is a helper function which reports whether any granted scope satisfies the required scope.
+func satisfiedBy(required Scope, grants []Scope) bool {
+	for _, g := range grants {
+		if g.Satisfies(required) {
+			return true
+		}
+	}
+	return false
+}
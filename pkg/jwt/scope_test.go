@@ -0,0 +1,226 @@
+package jwt
+
+import (
+	"strings"
+	"testing"
+)
+
+// ---- ParseScope ------------------------------------------------------------
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		scope     string
+		want      Scope
+		wantErr   bool
+		errSubstr string
+	}{
+		{
+			name:  "service_wildcard",
+			scope: "r:gallery:*",
+			want:  Scope{Action: "r", Service: "gallery", Resource: "*"},
+		},
+		{
+			name:  "single_resource",
+			scope: "w:gallery:album",
+			want:  Scope{Action: "w", Service: "gallery", Resource: "album"},
+		},
+		{
+			name:  "hierarchical_resource",
+			scope: "w:gallery:album:photo",
+			want:  Scope{Action: "w", Service: "gallery", Resource: "album:photo"},
+		},
+		{
+			name:  "no_resource",
+			scope: "r:gallery",
+			want:  Scope{Action: "r", Service: "gallery"},
+		},
+		{
+			name:      "action_only",
+			scope:     "r",
+			wantErr:   true,
+			errSubstr: "must contain an action and a service name",
+		},
+		{
+			name:      "empty_service",
+			scope:     "r::album",
+			wantErr:   true,
+			errSubstr: "must not be empty",
+		},
+		{
+			name:      "empty_resource_segment",
+			scope:     "r:gallery:album::photo",
+			wantErr:   true,
+			errSubstr: "resource segments must not be empty",
+		},
+		{
+			name:      "trailing_separator",
+			scope:     "r:gallery:",
+			wantErr:   true,
+			errSubstr: "resource segments must not be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScope(tt.scope)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseScope: want %+v, got %+v", tt.want, got)
+			}
+			if got.String() != tt.scope {
+				t.Errorf("String: want %q, got %q", tt.scope, got.String())
+			}
+		})
+	}
+}
+
+// ---- Satisfies -------------------------------------------------------------
+
+func TestScopeSatisfies(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  string
+		required string
+		want     bool
+	}{
+		{name: "exact_match", granted: "w:gallery:album", required: "w:gallery:album", want: true},
+		{name: "exact_wildcard_match", granted: "r:gallery:*", required: "r:gallery:*", want: true},
+		{name: "wildcard_covers_resource", granted: "w:gallery:*", required: "w:gallery:album", want: true},
+		{name: "wildcard_covers_nested_resource", granted: "w:gallery:*", required: "w:gallery:album:photo", want: true},
+		{name: "wildcard_covers_no_resource", granted: "w:gallery:*", required: "w:gallery", want: true},
+		{name: "nested_wildcard_covers_child", granted: "w:gallery:album:*", required: "w:gallery:album:photo", want: true},
+		{name: "nested_wildcard_does_not_cover_parent", granted: "w:gallery:album:*", required: "w:gallery:album", want: false},
+		{name: "nested_wildcard_does_not_cover_sibling", granted: "w:gallery:album:*", required: "w:gallery:albums:photo", want: false},
+		{name: "required_wildcard_is_literal", granted: "w:gallery:album", required: "w:gallery:*", want: false},
+		{name: "nested_wildcard_does_not_cover_service_wildcard", granted: "w:gallery:album:*", required: "w:gallery:*", want: false},
+		{name: "different_action", granted: "r:gallery:*", required: "w:gallery:album", want: false},
+		{name: "different_service", granted: "w:gallery:*", required: "w:galleryx:album", want: false},
+		{name: "partial_resource_name", granted: "w:gallery:album", required: "w:gallery:albums", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := ParseScope(tt.granted)
+			if err != nil {
+				t.Fatalf("failed to parse granted scope: %v", err)
+			}
+			r, err := ParseScope(tt.required)
+			if err != nil {
+				t.Fatalf("failed to parse required scope: %v", err)
+			}
+			if got := g.Satisfies(r); got != tt.want {
+				t.Errorf("%q satisfies %q: want %v, got %v", tt.granted, tt.required, tt.want, got)
+			}
+		})
+	}
+}
+
+// ---- MatchScopes -----------------------------------------------------------
+
+func TestMatchScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  []string
+		required []string
+		mode     ScopeMatch
+		want     bool
+	}{
+		{
+			name:     "any_one_satisfied",
+			granted:  []string{"r:gallery:*"},
+			required: []string{"w:gallery:album", "r:gallery:album"},
+			mode:     MatchAny,
+			want:     true,
+		},
+		{
+			name:     "any_none_satisfied",
+			granted:  []string{"r:other:*"},
+			required: []string{"w:gallery:album", "r:gallery:album"},
+			mode:     MatchAny,
+			want:     false,
+		},
+		{
+			name:     "all_satisfied_by_wildcards",
+			granted:  []string{"r:gallery:*", "w:gallery:album:*"},
+			required: []string{"r:gallery:album", "w:gallery:album:photo"},
+			mode:     MatchAll,
+			want:     true,
+		},
+		{
+			name:     "all_one_missing",
+			granted:  []string{"r:gallery:*"},
+			required: []string{"r:gallery:album", "w:gallery:album"},
+			mode:     MatchAll,
+			want:     false,
+		},
+		{
+			name:     "no_required_scopes_denied",
+			granted:  []string{"r:gallery:*"},
+			required: nil,
+			mode:     MatchAll,
+			want:     false,
+		},
+		{
+			name:     "no_granted_scopes_denied",
+			granted:  nil,
+			required: []string{"r:gallery:album"},
+			mode:     MatchAny,
+			want:     false,
+		},
+		{
+			name:     "malformed_granted_scope_ignored",
+			granted:  []string{"gallery", "r:gallery:album"},
+			required: []string{"r:gallery:album"},
+			mode:     MatchAll,
+			want:     true,
+		},
+		{
+			name:     "unparsed_required_scope_not_satisfied_by_wildcard",
+			granted:  []string{"r:gallery:*"},
+			required: []string{"r:gallery:album", "gallery"},
+			mode:     MatchAll,
+			want:     false,
+		},
+		{
+			name:     "non_colon_scope_matches_exactly",
+			granted:  []string{"admin", "r:gallery:*"},
+			required: []string{"admin", "r:gallery:album"},
+			mode:     MatchAll,
+			want:     true,
+		},
+		{
+			name:     "non_colon_scope_any",
+			granted:  []string{"read_all"},
+			required: []string{"w:gallery:album", "read_all"},
+			mode:     MatchAny,
+			want:     true,
+		},
+		{
+			name:     "non_colon_scope_different",
+			granted:  []string{"admin"},
+			required: []string{"administrator"},
+			mode:     MatchAny,
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchScopes(tt.granted, tt.required, tt.mode); got != tt.want {
+				t.Errorf("MatchScopes: want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
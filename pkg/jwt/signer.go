@@ -1,9 +1,7 @@
 package jwt
 
 import (
-	"crypto/ecdsa"
-	"crypto/rand"
-	"crypto/sha512"
+	"crypto"
 	"encoding/base64"
 	"fmt"
 )
@@ -17,16 +15,43 @@ type Signer interface {
 	Mint(*Token) error
 }
 
-func NewSigner(priv *ecdsa.PrivateKey) Signer {
-	return &signer{
+// SignerOption is a functional option for configuring the Signer.
+type SignerOption func(*signer)
+
+// WithKeyId sets the key id (kid) the signer stamps into the header of every token it mints,
+// so verifiers holding more than one key can select the correct one during key rotation.
+func WithKeyId(kid string) SignerOption {
+	return func(s *signer) { s.KeyId = kid }
+}
+
+// NewSigner creates a new Signer with the provided private key and options.
+// The signing algorithm is determined by the key type, eg, *ecdsa.PrivateKey on P-521 signs ES512,
+// on P-256 signs ES256, and ed25519.PrivateKey signs EdDSA.  Tokens to be minted must carry the matching alg.
+func NewSigner(priv crypto.Signer, opts ...SignerOption) Signer {
+
+	s := &signer{
 		PrivateKey: priv,
 	}
+
+	// unsupported key types are surfaced when minting
+	if alg, err := AlgorithmForKey(priv); err == nil {
+		s.Algorithm = alg
+	}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 var _ Signer = (*signer)(nil)
 
 type signer struct {
-	PrivateKey *ecdsa.PrivateKey
+	PrivateKey crypto.Signer
+	Algorithm  Algorithm // bound to the private key type
+	KeyId      string    // optional: stamped into the jwt header kid field
 }
 
 // createSignature takes the BaseString (msg) comprised of
@@ -48,28 +73,19 @@ func (sgn *signer) createSignature(msg string, jwt *Token) error {
 		return fmt.Errorf("failed to create jwt signature: invalid token claims: %w", err)
 	}
 
-	// hash to sha512
-	hasher := sha512.New()
-	hasher.Write([]byte(msg))
-	hashedMsg := hasher.Sum(nil)
-
-	// sign with ecdsa 512 priv key
-	r, s, err := ecdsa.Sign(rand.Reader, sgn.PrivateKey, hashedMsg)
-	if err != nil {
-		return fmt.Errorf("failed to sign jwt token msg: %w", err)
+	// strict alg-to-key binding: the header alg must be the signing key's algorithm
+	if sgn.Algorithm == nil {
+		return fmt.Errorf("unsupported signing key type %T", sgn.PrivateKey)
 	}
 
-	// validate length in bits
-	curveBytes := sgn.PrivateKey.Curve.Params().BitSize
-	keyBytes := curveBytes / 8
-	if curveBytes%8 > 0 {
-		keyBytes++
+	if jwt.Header.Alg != sgn.Algorithm.Name() {
+		return fmt.Errorf("invalid token header: alg %q does not match signing key alg %q", jwt.Header.Alg, sgn.Algorithm.Name())
 	}
 
-	// serialize r and s
-	out := make([]byte, 2*keyBytes)
-	r.FillBytes(out[0:keyBytes])
-	s.FillBytes(out[keyBytes:])
+	out, err := sgn.Algorithm.Sign(sgn.PrivateKey, []byte(msg))
+	if err != nil {
+		return err
+	}
 
 	jwt.Signature = out
 
@@ -79,9 +95,15 @@ func (sgn *signer) createSignature(msg string, jwt *Token) error {
 
 // Mint implements the Signer interface and creates, appends a cryptographic signature to the jwt Token.Signature field.
 // It also creates, appends the base64 encoded token to the jwt Token struct
-// Mint assumes the jwt Token.Header and jwt Token.Claims fields are already populated
+// Mint assumes the jwt Token.Header and jwt Token.Claims fields are already populated.
+// If the signer was created with a key id, it is stamped into the header before signing.
 func (sgn *signer) Mint(jwt *Token) error {
 
+	// stamp key id so verifiers can select the correct key
+	if sgn.KeyId != "" {
+		jwt.Header.Kid = sgn.KeyId
+	}
+
 	msg, err := jwt.BuildBaseString()
 	if err != nil {
 		return fmt.Errorf("failed to create jwt signature base string(message): %w", err)
@@ -152,6 +152,21 @@ func TestMint(t *testing.T) {
 				}
 			},
 		},
+		{
+			// a signer without a key id leaves the header kid untouched.
+			name:    "no_kid_when_signer_has_no_key_id",
+			token:   newToken(),
+			wantErr: false,
+			check: func(t *testing.T, tok *Token) {
+				parsed, err := BuildTokenFromRaw(tok.Raw)
+				if err != nil {
+					t.Fatalf("BuildTokenFromRaw failed on minted token: %v", err)
+				}
+				if parsed.Header.Kid != "" {
+					t.Errorf("kid: want empty, got %q", parsed.Header.Kid)
+				}
+			},
+		},
 		{
 			name: "invalid_header_alg_rejected",
 			token: &Token{
@@ -161,6 +176,16 @@ func TestMint(t *testing.T) {
 			wantErr:   true,
 			errSubstr: "invalid token header",
 		},
+		{
+			// strict alg-to-key binding: a registered alg which is not the signing key's alg is rejected
+			name: "header_alg_does_not_match_signing_key",
+			token: &Token{
+				Header: Header{Alg: ES256, Typ: TokenType},
+				Claims: baseClaims,
+			},
+			wantErr:   true,
+			errSubstr: "does not match signing key alg",
+		},
 		{
 			name: "invalid_header_alg_none_rejected",
 			token: &Token{
@@ -232,3 +257,40 @@ func TestMint(t *testing.T) {
 		})
 	}
 }
+
+func TestMint_WithKeyId(t *testing.T) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+
+	s := NewSigner(privKey, WithKeyId("s2s-2025-06"))
+
+	now := time.Now().UTC()
+	tok := &Token{
+		// a stale kid set by the caller is overwritten by the signer's key id
+		Header: Header{Alg: ES512, Typ: TokenType, Kid: "stale"},
+		Claims: Claims{
+			Issuer:   "https://auth.example.com",
+			Subject:  "user@example.com",
+			Audience: []string{"service-a"},
+			IssuedAt: now.Unix(),
+			Expires:  now.Add(time.Hour).Unix(),
+		},
+	}
+	if err := s.Mint(tok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tok.Header.Kid != "s2s-2025-06" {
+		t.Errorf("token header kid: want %q, got %q", "s2s-2025-06", tok.Header.Kid)
+	}
+
+	parsed, err := BuildTokenFromRaw(tok.Raw)
+	if err != nil {
+		t.Fatalf("BuildTokenFromRaw failed on minted token: %v", err)
+	}
+	if parsed.Header.Kid != "s2s-2025-06" {
+		t.Errorf("parsed header kid: want %q, got %q", "s2s-2025-06", parsed.Header.Kid)
+	}
+}
@@ -25,32 +25,44 @@ const (
 )
 
 const (
-	ES512     string = "ES512" // alg
+	ES512     string = "ES512" // alg: ecdsa P-521 with sha512
 	TokenType string = "JWT"
-	Keysize   int    = 66 // ecdsa 512 spec
+	Keysize   int    = 66 // ecdsa 512 spec: bytes per ES512 signature component
+
+	// KeyIdMax is the maximum length of a key id (kid) allowed in a jwt header.
+	KeyIdMax int = 64
 )
 
-// Header is the first part of a jwt incluiding the signing algorithm and token type
+// Header is the first part of a jwt incluiding the signing algorithm, token type,
+// and the (optional) id of the key used to sign the token.
 type Header struct {
 	Alg string `json:"alg"`
 	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"` // key id: used to select the verifying key during key rotation
 }
 
 // ValidateHeader checks that the jwt header fields match the expected algorithm and token type.
-// It rejects any algorithm other than ES512, including "none", which is an exploit vector.
+// It rejects any algorithm not in the algorithm registry, including "none", which is an exploit vector.
 func (h *Header) ValidateHeader() error {
-	if h.Alg != ES512 {
-		return fmt.Errorf("invalid jwt header: alg must be %s, got %q", ES512, h.Alg)
+	if strings.EqualFold(h.Alg, algNone) {
+		return fmt.Errorf("invalid jwt header: alg %q is not allowed", h.Alg)
+	}
+	if _, err := LookupAlgorithm(h.Alg); err != nil {
+		return fmt.Errorf("invalid jwt header: alg %q is not supported", h.Alg)
 	}
 	if h.Typ != TokenType {
 		return fmt.Errorf("invalid jwt header: typ must be %s, got %q", TokenType, h.Typ)
 	}
+	if len(h.Kid) > KeyIdMax {
+		return fmt.Errorf("invalid jwt header: kid must not exceed %d characters", KeyIdMax)
+	}
 	return nil
 }
 
 // Claims is the second part of a jwt including the issuer, subject, audience, issued at, not before, and expiration
 // Scopes is a space delimited string of scopes
 // Fields for ID Token (OICD Conncet Standard) are included, but omitted if empty
+// Additional, service specific claims are carried in Extra
 type Claims struct {
 	Jti       string   `json:"jti,omitempty"` // jwt unique identifier / uuid
 	Issuer    string   `json:"iss"`           // url of issuing service
@@ -61,6 +73,8 @@ type Claims struct {
 	Expires   int64    `json:"exp"`
 	Scopes    string   `json:"scp,omitempty"` // OAuth2: not array, space delimited string: "r:service* w:othersevice:*"
 
+	Confirmation *Confirmation `json:"cnf,omitempty"` // RFC 8705: client certificate the token is bound to
+
 	// ID Token Fields
 	Nonce      string `json:"nonce,omitempty"`       // random string to prevent replay attacks
 	Email      string `json:"email,omitempty"`       // email address
@@ -68,6 +82,9 @@ type Claims struct {
 	GivenName  string `json:"given_name,omitempty"`  // first name
 	FamilyName string `json:"family_name,omitempty"` // last name
 	Birthdate  string `json:"birthdate,omitempty"`   // date of birth
+
+	// Extra holds custom claims by name, eg, "tenant", as raw json.  Use SetClaim and GetClaim to access them.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 // ValidateClaims checks that required claims fields are present and well-formed.
@@ -57,6 +57,16 @@ func TestValidateHeader(t *testing.T) {
 			header:  Header{Alg: ES512, Typ: TokenType},
 			wantErr: false,
 		},
+		{
+			name:    "valid_es256",
+			header:  Header{Alg: ES256, Typ: TokenType},
+			wantErr: false,
+		},
+		{
+			name:    "valid_eddsa",
+			header:  Header{Alg: EdDSA, Typ: TokenType},
+			wantErr: false,
+		},
 		{
 			name:      "alg_empty",
 			header:    Header{Alg: "", Typ: TokenType},
@@ -82,6 +92,12 @@ func TestValidateHeader(t *testing.T) {
 			wantErr:   true,
 			errSubstr: "alg",
 		},
+		{
+			name:      "alg_none_mixed_case",
+			header:    Header{Alg: "NoNe", Typ: TokenType},
+			wantErr:   true,
+			errSubstr: "alg",
+		},
 		{
 			name:      "typ_empty",
 			header:    Header{Alg: ES512, Typ: ""},
@@ -94,6 +110,17 @@ func TestValidateHeader(t *testing.T) {
 			wantErr:   true,
 			errSubstr: "typ",
 		},
+		{
+			name:    "kid_present",
+			header:  Header{Alg: ES512, Typ: TokenType, Kid: "2025-01-s2s"},
+			wantErr: false,
+		},
+		{
+			name:      "kid_too_long",
+			header:    Header{Alg: ES512, Typ: TokenType, Kid: strings.Repeat("k", KeyIdMax+1)},
+			wantErr:   true,
+			errSubstr: "kid",
+		},
 	}
 
 	for _, tt := range tests {
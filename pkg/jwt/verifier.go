@@ -1,10 +1,8 @@
 package jwt
 
 import (
-	"crypto/ecdsa"
-	"crypto/sha512"
+	"crypto"
 	"fmt"
-	"math/big"
 	"strings"
 	"time"
 )
@@ -17,60 +15,322 @@ type Verifier interface {
 	// BuildAuthorized takes in a list of allowed scopes and a token string
 	// and creates a jwt object ONLY if the token is authorized
 	// by a valid signature.  Otherwise it retuns nil and an error.
+	// Granted wildcard scopes satisfy allowed scopes beneath them, eg, w:gallery:* satisfies w:gallery:album.
 	BuildAuthorized(allowedScopes []string, token string) (*Token, error)
 }
 
+// VerifyingKey is a public key trusted by the verifier, identified by a key id (kid).
+// A key with an empty key id is tried for any token, which allows tokens minted before key ids
+// were stamped into headers to keep verifying during a rotation.
+// Each key is bound to exactly one algorithm: a token is only verified by keys whose alg matches its header alg.
+type VerifyingKey struct {
+	KeyId     string           // kid: matched against the jwt header kid
+	Alg       string           // optional: the key's algorithm, determined by the public key type if empty
+	PublicKey crypto.PublicKey // the verifying/public key, eg, *ecdsa.PublicKey or ed25519.PublicKey
+	NotAfter  time.Time        // optional: the key is no longer trusted after this time, zero value means no expiry
+}
+
+// KeySource provides a verifier's trusted keys at verification time, eg, keys fetched from an issuer's jwks endpoint,
+// so signing keys can be rotated without redeploying the verifying services.
+type KeySource interface {
+
+	// VerifyingKeys returns the currently trusted keys.  The kid is the key id of the token being verified, or empty;
+	// a source may use an unknown kid as a signal to refresh its keys.
+	VerifyingKeys(kid string) ([]VerifyingKey, error)
+}
+
+// DefaultLeeway is the clock skew tolerated by the verifier when checking a token's time claims.
+const DefaultLeeway = 2 * time.Second
+
+// VerifierOption is a functional option for configuring the Verifier.
+type VerifierOption func(*verifier)
+
+// WithClock sets the function the verifier uses to get the current time, eg, a fixed time in tests.
+// Defaults to time.Now.
+func WithClock(now func() time.Time) VerifierOption {
+	return func(v *verifier) {
+		if now != nil {
+			v.Now = now
+		}
+	}
+}
+
+// WithLeeway sets the clock skew tolerated when checking the iat, nbf, and exp claims,
+// for services running on nodes whose clocks may drift.  Defaults to DefaultLeeway.  Negative values are treated as zero.
+func WithLeeway(leeway time.Duration) VerifierOption {
+	return func(v *verifier) { v.Leeway = max(leeway, 0) }
+}
+
+// WithRequireNotBefore rejects tokens without a not before (nbf) claim.
+// A token's nbf claim is always enforced when present.
+func WithRequireNotBefore() VerifierOption {
+	return func(v *verifier) { v.RequireNotBefore = true }
+}
+
+// WithMaxTokenAge rejects tokens issued longer ago than the max age, regardless of their expiry.
+func WithMaxTokenAge(maxAge time.Duration) VerifierOption {
+	return func(v *verifier) { v.MaxTokenAge = maxAge }
+}
+
+// WithIssuers sets the trusted issuers: tokens whose iss claim is not one of them are rejected.
+// By default, the iss claim is only checked for presence.
+func WithIssuers(issuers ...string) VerifierOption {
+	return func(v *verifier) { v.Issuers = issuers }
+}
+
+// WithRevocationStore sets the revocation store the verifier checks for revoked tokens.
+// When set, tokens without a jti are rejected, and a failure to reach the store rejects the token (fails closed).
+func WithRevocationStore(store RevocationStore) VerifierOption {
+	return func(v *verifier) { v.Revocations = store }
+}
+
+// WithScopeMatch sets the scope matching mode: MatchAny (default) authorizes a token granting any of the
+// allowed scopes, MatchAll only a token granting all of them.
+func WithScopeMatch(mode ScopeMatch) VerifierOption {
+	return func(v *verifier) { v.ScopeMatch = mode }
+}
+
 // NewVerifier creates a new Verifier object with a service name and public key.
+// The algorithm is determined by the public key type, eg, *ecdsa.PublicKey on P-521 verifies ES512.
 // Note: service name is provided to ensure it is in the token audiences.
-func NewVerifier(svcName string, pubKey *ecdsa.PublicKey) Verifier {
-	return &verifier{
+func NewVerifier(svcName string, pubKey crypto.PublicKey, opts ...VerifierOption) Verifier {
+
+	key := VerifyingKey{PublicKey: pubKey}
+
+	// unsupported key types fail verification when selected
+	if alg, err := AlgorithmForKey(pubKey); err == nil {
+		key.Alg = alg.Name()
+	}
+
+	v := &verifier{
 		ServiceName: svcName,
-		PublicKey:   pubKey,
+		Keys:        []VerifyingKey{key},
+		Now:         time.Now,
+		Leeway:      DefaultLeeway,
 	}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return v
+}
+
+// NewKeySetVerifier creates a new Verifier object with a service name and a set of verifying keys,
+// eg, the current key and the previous key(s) during a signing key rotation.
+// The key is selected by matching the token header kid to the key id.
+// When more than one key is provided, each key must have a unique key id.
+func NewKeySetVerifier(svcName string, keys []VerifyingKey, opts ...VerifierOption) (Verifier, error) {
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one verifying key is required")
+	}
+
+	seen := make(map[string]struct{}, len(keys))
+	for i, k := range keys {
+		if k.PublicKey == nil {
+			return nil, fmt.Errorf("verifying key at index %d is missing its public key", i)
+		}
+
+		if len(keys) > 1 && k.KeyId == "" {
+			return nil, fmt.Errorf("verifying key at index %d is missing its key id: required when more than one key is provided", i)
+		}
+
+		if len(k.KeyId) > KeyIdMax {
+			return nil, fmt.Errorf("verifying key id at index %d must not exceed %d characters", i, KeyIdMax)
+		}
+
+		if _, ok := seen[k.KeyId]; ok {
+			return nil, fmt.Errorf("duplicate verifying key id %q", k.KeyId)
+		}
+		seen[k.KeyId] = struct{}{}
+	}
+
+	// copy so the caller cannot mutate the key set after construction
+	ks := make([]VerifyingKey, len(keys))
+	copy(ks, keys)
+
+	// bind each key to its algorithm
+	for i := range ks {
+		alg, err := bindAlgorithm(ks[i])
+		if err != nil {
+			return nil, fmt.Errorf("verifying key at index %d: %v", i, err)
+		}
+		ks[i].Alg = alg.Name()
+	}
+
+	v := &verifier{
+		ServiceName: svcName,
+		Keys:        ks,
+		Now:         time.Now,
+		Leeway:      DefaultLeeway,
+	}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return v, nil
+}
+
+// NewKeySourceVerifier creates a new Verifier object with a service name and a source of verifying keys,
+// which is consulted for every token verified.  Keys from the source are selected as in NewKeySetVerifier.
+func NewKeySourceVerifier(svcName string, src KeySource, opts ...VerifierOption) (Verifier, error) {
+
+	if src == nil {
+		return nil, fmt.Errorf("key source is required")
+	}
+
+	v := &verifier{
+		ServiceName: svcName,
+		Source:      src,
+		Now:         time.Now,
+		Leeway:      DefaultLeeway,
+	}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return v, nil
 }
 
 var _ Verifier = (*verifier)(nil)
 
 type verifier struct {
-	ServiceName string
-	PublicKey   *ecdsa.PublicKey
+	ServiceName      string
+	Keys             []VerifyingKey
+	Source           KeySource        // optional: replaces Keys with keys provided at verification time
+	Revocations      RevocationStore  // optional: denylist of revoked tokens
+	ScopeMatch       ScopeMatch       // any (default) or all of the allowed scopes must be granted
+	Now              func() time.Time // clock used for all time checks
+	Leeway           time.Duration    // tolerated clock skew for iat, nbf, and exp
+	RequireNotBefore bool             // reject tokens without an nbf claim
+	MaxTokenAge      time.Duration    // optional: reject tokens issued longer ago than this
+	Issuers          []string         // optional: trusted issuers, otherwise iss is only checked for presence
 }
 
 // VerifySignature implements the Verifier interface.  It takes in a message and signature and verifies the signature against the message.
+// Since the message carries no key id or alg, the signature is checked against every currently trusted key.
 func (v *verifier) VerifySignature(msg string, sig []byte) error {
-	return v.verifySignature(msg, sig)
+
+	keys, err := v.selectKeys("", "")
+	if err != nil {
+		return err
+	}
+
+	return v.verifySignature(msg, sig, keys)
 }
 
-// verifySignature takes in a message and signature and verifies the signature against the message.
-func (v *verifier) verifySignature(msg string, sig []byte) error {
+// selectKeys returns the currently trusted keys which may have signed a token with the given key id and alg.
+// An empty kid matches every trusted key; a key with an empty key id matches any kid.
+// An empty alg matches every key's algorithm; otherwise, only keys bound to the alg are returned.
+func (v *verifier) selectKeys(kid, alg string) ([]VerifyingKey, error) {
 
-	// check for no msg
-	if msg == "" {
-		return fmt.Errorf("unauthorized: missing message")
+	trusted, err := v.trustedKeys(kid)
+	if err != nil {
+		return nil, err
 	}
 
-	// ES512 raw r‖s serialization is always exactly 2*Keysize bytes.
-	if len(sig) != 2*Keysize {
-		return fmt.Errorf("unauthorized: invalid signature length: expected %d bytes, got %d", 2*Keysize, len(sig))
+	now := v.Now()
+
+	var (
+		keys     []VerifyingKey
+		retired  bool
+		mismatch bool
+	)
+	for _, k := range trusted {
+
+		if kid != "" && k.KeyId != "" && k.KeyId != kid {
+			continue
+		}
+
+		// strict alg-to-key binding
+		if alg != "" && k.Alg != alg {
+			mismatch = true
+			continue
+		}
+
+		// key rotated out
+		if !k.NotAfter.IsZero() && now.After(k.NotAfter) {
+			retired = true
+			continue
+		}
+
+		keys = append(keys, k)
 	}
 
-	// hash base signature string
-	hasher := sha512.New()
-	hasher.Write([]byte(msg))
+	if len(keys) == 0 {
+		if mismatch {
+			return nil, tokenErrorf(ErrUnknownSigningKey, "token alg %q does not match the verifying key alg", alg)
+		}
+		if retired {
+			return nil, tokenErrorf(ErrUnknownSigningKey, "signing key %q is no longer trusted", kid)
+		}
+		return nil, tokenErrorf(ErrUnknownSigningKey, "unknown signing key %q", kid)
+	}
 
-	hashedMsg := hasher.Sum(nil)
+	return keys, nil
+}
 
-	// divide signature in half to get r and s
-	// 66 bit keysize was looked up for ecdsa 512
-	r := big.NewInt(0).SetBytes(sig[:Keysize])
-	s := big.NewInt(0).SetBytes(sig[Keysize:])
+// trustedKeys is a helper method which returns the verifier's keys, or its key source's current keys if it has one.
+// Keys from a source are bound to their algorithm here; keys which cannot be bound are never trusted.
+func (v *verifier) trustedKeys(kid string) ([]VerifyingKey, error) {
 
-	// verify signature
-	if verified := ecdsa.Verify(v.PublicKey, hashedMsg, r, s); verified {
-		return nil
+	if v.Source == nil {
+		return v.Keys, nil
+	}
+
+	keys, err := v.Source.VerifyingKeys(kid)
+	if err != nil {
+		return nil, tokenErrorf(ErrUnauthorized, "failed to get verifying keys: %v", err)
+	}
+
+	bound := make([]VerifyingKey, 0, len(keys))
+	for _, k := range keys {
+		alg, err := bindAlgorithm(k)
+		if err != nil {
+			continue
+		}
+		k.Alg = alg.Name()
+		bound = append(bound, k)
 	}
 
-	return fmt.Errorf("unauthorized: failed to verify jwt signature")
+	return bound, nil
+}
+
+// verifySignature takes in a message and signature and verifies the signature against the message
+// using the provided keys, each with its bound algorithm.  It succeeds if any of the keys verifies the signature.
+func (v *verifier) verifySignature(msg string, sig []byte, keys []VerifyingKey) error {
+
+	// check for no msg
+	if msg == "" {
+		return tokenErrorf(ErrInvalidSignature, "missing message")
+	}
+
+	var firstErr error
+	for _, key := range keys {
+
+		alg, err := LookupAlgorithm(key.Alg)
+		if err != nil {
+			err = tokenErrorf(ErrUnknownSigningKey, "unsupported verifying key type %T", key.PublicKey)
+		} else {
+			err = alg.Verify(key.PublicKey, []byte(msg), sig)
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
 }
 
 // IsAuthorized implements the Verifier interface.  In this implementation, it validates the signature,
@@ -84,54 +344,136 @@ func (v *verifier) BuildAuthorized(allowedScopes []string, token string) (*Token
 
 	// check for empty token
 	if token == "" {
-		return nil, fmt.Errorf("unauthorized: missing token")
+		return nil, ErrMissingToken
 	}
 
 	jot, err := BuildTokenFromRaw(token)
 	if err != nil {
-		return nil, err
+		return nil, tokenErrorf(ErrMalformedToken, "%v", err)
 	}
 
 	// quick input validation
 	// header is correct algorithm and type
 	if err := jot.Header.ValidateHeader(); err != nil {
-		return nil, fmt.Errorf("unauthorized: invalid token header: %v", err)
+		return nil, tokenErrorf(ErrMalformedToken, "invalid token header: %v", err)
 	}
 
 	// claims have at minimum required fields
 	if err := jot.Claims.ValidateClaims(); err != nil {
-		return nil, fmt.Errorf("unauthorized: invalid token claims: %v", err)
+		return nil, tokenErrorf(ErrMalformedToken, "invalid token claims: %v", err)
+	}
+
+	// select the verifying key(s) by the header key id and alg
+	keys, err := v.selectKeys(jot.Header.Kid, jot.Header.Alg)
+	if err != nil {
+		return nil, err
 	}
 
 	// check signature
-	if err := v.verifySignature(jot.BaseString, jot.Signature); err != nil {
+	if err := v.verifySignature(jot.BaseString, jot.Signature, keys); err != nil {
 		return nil, err
 	}
 
-	// check issued time.
-	// padding time to avoid clock sync issues.
-	if time.Now().Add(2*time.Second).Unix() < jot.Claims.IssuedAt {
-		return nil, fmt.Errorf("unauthorized: issued at is in the future")
+	// check issuer
+	if !v.hasValidIssuer(jot) {
+		return nil, ErrInvalidIssuer
 	}
 
-	// check expiry
-	if time.Now().Unix() > jot.Claims.Expires {
-		return nil, fmt.Errorf("unauthorized: token expired")
+	// check issued at, not before, expiry, and max age
+	if err := v.checkTimes(jot); err != nil {
+		return nil, err
+	}
+
+	// check revocation
+	if err := v.checkRevoked(jot); err != nil {
+		return nil, err
 	}
 
 	// check audiences
 	if ok := v.hasValidAudiences(jot); !ok {
-		return nil, fmt.Errorf("forbidden: incorrect audience")
+		return nil, ErrInvalidAudience
 	}
 
 	// check scopes
 	if ok := v.hasValidScopes(allowedScopes, jot); !ok {
-		return nil, fmt.Errorf("forbidden: incorrect or missing scopes")
+		return nil, ErrMissingScope
 	}
 
 	return jot, nil
 }
 
+// checkTimes is a helper method which checks the token's time claims against the verifier's clock.
+// The leeway pads each check to avoid clock sync issues between the issuing and verifying services.
+func (v *verifier) checkTimes(jot *Token) error {
+
+	now := v.Now()
+	early := now.Add(v.Leeway).Unix() // latest acceptable iat and nbf
+	late := now.Add(-v.Leeway).Unix() // earliest acceptable exp
+
+	if early < jot.Claims.IssuedAt {
+		return tokenErrorf(ErrTokenNotYetValid, "issued at is in the future")
+	}
+
+	if jot.Claims.NotBefore == 0 && v.RequireNotBefore {
+		return tokenErrorf(ErrMalformedToken, "not before (nbf) is required")
+	}
+
+	if early < jot.Claims.NotBefore {
+		return tokenErrorf(ErrTokenNotYetValid, "token is not valid before %s", time.Unix(jot.Claims.NotBefore, 0).UTC().Format(time.RFC3339))
+	}
+
+	if late > jot.Claims.Expires {
+		return ErrTokenExpired
+	}
+
+	if v.MaxTokenAge > 0 && late > time.Unix(jot.Claims.IssuedAt, 0).Add(v.MaxTokenAge).Unix() {
+		return tokenErrorf(ErrTokenExpired, "token exceeds the maximum age of %s", v.MaxTokenAge)
+	}
+
+	return nil
+}
+
+// hasValidIssuer is a helper method which checks if the jwt token was issued by a trusted issuer, if any are configured.
+func (v *verifier) hasValidIssuer(jot *Token) bool {
+
+	if len(v.Issuers) == 0 {
+		return true
+	}
+
+	for _, iss := range v.Issuers {
+		if iss == jot.Claims.Issuer {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkRevoked is a helper method which checks the token against the revocation store, if one is configured.
+// It fails closed: a token which cannot be checked is rejected.
+func (v *verifier) checkRevoked(jot *Token) error {
+
+	if v.Revocations == nil {
+		return nil
+	}
+
+	// a token without a jti cannot be revoked individually, so it is not accepted
+	if jot.Claims.Jti == "" {
+		return tokenErrorf(ErrMalformedToken, "token jti is required")
+	}
+
+	revoked, err := v.Revocations.IsRevoked(jot.Claims.Jti, jot.Claims.Subject, jot.Claims.IssuedAt)
+	if err != nil {
+		return tokenErrorf(ErrUnauthorized, "failed to check token revocation: %v", err)
+	}
+
+	if revoked {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
 // hasValidAudiences is a helper method which checks if the jwt token has the correct audience.
 // It does not validate the signature of the token.
 func (v *verifier) hasValidAudiences(jot *Token) bool {
@@ -141,7 +483,8 @@ func (v *verifier) hasValidAudiences(jot *Token) bool {
 	return audiences[v.ServiceName]
 }
 
-// hasValidScopes is a helper method which checks if the jwt token has the correct scopes.
+// hasValidScopes is a helper method which checks if the jwt token has the correct scopes,
+// using the verifier's scope matching mode: any (default) or all of the allowed scopes.
 // It does not validate the signature of the token.
 func (v *verifier) hasValidScopes(allowedScopes []string, jot *Token) bool {
 
@@ -150,16 +493,6 @@ func (v *verifier) hasValidScopes(allowedScopes []string, jot *Token) bool {
 		return false
 	}
 
-	// set jwt scopes to map
-	jwtScopes := jot.Claims.MapScopes()
-
-	// check if allowed scopes are in jwt scopes
-	for _, allowed := range allowedScopes {
-		if jwtScopes[allowed] {
-			return true
-		}
-	}
-
 	// default to false -> unauthorized
-	return false
+	return MatchScopes(strings.Fields(jot.Claims.Scopes), allowedScopes, v.ScopeMatch)
 }
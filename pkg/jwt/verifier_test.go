@@ -2,9 +2,11 @@ package jwt
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -343,6 +345,28 @@ func TestBuildAuthorized(t *testing.T) {
 			wantErr:   true,
 			errSubstr: "incorrect or missing scopes",
 		},
+		{
+			// a granted wildcard satisfies the fine-grained scopes beneath it
+			name:    "wildcard_scope_satisfies_resource_scope",
+			token:   validRaw,
+			scopes:  []string{"w:service-a:album"},
+			wantErr: false,
+		},
+		{
+			// a required wildcard is literal and not satisfied by a resource grant
+			name: "resource_scope_does_not_satisfy_wildcard",
+			token: mintRaw(t, s, &Token{
+				Header: Header{Alg: ES512, Typ: TokenType},
+				Claims: func() Claims {
+					c := validClaims
+					c.Scopes = "r:service-a:album"
+					return c
+				}(),
+			}),
+			scopes:    allowedScopes,
+			wantErr:   true,
+			errSubstr: "incorrect or missing scopes",
+		},
 		{
 			name: "empty_scopes_in_token",
 			token: mintRaw(t, s, &Token{
@@ -389,3 +413,901 @@ func TestBuildAuthorized(t *testing.T) {
 		})
 	}
 }
+
+// ---- Key rotation ----------------------------------------------------------
+
+func TestNewKeySetVerifier(t *testing.T) {
+	k1, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	k2, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		keys      []VerifyingKey
+		wantErr   bool
+		errSubstr string
+	}{
+		{
+			name:      "no_keys",
+			keys:      nil,
+			wantErr:   true,
+			errSubstr: "at least one verifying key",
+		},
+		{
+			name:      "nil_public_key",
+			keys:      []VerifyingKey{{KeyId: "a"}},
+			wantErr:   true,
+			errSubstr: "missing its public key",
+		},
+		{
+			// a single key does not need a key id
+			name:    "single_key_without_kid",
+			keys:    []VerifyingKey{{PublicKey: &k1.PublicKey}},
+			wantErr: false,
+		},
+		{
+			name: "multiple_keys_missing_kid",
+			keys: []VerifyingKey{
+				{KeyId: "a", PublicKey: &k1.PublicKey},
+				{PublicKey: &k2.PublicKey},
+			},
+			wantErr:   true,
+			errSubstr: "missing its key id",
+		},
+		{
+			name: "duplicate_kid",
+			keys: []VerifyingKey{
+				{KeyId: "a", PublicKey: &k1.PublicKey},
+				{KeyId: "a", PublicKey: &k2.PublicKey},
+			},
+			wantErr:   true,
+			errSubstr: "duplicate verifying key id",
+		},
+		{
+			name:      "kid_too_long",
+			keys:      []VerifyingKey{{KeyId: strings.Repeat("k", KeyIdMax+1), PublicKey: &k1.PublicKey}},
+			wantErr:   true,
+			errSubstr: "must not exceed",
+		},
+		{
+			name:      "alg_not_bound_to_key_type",
+			keys:      []VerifyingKey{{Alg: EdDSA, PublicKey: &k1.PublicKey}},
+			wantErr:   true,
+			errSubstr: "not valid for alg",
+		},
+		{
+			name:      "alg_not_registered",
+			keys:      []VerifyingKey{{Alg: "RS256", PublicKey: &k1.PublicKey}},
+			wantErr:   true,
+			errSubstr: "unsupported jwt signing algorithm",
+		},
+		{
+			name:      "unsupported_key_type",
+			keys:      []VerifyingKey{{PublicKey: "not-a-key"}},
+			wantErr:   true,
+			errSubstr: "unsupported jwt signing key type",
+		},
+		{
+			name: "current_and_previous_keys",
+			keys: []VerifyingKey{
+				{KeyId: "current", PublicKey: &k1.PublicKey},
+				{KeyId: "previous", PublicKey: &k2.PublicKey, NotAfter: time.Now().Add(time.Hour)},
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewKeySetVerifier("service-a", tt.keys)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for case %q, got nil", tt.name)
+				}
+				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for case %q: %v", tt.name, err)
+			}
+			if v == nil {
+				t.Fatal("expected non-nil Verifier, got nil")
+			}
+		})
+	}
+}
+
+func TestBuildAuthorized_KeyRotation(t *testing.T) {
+	const svcName = "service-a"
+
+	currentKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	previousKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	retiredKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	unknownKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+
+	v, err := NewKeySetVerifier(svcName, []VerifyingKey{
+		{KeyId: "current", PublicKey: &currentKey.PublicKey},
+		{KeyId: "previous", PublicKey: &previousKey.PublicKey, NotAfter: time.Now().Add(time.Hour)},
+		{KeyId: "retired", PublicKey: &retiredKey.PublicKey, NotAfter: time.Now().Add(-time.Minute)},
+	})
+	if err != nil {
+		t.Fatalf("failed to create key set verifier: %v", err)
+	}
+
+	now := time.Now().UTC()
+	newToken := func() *Token {
+		return &Token{
+			Header: Header{Alg: ES512, Typ: TokenType},
+			Claims: Claims{
+				Jti:      "3bb72d75-dcfa-400a-a78e-5a4ecd0d3f09",
+				Issuer:   "https://auth.example.com",
+				Subject:  "user@example.com",
+				Audience: []string{svcName},
+				IssuedAt: now.Unix(),
+				Expires:  now.Add(time.Hour).Unix(),
+				Scopes:   "r:service-a:*",
+			},
+		}
+	}
+
+	// a token signed by the previous key but labeled with the current key id
+	// must not verify: the kid binds the token to a single key.
+	mislabeled := newToken()
+	mislabeled.Header.Kid = "current"
+	mintRaw(t, NewSigner(previousKey), mislabeled)
+
+	tests := []struct {
+		name      string
+		token     string
+		wantErr   bool
+		errSubstr string
+	}{
+		{
+			name:    "current_key",
+			token:   mintRaw(t, NewSigner(currentKey, WithKeyId("current")), newToken()),
+			wantErr: false,
+		},
+		{
+			name:    "previous_key_within_not_after",
+			token:   mintRaw(t, NewSigner(previousKey, WithKeyId("previous")), newToken()),
+			wantErr: false,
+		},
+		{
+			// tokens minted before key ids were stamped are checked against all trusted keys
+			name:    "legacy_token_without_kid",
+			token:   mintRaw(t, NewSigner(previousKey), newToken()),
+			wantErr: false,
+		},
+		{
+			name:      "retired_key_past_not_after",
+			token:     mintRaw(t, NewSigner(retiredKey, WithKeyId("retired")), newToken()),
+			wantErr:   true,
+			errSubstr: "no longer trusted",
+		},
+		{
+			name:      "legacy_token_signed_by_retired_key",
+			token:     mintRaw(t, NewSigner(retiredKey), newToken()),
+			wantErr:   true,
+			errSubstr: "failed to verify jwt signature",
+		},
+		{
+			name:      "unknown_kid",
+			token:     mintRaw(t, NewSigner(unknownKey, WithKeyId("unknown")), newToken()),
+			wantErr:   true,
+			errSubstr: "unknown signing key",
+		},
+		{
+			name:      "kid_does_not_match_signing_key",
+			token:     mislabeled.Raw,
+			wantErr:   true,
+			errSubstr: "failed to verify jwt signature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.BuildAuthorized([]string{"r:service-a:*"}, tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for case %q, got nil", tt.name)
+				}
+				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for case %q: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestBuildAuthorized_SingleKeyAcceptsAnyKid(t *testing.T) {
+	// a verifier built with NewVerifier has a single key without a key id, so it keeps
+	// verifying tokens after the issuing service starts stamping key ids.
+	_, v, priv := testVerifierSetup(t, "service-a")
+
+	now := time.Now().UTC()
+	raw := mintRaw(t, NewSigner(priv, WithKeyId("s2s-2025-06")), &Token{
+		Header: Header{Alg: ES512, Typ: TokenType},
+		Claims: Claims{
+			Issuer:   "https://auth.example.com",
+			Subject:  "user@example.com",
+			Audience: []string{"service-a"},
+			IssuedAt: now.Unix(),
+			Expires:  now.Add(time.Hour).Unix(),
+			Scopes:   "r:service-a:*",
+		},
+	})
+
+	if _, err := v.BuildAuthorized([]string{"r:service-a:*"}, raw); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBuildAuthorized_AlgorithmBinding(t *testing.T) {
+	const svcName = "service-a"
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+
+	v, err := NewKeySetVerifier(svcName, []VerifyingKey{
+		{KeyId: "ec", PublicKey: &ecKey.PublicKey},
+		{KeyId: "ed", PublicKey: edPub},
+	})
+	if err != nil {
+		t.Fatalf("failed to create key set verifier: %v", err)
+	}
+
+	now := time.Now().UTC()
+	newToken := func(alg string) *Token {
+		return &Token{
+			Header: Header{Alg: alg, Typ: TokenType},
+			Claims: Claims{
+				Issuer:   "https://auth.example.com",
+				Subject:  "user@example.com",
+				Audience: []string{svcName},
+				IssuedAt: now.Unix(),
+				Expires:  now.Add(time.Hour).Unix(),
+				Scopes:   "r:service-a:*",
+			},
+		}
+	}
+
+	// relabel an EdDSA token as ES512 without re-signing: an alg confusion attempt.
+	relabeled := newToken(EdDSA)
+	mintRaw(t, NewSigner(edPriv, WithKeyId("ed")), relabeled)
+	relabeled.Header.Alg = ES512
+	confused, err := relabeled.BuildBaseString()
+	if err != nil {
+		t.Fatalf("failed to build base string: %v", err)
+	}
+	confused += "." + base64.RawURLEncoding.EncodeToString(relabeled.Signature)
+
+	tests := []struct {
+		name      string
+		token     string
+		wantErr   bool
+		errSubstr string
+	}{
+		{
+			name:    "es512_token_ecdsa_key",
+			token:   mintRaw(t, NewSigner(ecKey, WithKeyId("ec")), newToken(ES512)),
+			wantErr: false,
+		},
+		{
+			name:    "eddsa_token_ed25519_key",
+			token:   mintRaw(t, NewSigner(edPriv, WithKeyId("ed")), newToken(EdDSA)),
+			wantErr: false,
+		},
+		{
+			name:      "alg_does_not_match_kid_key",
+			token:     confused,
+			wantErr:   true,
+			errSubstr: "does not match the verifying key alg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.BuildAuthorized([]string{"r:service-a:*"}, tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for case %q, got nil", tt.name)
+				}
+				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for case %q: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+// failingRevocationStore is a RevocationStore which cannot be reached.
+type failingRevocationStore struct{ RevocationStore }
+
+func (f *failingRevocationStore) IsRevoked(string, string, int64) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestBuildAuthorized_Revocation(t *testing.T) {
+	const svcName = "service-a"
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	s := NewSigner(privKey)
+
+	store := NewMemoryRevocationStore(time.Hour)
+	v := NewVerifier(svcName, &privKey.PublicKey, WithRevocationStore(store))
+
+	now := time.Now().UTC()
+	newToken := func(jti, subject string, issuedAt time.Time) *Token {
+		return &Token{
+			Header: Header{Alg: ES512, Typ: TokenType},
+			Claims: Claims{
+				Jti:      jti,
+				Issuer:   "https://auth.example.com",
+				Subject:  subject,
+				Audience: []string{svcName},
+				IssuedAt: issuedAt.Unix(),
+				Expires:  issuedAt.Add(time.Hour).Unix(),
+				Scopes:   "r:service-a:*",
+			},
+		}
+	}
+
+	if err := store.RevokeJti("4a7d1c7e-0f3b-4c52-9d6a-1e2f3a4b5c6d", now.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to revoke jti: %v", err)
+	}
+	if err := store.RevokeSubject("compromised@example.com", now); err != nil {
+		t.Fatalf("failed to revoke subject: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		v         Verifier
+		token     string
+		wantErr   bool
+		errSubstr string
+	}{
+		{
+			name:    "not_revoked",
+			v:       v,
+			token:   mintRaw(t, s, newToken("3bb72d75-dcfa-400a-a78e-5a4ecd0d3f09", "user@example.com", now)),
+			wantErr: false,
+		},
+		{
+			name:      "jti_revoked",
+			v:         v,
+			token:     mintRaw(t, s, newToken("4a7d1c7e-0f3b-4c52-9d6a-1e2f3a4b5c6d", "user@example.com", now)),
+			wantErr:   true,
+			errSubstr: "token revoked",
+		},
+		{
+			name:      "subject_revoked_before_cutoff",
+			v:         v,
+			token:     mintRaw(t, s, newToken("3bb72d75-dcfa-400a-a78e-5a4ecd0d3f09", "compromised@example.com", now.Add(-time.Minute))),
+			wantErr:   true,
+			errSubstr: "token revoked",
+		},
+		{
+			name:    "subject_reissued_after_cutoff",
+			v:       v,
+			token:   mintRaw(t, s, newToken("3bb72d75-dcfa-400a-a78e-5a4ecd0d3f09", "compromised@example.com", now.Add(time.Second))),
+			wantErr: false,
+		},
+		{
+			name:      "missing_jti_rejected",
+			v:         v,
+			token:     mintRaw(t, s, newToken("", "user@example.com", now)),
+			wantErr:   true,
+			errSubstr: "jti is required",
+		},
+		{
+			name:      "store_unavailable_fails_closed",
+			v:         NewVerifier(svcName, &privKey.PublicKey, WithRevocationStore(&failingRevocationStore{})),
+			token:     mintRaw(t, s, newToken("3bb72d75-dcfa-400a-a78e-5a4ecd0d3f09", "user@example.com", now)),
+			wantErr:   true,
+			errSubstr: "failed to check token revocation",
+		},
+		{
+			name:    "no_store_does_not_require_jti",
+			v:       NewVerifier(svcName, &privKey.PublicKey),
+			token:   mintRaw(t, s, newToken("", "user@example.com", now)),
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.v.BuildAuthorized([]string{"r:service-a:*"}, tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for case %q, got nil", tt.name)
+				}
+				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for case %q: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestBuildAuthorized_MatchAll(t *testing.T) {
+	const svcName = "service-a"
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	s := NewSigner(privKey)
+	v := NewVerifier(svcName, &privKey.PublicKey, WithScopeMatch(MatchAll))
+
+	now := time.Now().UTC()
+	raw := mintRaw(t, s, &Token{
+		Header: Header{Alg: ES512, Typ: TokenType},
+		Claims: Claims{
+			Issuer:   "https://auth.example.com",
+			Subject:  "user@example.com",
+			Audience: []string{svcName},
+			IssuedAt: now.Unix(),
+			Expires:  now.Add(time.Hour).Unix(),
+			Scopes:   "r:service-a:* w:service-a:album:*",
+		},
+	})
+
+	tests := []struct {
+		name      string
+		scopes    []string
+		wantErr   bool
+		errSubstr string
+	}{
+		{
+			name:    "all_scopes_granted",
+			scopes:  []string{"r:service-a:album", "w:service-a:album:photo"},
+			wantErr: false,
+		},
+		{
+			name:      "one_scope_not_granted",
+			scopes:    []string{"r:service-a:album", "d:service-a:album"},
+			wantErr:   true,
+			errSubstr: "incorrect or missing scopes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.BuildAuthorized(tt.scopes, raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for case %q, got nil", tt.name)
+				}
+				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for case %q: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestBuildAuthorized_ErrorKinds(t *testing.T) {
+	const svcName = "service-a"
+
+	s, v, _ := testVerifierSetup(t, svcName)
+	_, other, _ := testVerifierSetup(t, svcName)
+
+	now := time.Now().UTC()
+	mint := func(claims Claims) string {
+		return mintRaw(t, s, &Token{Header: Header{Alg: ES512, Typ: TokenType}, Claims: claims})
+	}
+	valid := Claims{
+		Issuer:   "https://auth.example.com",
+		Subject:  "user@example.com",
+		Audience: []string{svcName},
+		IssuedAt: now.Unix(),
+		Expires:  now.Add(time.Hour).Unix(),
+		Scopes:   "r:service-a:*",
+	}
+
+	expired := valid
+	expired.IssuedAt = now.Add(-2 * time.Hour).Unix()
+	expired.Expires = now.Add(-time.Hour).Unix()
+
+	future := valid
+	future.IssuedAt = now.Add(time.Hour).Unix()
+	future.Expires = now.Add(2 * time.Hour).Unix()
+
+	wrongAud := valid
+	wrongAud.Audience = []string{"service-b"}
+
+	tests := []struct {
+		name         string
+		verifier     Verifier
+		token        string
+		scopes       []string
+		wantErr      error
+		wantCategory error
+	}{
+		{
+			name:         "missing_token",
+			verifier:     v,
+			token:        "",
+			wantErr:      ErrMissingToken,
+			wantCategory: ErrUnauthorized,
+		},
+		{
+			name:         "malformed_token",
+			verifier:     v,
+			token:        "not.a-jwt",
+			wantErr:      ErrMalformedToken,
+			wantCategory: ErrUnauthorized,
+		},
+		{
+			name:         "bad_signature",
+			verifier:     other,
+			token:        mint(valid),
+			wantErr:      ErrInvalidSignature,
+			wantCategory: ErrUnauthorized,
+		},
+		{
+			name:         "expired",
+			verifier:     v,
+			token:        mint(expired),
+			wantErr:      ErrTokenExpired,
+			wantCategory: ErrUnauthorized,
+		},
+		{
+			name:         "not_yet_valid",
+			verifier:     v,
+			token:        mint(future),
+			wantErr:      ErrTokenNotYetValid,
+			wantCategory: ErrUnauthorized,
+		},
+		{
+			name:         "wrong_audience",
+			verifier:     v,
+			token:        mint(wrongAud),
+			wantErr:      ErrInvalidAudience,
+			wantCategory: ErrForbidden,
+		},
+		{
+			name:         "missing_scope",
+			verifier:     v,
+			token:        mint(valid),
+			scopes:       []string{"w:service-a:album"},
+			wantErr:      ErrMissingScope,
+			wantCategory: ErrForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scopes := tt.scopes
+			if scopes == nil {
+				scopes = []string{"r:service-a:album"}
+			}
+
+			_, err := tt.verifier.BuildAuthorized(scopes, tt.token)
+			if err == nil {
+				t.Fatalf("expected error for case %q, got nil", tt.name)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected errors.Is(err, %v), got %v", tt.wantErr, err)
+			}
+			if !errors.Is(err, tt.wantCategory) {
+				t.Errorf("expected errors.Is(err, %v), got %v", tt.wantCategory, err)
+			}
+		})
+	}
+}
+
+func TestBuildAuthorized_TimeValidation(t *testing.T) {
+	const svcName = "service-a"
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	s := NewSigner(privKey)
+
+	// fixed clock so boundary cases are deterministic
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	claims := func(iat, nbf, exp time.Time) Claims {
+		c := Claims{
+			Issuer:   "https://auth.example.com",
+			Subject:  "user@example.com",
+			Audience: []string{svcName},
+			IssuedAt: iat.Unix(),
+			Expires:  exp.Unix(),
+			Scopes:   "r:service-a:*",
+		}
+		if !nbf.IsZero() {
+			c.NotBefore = nbf.Unix()
+		}
+		return c
+	}
+
+	tests := []struct {
+		name      string
+		opts      []VerifierOption
+		claims    Claims
+		wantErr   error
+		errSubstr string
+	}{
+		{
+			name:   "valid_token",
+			claims: claims(now.Add(-time.Minute), now.Add(-time.Minute), now.Add(time.Hour)),
+		},
+		{
+			name:   "iat_within_default_leeway",
+			claims: claims(now.Add(2*time.Second), time.Time{}, now.Add(time.Hour)),
+		},
+		{
+			name:      "iat_beyond_default_leeway",
+			claims:    claims(now.Add(3*time.Second), time.Time{}, now.Add(time.Hour)),
+			wantErr:   ErrTokenNotYetValid,
+			errSubstr: "issued at is in the future",
+		},
+		{
+			name:   "iat_within_configured_leeway",
+			opts:   []VerifierOption{WithLeeway(30 * time.Second)},
+			claims: claims(now.Add(20*time.Second), time.Time{}, now.Add(time.Hour)),
+		},
+		{
+			name:      "zero_leeway",
+			opts:      []VerifierOption{WithLeeway(0)},
+			claims:    claims(now.Add(time.Second), time.Time{}, now.Add(time.Hour)),
+			wantErr:   ErrTokenNotYetValid,
+			errSubstr: "issued at is in the future",
+		},
+		{
+			name:      "nbf_in_future",
+			claims:    claims(now.Add(-time.Minute), now.Add(time.Minute), now.Add(time.Hour)),
+			wantErr:   ErrTokenNotYetValid,
+			errSubstr: "not valid before",
+		},
+		{
+			name:   "nbf_within_leeway",
+			claims: claims(now.Add(-time.Minute), now.Add(time.Second), now.Add(time.Hour)),
+		},
+		{
+			name:   "nbf_missing_not_required",
+			claims: claims(now.Add(-time.Minute), time.Time{}, now.Add(time.Hour)),
+		},
+		{
+			name:      "nbf_missing_but_required",
+			opts:      []VerifierOption{WithRequireNotBefore()},
+			claims:    claims(now.Add(-time.Minute), time.Time{}, now.Add(time.Hour)),
+			wantErr:   ErrMalformedToken,
+			errSubstr: "not before (nbf) is required",
+		},
+		{
+			name:   "nbf_present_and_required",
+			opts:   []VerifierOption{WithRequireNotBefore()},
+			claims: claims(now.Add(-time.Minute), now.Add(-time.Minute), now.Add(time.Hour)),
+		},
+		{
+			name:   "exp_within_leeway",
+			claims: claims(now.Add(-time.Hour), time.Time{}, now.Add(-time.Second)),
+		},
+		{
+			name:      "expired",
+			claims:    claims(now.Add(-time.Hour), time.Time{}, now.Add(-3*time.Second)),
+			wantErr:   ErrTokenExpired,
+			errSubstr: "token expired",
+		},
+		{
+			name:   "within_max_age",
+			opts:   []VerifierOption{WithMaxTokenAge(time.Hour)},
+			claims: claims(now.Add(-30*time.Minute), time.Time{}, now.Add(time.Hour)),
+		},
+		{
+			name:      "exceeds_max_age",
+			opts:      []VerifierOption{WithMaxTokenAge(time.Hour)},
+			claims:    claims(now.Add(-2*time.Hour), time.Time{}, now.Add(time.Hour)),
+			wantErr:   ErrTokenExpired,
+			errSubstr: "maximum age",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier(svcName, &privKey.PublicKey, append([]VerifierOption{WithClock(clock)}, tt.opts...)...)
+			raw := mintRaw(t, s, &Token{Header: Header{Alg: ES512, Typ: TokenType}, Claims: tt.claims})
+
+			_, err := v.BuildAuthorized([]string{"r:service-a:album"}, raw)
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("expected error for case %q, got nil", tt.name)
+				}
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected errors.Is(err, %v), got %v", tt.wantErr, err)
+				}
+				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for case %q: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestBuildAuthorized_Issuers(t *testing.T) {
+	const svcName = "service-a"
+
+	s, _, privKey := testVerifierSetup(t, svcName)
+
+	now := time.Now().UTC()
+	raw := mintRaw(t, s, &Token{
+		Header: Header{Alg: ES512, Typ: TokenType},
+		Claims: Claims{
+			Issuer:   "https://auth.example.com",
+			Subject:  "user@example.com",
+			Audience: []string{svcName},
+			IssuedAt: now.Unix(),
+			Expires:  now.Add(time.Hour).Unix(),
+			Scopes:   "r:service-a:*",
+		},
+	})
+
+	tests := []struct {
+		name    string
+		issuers []string
+		wantErr bool
+	}{
+		{
+			name:    "no_issuers_configured",
+			wantErr: false,
+		},
+		{
+			name:    "trusted_issuer",
+			issuers: []string{"https://other.example.com", "https://auth.example.com"},
+			wantErr: false,
+		},
+		{
+			name:    "untrusted_issuer",
+			issuers: []string{"https://other.example.com"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier(svcName, &privKey.PublicKey, WithIssuers(tt.issuers...))
+
+			_, err := v.BuildAuthorized([]string{"r:service-a:album"}, raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidIssuer) {
+					t.Fatalf("expected errors.Is(err, ErrInvalidIssuer), got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for case %q: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+// staticKeySource is a KeySource returning fixed keys, or an error, for testing.
+type staticKeySource struct {
+	keys []VerifyingKey
+	err  error
+}
+
+func (s *staticKeySource) VerifyingKeys(kid string) ([]VerifyingKey, error) { return s.keys, s.err }
+
+func TestNewKeySourceVerifier(t *testing.T) {
+	const svcName = "service-a"
+
+	s, _, privKey := testVerifierSetup(t, svcName)
+
+	now := time.Now().UTC()
+	raw := mintRaw(t, s, &Token{
+		Header: Header{Alg: ES512, Typ: TokenType},
+		Claims: Claims{
+			Issuer:   "https://auth.example.com",
+			Subject:  "user@example.com",
+			Audience: []string{svcName},
+			IssuedAt: now.Unix(),
+			Expires:  now.Add(time.Hour).Unix(),
+			Scopes:   "r:service-a:*",
+		},
+	})
+
+	tests := []struct {
+		name      string
+		src       KeySource
+		wantErr   bool
+		errSubstr string
+	}{
+		{
+			name: "source_key_without_alg",
+			src:  &staticKeySource{keys: []VerifyingKey{{PublicKey: &privKey.PublicKey}}},
+		},
+		{
+			name:      "source_error_fails_closed",
+			src:       &staticKeySource{err: errors.New("issuer unreachable")},
+			wantErr:   true,
+			errSubstr: "failed to get verifying keys",
+		},
+		{
+			name:      "source_has_no_keys",
+			src:       &staticKeySource{},
+			wantErr:   true,
+			errSubstr: "unknown signing key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewKeySourceVerifier(svcName, tt.src)
+			if err != nil {
+				t.Fatalf("NewKeySourceVerifier() error: %v", err)
+			}
+
+			_, err = v.BuildAuthorized([]string{"r:service-a:album"}, raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnauthorized) {
+					t.Fatalf("expected errors.Is(err, ErrUnauthorized), got %v", err)
+				}
+				if !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for case %q: %v", tt.name, err)
+			}
+		})
+	}
+
+	if _, err := NewKeySourceVerifier(svcName, nil); err == nil {
+		t.Error("expected error for nil key source, got nil")
+	}
+}
@@ -0,0 +1,19 @@
+package pat
+
+import (
+	"fmt"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+)
+
+// PAT verification errors.  They wrap the jwt package's verification errors so callers can handle
+// pat and jwt failures the same way, eg, errors.Is(err, jwt.ErrUnauthorized) -> 401.
+// Missing scopes are reported with jwt.ErrMissingScope.
+var (
+	// ErrInvalidPat is returned when a pat token is not well-formed, eg, the wrong length.
+	ErrInvalidPat = fmt.Errorf("%w: invalid pat token", jwt.ErrUnauthorized)
+
+	// ErrPatInactive is returned when the auth service reports a pat token as not active,
+	// ie, it is unknown, expired, or revoked.
+	ErrPatInactive = fmt.Errorf("%w: pat token is not active", jwt.ErrUnauthorized)
+)
@@ -0,0 +1,181 @@
+package pat
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheMaxEntries = 10_000
+	defaultCallTimeout     = 10 * time.Second // shared introspect calls are detached from the request's deadline
+)
+
+// introspectionCache is a bounded, least recently used cache of introspection responses with a ttl,
+// keyed by the blind index of the pat token so raw tokens are not held in memory.
+// Concurrent lookups of the same key share a single introspection call.
+type introspectionCache struct {
+	ttl         time.Duration // active tokens
+	negativeTtl time.Duration // inactive tokens
+	maxEntries  int
+	callTimeout time.Duration // bounds the shared introspect call
+	now         func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List // front is most recently used
+	inflight map[string]*introspectCall
+}
+
+// cacheEntry is an introspection response held in the cache's lru list.
+type cacheEntry struct {
+	key     string
+	resp    IntrospectResponse
+	expires time.Time
+}
+
+// introspectCall is an in flight introspection which concurrent lookups of the same key wait on.
+type introspectCall struct {
+	done chan struct{} // closed when resp and err are set
+	resp IntrospectResponse
+	err  error
+}
+
+// newIntrospectionCache creates a new introspection cache.
+func newIntrospectionCache(ttl, negativeTtl time.Duration, maxEntries int) *introspectionCache {
+
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+
+	return &introspectionCache{
+		ttl:         ttl,
+		negativeTtl: negativeTtl,
+		maxEntries:  maxEntries,
+		callTimeout: defaultCallTimeout,
+		now:         time.Now,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+		inflight:    make(map[string]*introspectCall),
+	}
+}
+
+// get returns the cached response for the key, or calls introspect to fetch it.  Responses are cached
+// for the ttl if active, the negative ttl if inactive; errors are not cached.
+// Lookups of the same key share one introspect call, which runs under a context detached from the lookup
+// which started it, with its own timeout, so one cancelled request does not fail the others.
+// Each lookup stops waiting when its own context is done.
+func (c *introspectionCache) get(
+	ctx context.Context,
+	key string,
+	introspect func(ctx context.Context) (IntrospectResponse, error),
+) (IntrospectResponse, error) {
+
+	if err := ctx.Err(); err != nil {
+		return IntrospectResponse{}, err
+	}
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if c.now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			return entry.resp, nil
+		}
+		c.remove(el)
+	}
+
+	call, ok := c.inflight[key]
+	if !ok {
+		call = &introspectCall{done: make(chan struct{})}
+		c.inflight[key] = call
+		go c.call(context.WithoutCancel(ctx), key, call, introspect)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.resp, call.err
+	case <-ctx.Done():
+		return IntrospectResponse{}, ctx.Err()
+	}
+}
+
+// call is a helper method which runs the shared introspect call for the key with the cache's call timeout,
+// caches a successful response, and releases the lookups waiting on it.
+func (c *introspectionCache) call(
+	ctx context.Context,
+	key string,
+	call *introspectCall,
+	introspect func(ctx context.Context) (IntrospectResponse, error),
+) {
+
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	// if introspect panics, waiting lookups get an error and later lookups are not blocked by the in flight call
+	defer func() {
+		if r := recover(); r != nil {
+			call.err = fmt.Errorf("pat introspection panicked: %v", r)
+		}
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+
+		close(call.done)
+	}()
+
+	resp, err := introspect(ctx)
+	call.resp, call.err = resp, err
+
+	if err == nil {
+		c.mu.Lock()
+		c.add(key, resp)
+		c.mu.Unlock()
+	}
+}
+
+// invalidate removes the key's cached response, if any.
+func (c *introspectionCache) invalidate(key string) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// add is a helper method which caches a response, evicting the least recently used entry if the cache is full.
+// It must be called with the lock held.
+func (c *introspectionCache) add(key string, resp IntrospectResponse) {
+
+	ttl := c.ttl
+	if !resp.Active {
+		ttl = c.negativeTtl
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	for c.lru.Len() >= c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, resp: resp, expires: c.now().Add(ttl)})
+}
+
+// remove is a helper method which removes an entry.  It must be called with the lock held.
+func (c *introspectionCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
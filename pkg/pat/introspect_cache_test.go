@@ -0,0 +1,343 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/connect"
+)
+
+// ---- introspectionCache ----
+
+func TestIntrospectionCache_Get(t *testing.T) {
+
+	active := IntrospectResponse{Active: true, Scope: "r:svc:*"}
+	inactive := IntrospectResponse{Active: false}
+
+	tests := []struct {
+		name        string
+		resp        IntrospectResponse
+		err         error
+		advance     time.Duration // between the first and second lookup
+		invalidate  bool
+		wantIntrosp int32
+	}{
+		{name: "active_cached_within_ttl", resp: active, advance: 59 * time.Second, wantIntrosp: 1},
+		{name: "active_expires_after_ttl", resp: active, advance: time.Minute, wantIntrosp: 2},
+		{name: "inactive_negative_cached", resp: inactive, advance: 9 * time.Second, wantIntrosp: 1},
+		{name: "inactive_expires_after_negative_ttl", resp: inactive, advance: 10 * time.Second, wantIntrosp: 2},
+		{name: "errors_not_cached", err: errors.New("auth service unavailable"), wantIntrosp: 2},
+		{name: "invalidated", resp: active, invalidate: true, wantIntrosp: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+			c := newIntrospectionCache(time.Minute, 10*time.Second, 10)
+			c.now = func() time.Time { return now }
+
+			var calls atomic.Int32
+			introspect := func(context.Context) (IntrospectResponse, error) {
+				calls.Add(1)
+				return tt.resp, tt.err
+			}
+
+			if _, err := c.get(context.Background(), "key", introspect); !errors.Is(err, tt.err) {
+				t.Fatalf("first get() error = %v, want %v", err, tt.err)
+			}
+
+			now = now.Add(tt.advance)
+			if tt.invalidate {
+				c.invalidate("key")
+			}
+
+			got, err := c.get(context.Background(), "key", introspect)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("second get() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.resp {
+				t.Errorf("second get() = %+v, want %+v", got, tt.resp)
+			}
+			if calls.Load() != tt.wantIntrosp {
+				t.Errorf("introspect calls: want %d, got %d", tt.wantIntrosp, calls.Load())
+			}
+		})
+	}
+}
+
+func TestIntrospectionCache_EvictsLeastRecentlyUsed(t *testing.T) {
+
+	c := newIntrospectionCache(time.Minute, time.Minute, 2)
+
+	var calls atomic.Int32
+	introspect := func(context.Context) (IntrospectResponse, error) {
+		calls.Add(1)
+		return IntrospectResponse{Active: true}, nil
+	}
+
+	c.get(context.Background(), "a", introspect)
+	c.get(context.Background(), "b", introspect)
+	c.get(context.Background(), "a", introspect) // a is now more recently used than b
+	c.get(context.Background(), "c", introspect) // evicts b
+
+	if len(c.entries) != 2 || c.lru.Len() != 2 {
+		t.Fatalf("cache size: want 2, got %d entries, %d list elements", len(c.entries), c.lru.Len())
+	}
+	if _, ok := c.entries["b"]; ok {
+		t.Error("expected least recently used key b to be evicted")
+	}
+
+	calls.Store(0)
+	c.get(context.Background(), "a", introspect)
+	if calls.Load() != 0 {
+		t.Error("expected key a to still be cached")
+	}
+}
+
+func TestIntrospectionCache_DeduplicatesConcurrentLookups(t *testing.T) {
+
+	c := newIntrospectionCache(time.Minute, time.Minute, 10)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	introspect := func(context.Context) (IntrospectResponse, error) {
+		calls.Add(1)
+		<-release
+		return IntrospectResponse{Active: true, Scope: "r:svc:*"}, nil
+	}
+
+	const lookups = 20
+	var wg sync.WaitGroup
+	results := make(chan IntrospectResponse, lookups)
+	for range lookups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.get(context.Background(), "key", introspect)
+			if err != nil {
+				t.Errorf("get() error: %v", err)
+			}
+			results <- resp
+		}()
+	}
+
+	// wait for the first lookup to be in flight, then let the others pile up behind it
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if calls.Load() != 1 {
+		t.Errorf("introspect calls: want 1, got %d", calls.Load())
+	}
+	for resp := range results {
+		if !resp.Active || resp.Scope != "r:svc:*" {
+			t.Errorf("unexpected shared response: %+v", resp)
+		}
+	}
+}
+
+func TestIntrospectionCache_PanicReleasesInflight(t *testing.T) {
+
+	c := newIntrospectionCache(time.Minute, time.Minute, 10)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	panicking := func(context.Context) (IntrospectResponse, error) {
+		close(started)
+		<-release
+		panic("introspection endpoint client bug")
+	}
+
+	// the first lookup panics while a second waits on it
+	errs := make(chan error, 2)
+	go func() {
+		_, err := c.get(context.Background(), "key", panicking)
+		errs <- err
+	}()
+	<-started
+
+	go func() {
+		_, err := c.get(context.Background(), "key", func(context.Context) (IntrospectResponse, error) {
+			return IntrospectResponse{}, errors.New("waiter introspected instead of joining the in flight call")
+		})
+		errs <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for range 2 {
+		select {
+		case err := <-errs:
+			if err == nil || !strings.Contains(err.Error(), "panicked") {
+				t.Errorf("expected the panic error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("lookup blocked after the in flight call panicked")
+		}
+	}
+
+	// later lookups are not blocked and call introspect again
+	if _, err := c.get(context.Background(), "key", func(context.Context) (IntrospectResponse, error) {
+		return IntrospectResponse{Active: true}, nil
+	}); err != nil {
+		t.Errorf("get() error: %v", err)
+	}
+}
+
+func TestIntrospectionCache_CancelledLookupDoesNotFailOthers(t *testing.T) {
+
+	c := newIntrospectionCache(time.Minute, time.Minute, 10)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	introspect := func(ctx context.Context) (IntrospectResponse, error) {
+		close(started)
+		select {
+		case <-release:
+			return IntrospectResponse{Active: true, Scope: "r:svc:*"}, nil
+		case <-ctx.Done():
+			return IntrospectResponse{}, ctx.Err()
+		}
+	}
+
+	// the first lookup's client disconnects while the call is in flight
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := c.get(first, "key", introspect)
+		firstErr <- err
+	}()
+	<-started
+
+	waiter := make(chan IntrospectResponse, 1)
+	go func() {
+		resp, err := c.get(context.Background(), "key", introspect)
+		if err != nil {
+			t.Errorf("waiting get() error: %v", err)
+		}
+		waiter <- resp
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled lookup: want context.Canceled, got %v", err)
+	}
+
+	close(release)
+	if resp := <-waiter; !resp.Active {
+		t.Errorf("waiting lookup: want the shared active response, got %+v", resp)
+	}
+
+	// the shared response is cached
+	if _, ok := c.entries["key"]; !ok {
+		t.Error("expected the shared response to be cached")
+	}
+}
+
+func TestIntrospectionCache_CallTimeout(t *testing.T) {
+
+	c := newIntrospectionCache(time.Minute, time.Minute, 10)
+	c.callTimeout = 10 * time.Millisecond
+
+	_, err := c.get(context.Background(), "key", func(ctx context.Context) (IntrospectResponse, error) {
+		<-ctx.Done()
+		return IntrospectResponse{}, ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the shared call to time out, got %v", err)
+	}
+}
+
+// ---- verifier with cache ----
+
+func TestVerifier_IntrospectionCache(t *testing.T) {
+
+	var introspections, s2sTokens atomic.Int32
+
+	client := &mockTlsClient{
+		DoFunc: func(_ *http.Request) (*http.Response, error) {
+			introspections.Add(1)
+			return jsonResp(http.StatusOK, IntrospectResponse{Active: true, Scope: "r:svc:*", Sub: "client-1"}), nil
+		},
+	}
+	tp := &mockTokenProvider{
+		GetServiceTokenFunc: func(_ context.Context, _ string) (string, error) {
+			s2sTokens.Add(1)
+			return "test-s2s-token", nil
+		},
+	}
+
+	v := NewVerifier(
+		"test-auth-svc",
+		connect.NewS2sCaller("https://auth.test", "test-auth-svc", client, connect.RetryConfiguration{MaxRetries: 1}),
+		tp,
+		WithIntrospectionCache(time.Minute, 10*time.Second, 100),
+	)
+
+	for i := range 5 {
+		if _, err := v.BuildAuthorized(context.Background(), []string{"r:svc:*"}, prefixedPAT); err != nil {
+			t.Fatalf("BuildAuthorized() call %d error: %v", i, err)
+		}
+	}
+	if introspections.Load() != 1 || s2sTokens.Load() != 1 {
+		t.Fatalf("introspections/s2s tokens: want 1/1, got %d/%d", introspections.Load(), s2sTokens.Load())
+	}
+
+	// a different token is a different cache entry
+	if _, err := v.GetPatScopes(context.Background(), validPAT); err != nil {
+		t.Fatalf("GetPatScopes() error: %v", err)
+	}
+	if introspections.Load() != 2 {
+		t.Errorf("introspections after second token: want 2, got %d", introspections.Load())
+	}
+
+	v.(CacheInvalidator).Invalidate(prefixedPAT)
+	if _, err := v.GetPatScopes(context.Background(), prefixedPAT); err != nil {
+		t.Fatalf("GetPatScopes() error: %v", err)
+	}
+	if introspections.Load() != 3 {
+		t.Errorf("introspections after invalidate: want 3, got %d", introspections.Load())
+	}
+
+	// raw tokens are not held as cache keys
+	cache := v.(*verifier).cache
+	for key := range cache.entries {
+		if key == prefixedPAT || key == validPAT {
+			t.Errorf("cache keyed by raw token %q", key)
+		}
+	}
+}
+
+func TestVerifier_NoCache(t *testing.T) {
+
+	var introspections atomic.Int32
+	client := &mockTlsClient{
+		DoFunc: func(_ *http.Request) (*http.Response, error) {
+			introspections.Add(1)
+			return jsonResp(http.StatusOK, IntrospectResponse{Active: true, Scope: "r:svc:*"}), nil
+		},
+	}
+
+	v := newTestVerifier(t, client, okTokenProvider())
+	for range 3 {
+		if _, err := v.GetPatScopes(context.Background(), validPAT); err != nil {
+			t.Fatalf("GetPatScopes() error: %v", err)
+		}
+	}
+	v.Invalidate(validPAT) // no-op without a cache
+
+	if introspections.Load() != 3 {
+		t.Errorf("introspections: want 3, got %d", introspections.Load())
+	}
+}
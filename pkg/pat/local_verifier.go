@@ -0,0 +1,117 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// NewLocalVerifier creates a new Verifier which verifies pat tokens against the store rather than
+// calling an auth service's introspection endpoint, eg, in the service which issues the tokens, or in tests.
+// The tokener must blind index tokens the same way as when they were saved: if it is a PatKeyring, tokens
+// indexed under a previous pepper are reindexed under the current pepper on use.
+// issuer is the name of the issuing service, reported as AuthorizedService.AuthorizedBy.
+func NewLocalVerifier(issuer string, s PatStore, t PatTokener, opts ...VerifierOption) Verifier {
+
+	v := NewVerifier(issuer, nil, nil, opts...).(*verifier)
+	v.store = s
+	v.tokener = t
+
+	return v
+}
+
+// introspectLocal is a helper method which builds an introspection response for a pat token from its stored record.
+// Unknown, revoked, and expired tokens are inactive.
+func (v *verifier) introspectLocal(ctx context.Context, token string) (IntrospectResponse, error) {
+
+	if err := ctx.Err(); err != nil {
+		return IntrospectResponse{}, err
+	}
+
+	indexes, err := v.obtainIndexes([]byte(token))
+	if err != nil {
+		return IntrospectResponse{}, fmt.Errorf("failed to obtain blind indexes for pat token: %v", err)
+	}
+
+	record, err := v.store.FindPat(indexes)
+	if err != nil {
+		if errors.Is(err, ErrPatNotFound) {
+			return IntrospectResponse{Active: false}, nil
+		}
+		return IntrospectResponse{}, fmt.Errorf("failed to look up pat token: %w", err)
+	}
+
+	// confirms the match in constant time, and obtains the index under the current pepper if it is stale
+	index, reindexed, err := v.reindex([]byte(token), record.PatIndex)
+	if err != nil {
+		return IntrospectResponse{}, fmt.Errorf("failed to compare pat token to its blind index: %v", err)
+	}
+
+	// the service in a prefixed token must be the token's owner
+	if p, err := ParsePat(token); err == nil && p.Service != record.ServiceName {
+		v.logger.Warn("pat token service does not match its owner",
+			slog.String("pat_service", p.Service),
+			slog.String("owner", record.ServiceName))
+		return IntrospectResponse{Active: false}, nil
+	}
+
+	now := time.Now().UTC()
+	if record.Revoked || (!record.ExpiresAt.IsZero() && !now.Before(record.ExpiresAt.Time)) {
+		return IntrospectResponse{Active: false}, nil
+	}
+
+	// best effort: a failure to record use should not fail the request
+	if err := v.store.RecordUse(record.Uuid, index, now); err != nil {
+		v.logger.Error("failed to record pat token use",
+			slog.String("pat_uuid", record.Uuid),
+			slog.Bool("reindexed", reindexed),
+			slog.String("err", err.Error()))
+	}
+
+	return IntrospectResponse{
+		Active:      true,
+		Scope:       record.Scopes,
+		Sub:         record.ClientId,
+		ServiceName: record.ServiceName,
+		Iss:         v.authSvcName,
+		Aud:         record.Audiences,
+	}, nil
+}
+
+// obtainIndexes is a helper method which returns the token's blind indexes under every pepper
+// if the tokener is a PatKeyring, or its single blind index otherwise.
+func (v *verifier) obtainIndexes(token []byte) ([]string, error) {
+
+	if keyring, ok := v.tokener.(PatKeyring); ok {
+		return keyring.ObtainIndexes(token)
+	}
+
+	index, err := v.tokener.ObtainIndex(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{index}, nil
+}
+
+// reindex is a helper method which compares the token to its stored blind index and, if the tokener is
+// a PatKeyring, returns its index under the current pepper and whether it changed.
+func (v *verifier) reindex(token []byte, blindIndex string) (string, bool, error) {
+
+	if keyring, ok := v.tokener.(PatKeyring); ok {
+		return keyring.Reindex(token, blindIndex)
+	}
+
+	match, err := v.tokener.HashAndCompare(token, blindIndex)
+	if err != nil {
+		return "", false, err
+	}
+
+	if !match {
+		return "", false, fmt.Errorf("PAT token does not match blind index")
+	}
+
+	return blindIndex, false, nil
+}
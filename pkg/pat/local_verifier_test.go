@@ -0,0 +1,190 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/data"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+)
+
+// saveTestPat is a helper which generates a pat token for the pixie service and saves it to the store.
+// It returns the token and its record's uuid.
+func saveTestPat(t *testing.T, s PatStore, tkn PatTokener, modify func(*PatRecord)) (string, string) {
+	t.Helper()
+
+	raw, token, err := GeneratePat("pixie")
+	if err != nil {
+		t.Fatalf("GeneratePat() error: %v", err)
+	}
+
+	index, err := tkn.ObtainIndex(raw)
+	if err != nil {
+		t.Fatalf("ObtainIndex() error: %v", err)
+	}
+
+	record := PatRecord{
+		PatIndex:    index,
+		ClientId:    "client-1",
+		ServiceName: "pixie",
+		Scopes:      "r:gallery:* w:gallery:album",
+	}
+	if modify != nil {
+		modify(&record)
+	}
+
+	if err := s.SavePat(record); err != nil {
+		t.Fatalf("SavePat() error: %v", err)
+	}
+
+	saved, err := s.FindPat([]string{index})
+	if err != nil {
+		t.Fatalf("FindPat() error: %v", err)
+	}
+
+	return token, saved.Uuid
+}
+
+func TestLocalVerifier_BuildAuthorized(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		modify   func(*PatRecord)
+		token    func(token string) string
+		opts     []VerifierOption
+		required []string
+		wantIs   error
+	}{
+		{name: "active"},
+		{name: "unexpired", modify: func(r *PatRecord) { r.ExpiresAt = data.CustomTime{Time: time.Now().Add(time.Hour)} }},
+		{name: "unknown_token", token: func(string) string { return prefixedPAT }, wantIs: ErrPatInactive},
+		{name: "bad_checksum_rejected_offline", token: func(string) string { return badChecksumPAT }, wantIs: ErrInvalidPat},
+		{name: "revoked", modify: func(r *PatRecord) { r.Revoked = true }, wantIs: ErrPatInactive},
+		{name: "expired", modify: func(r *PatRecord) { r.ExpiresAt = data.CustomTime{Time: time.Now().Add(-time.Minute)} }, wantIs: ErrPatInactive},
+		{name: "owner_service_mismatch", modify: func(r *PatRecord) { r.ServiceName = "shaw" }, wantIs: ErrPatInactive},
+		{name: "missing_scope", required: []string{"d:gallery:*"}, wantIs: jwt.ErrMissingScope},
+		{
+			name:   "audience_matches",
+			modify: func(r *PatRecord) { r.Audiences = "gallery pixie" },
+			opts:   []VerifierOption{WithAudience("gallery")},
+		},
+		{
+			name:   "audience_mismatch",
+			modify: func(r *PatRecord) { r.Audiences = "gallery" },
+			opts:   []VerifierOption{WithAudience("shaw")},
+			wantIs: jwt.ErrInvalidAudience,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryPatStore()
+			tkn := NewPatTokener(testPepper)
+			token, id := saveTestPat(t, store, tkn, tt.modify)
+			if tt.token != nil {
+				token = tt.token(token)
+			}
+
+			required := tt.required
+			if required == nil {
+				required = []string{"w:gallery:album"}
+			}
+
+			v := NewLocalVerifier("test-auth-svc", store, tkn, tt.opts...)
+			authorized, err := v.BuildAuthorized(context.Background(), required, token)
+			if tt.wantIs != nil {
+				if !errors.Is(err, tt.wantIs) {
+					t.Fatalf("expected errors.Is(err, %v), got %v", tt.wantIs, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildAuthorized() error: %v", err)
+			}
+
+			want := AuthorizedService{ServiceId: "client-1", ServiceName: "pixie", AuthorizedBy: "test-auth-svc"}
+			if authorized != want {
+				t.Errorf("BuildAuthorized() = %+v, want %+v", authorized, want)
+			}
+
+			// the successful use is recorded
+			rec := store.(*memoryPatStore).records[id]
+			if rec.LastUsedAt.IsZero() {
+				t.Error("expected last used at to be recorded")
+			}
+		})
+	}
+}
+
+func TestLocalVerifier_ReindexesOnUse(t *testing.T) {
+
+	// the token is issued before the pepper rotation
+	v1, err := NewPatKeyring(Pepper{Version: "1", Secret: testPepper})
+	if err != nil {
+		t.Fatalf("NewPatKeyring() error: %v", err)
+	}
+	store := NewMemoryPatStore()
+	token, id := saveTestPat(t, store, v1, nil)
+
+	v2, err := NewPatKeyring(Pepper{Version: "2", Secret: testAltPepper}, Pepper{Version: "1", Secret: testPepper})
+	if err != nil {
+		t.Fatalf("NewPatKeyring() error: %v", err)
+	}
+
+	v := NewLocalVerifier("test-auth-svc", store, v2)
+	if ok, err := v.ValidateScopes(context.Background(), []string{"r:gallery:*"}, token); !ok || err != nil {
+		t.Fatalf("ValidateScopes() = %v, %v, want true, nil", ok, err)
+	}
+
+	rec := store.(*memoryPatStore).records[id]
+	if !strings.HasPrefix(rec.PatIndex, "2$") {
+		t.Fatalf("expected index to be reindexed under pepper version 2, got %q", rec.PatIndex)
+	}
+
+	// still verifies once the previous pepper is retired
+	current, err := NewPatKeyring(Pepper{Version: "2", Secret: testAltPepper})
+	if err != nil {
+		t.Fatalf("NewPatKeyring() error: %v", err)
+	}
+	resp, err := NewLocalVerifier("test-auth-svc", store, current).GetPatScopes(context.Background(), token)
+	if err != nil {
+		t.Fatalf("GetPatScopes() error: %v", err)
+	}
+	if !resp.Active {
+		t.Error("expected reindexed token to be active after the previous pepper is retired")
+	}
+}
+
+// plainTokener hides the PatKeyring methods of the tokener, like an implementation from outside the package.
+type plainTokener struct {
+	PatTokener
+}
+
+func TestLocalVerifier_PlainTokener(t *testing.T) {
+
+	tkn := plainTokener{NewPatTokener(testPepper)}
+	store := NewMemoryPatStore()
+	token, id := saveTestPat(t, store, tkn, nil)
+	saved := store.(*memoryPatStore).records[id].PatIndex
+
+	v := NewLocalVerifier("test-auth-svc", store, tkn)
+	if ok, err := v.ValidateScopes(context.Background(), []string{"r:gallery:*"}, token); !ok || err != nil {
+		t.Fatalf("ValidateScopes() = %v, %v, want true, nil", ok, err)
+	}
+
+	if rec := store.(*memoryPatStore).records[id]; rec.PatIndex != saved || rec.LastUsedAt.IsZero() {
+		t.Errorf("expected use recorded under the saved index %q, got %q", saved, rec.PatIndex)
+	}
+
+	// an unknown token is rejected
+	_, other, err := GeneratePat("pixie")
+	if err != nil {
+		t.Fatalf("GeneratePat() error: %v", err)
+	}
+	if ok, _ := v.ValidateScopes(context.Background(), []string{"r:gallery:*"}, other); ok {
+		t.Error("expected unknown token to be rejected")
+	}
+}
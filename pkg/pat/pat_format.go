@@ -0,0 +1,140 @@
+package pat
+
+import (
+	"crypto/rand"
+	"fmt"
+	"hash/crc32"
+	"math/big"
+	"strings"
+
+	"github.com/tdeslauriers/carapace/pkg/validate"
+)
+
+const (
+	// PatPrefix identifies carapace pat tokens, so secret scanners can recognize leaked tokens,
+	// eg, crp_pixie_3kT9...Qz_0aZ9xY.
+	PatPrefix string = "crp_"
+
+	SecretSize int = 64 // bytes of randomness in a pat token
+
+	payloadLen  int = 86 // base62 characters needed to encode SecretSize bytes
+	checksumLen int = 6  // base62 characters needed to encode a crc32 checksum
+
+	// legacy pat tokens: a standard base64 encoded secret
+	legacyPatMin int = 64
+	legacyPatMax int = 128
+)
+
+// Pat is a parsed pat token in the format crp_<service>_<base62 secret>_<base62 crc32 checksum>.
+type Pat struct {
+	Service string // the service the token was issued for
+	Secret  []byte // the random secret which is blind indexed
+}
+
+// String returns the pat token string, including its checksum.
+func (p Pat) String() string {
+
+	body := PatPrefix + p.Service + "_" + encodeBase62(p.Secret, payloadLen)
+	checksum := new(big.Int).SetUint64(uint64(crc32.ChecksumIEEE([]byte(body))))
+
+	return body + "_" + padBase62(checksum.Text(62), checksumLen)
+}
+
+// GeneratePat generates a new 64 byte random secret byte-slice for the service, its pat token string
+// in the format crp_<service>_<base62 secret>_<base62 crc32 checksum>, and an error if any.
+// The token string has the same blind index as the raw secret.
+func GeneratePat(service string) ([]byte, string, error) {
+
+	if err := validate.ValidateServiceName(service); err != nil {
+		return nil, "", fmt.Errorf("invalid service name for PAT token: %v", err)
+	}
+
+	// generate a new 64 byte random secret
+	raw := make([]byte, SecretSize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", fmt.Errorf("failed to generate random bytes for PAT token: %v", err)
+	}
+
+	return raw, Pat{Service: service, Secret: raw}.String(), nil
+}
+
+// ParsePat parses and checks a pat token string offline, ie, without an introspection call.
+// The checksum catches typos and truncated or made up tokens, it does not authenticate the token.
+// Errors wrap ErrInvalidPat.
+func ParsePat(token string) (Pat, error) {
+
+	if !strings.HasPrefix(token, PatPrefix) {
+		return Pat{}, fmt.Errorf("%w: missing %s prefix", ErrInvalidPat, PatPrefix)
+	}
+
+	// the service name cannot contain underscores, so the segments split unambiguously
+	segments := strings.Split(strings.TrimPrefix(token, PatPrefix), "_")
+	if len(segments) != 3 {
+		return Pat{}, fmt.Errorf("%w: must be formatted as %s<service>_<secret>_<checksum>", ErrInvalidPat, PatPrefix)
+	}
+	service, payload, checksum := segments[0], segments[1], segments[2]
+
+	if err := validate.ValidateServiceName(service); err != nil {
+		return Pat{}, fmt.Errorf("%w service: %v", ErrInvalidPat, err)
+	}
+
+	if len(payload) != payloadLen || len(checksum) != checksumLen {
+		return Pat{}, fmt.Errorf("%w: secret must be %d and checksum %d characters", ErrInvalidPat, payloadLen, checksumLen)
+	}
+
+	secret, err := decodeBase62(payload, SecretSize)
+	if err != nil {
+		return Pat{}, fmt.Errorf("%w secret: %v", ErrInvalidPat, err)
+	}
+
+	p := Pat{Service: service, Secret: secret}
+	if p.String() != token {
+		return Pat{}, fmt.Errorf("%w checksum", ErrInvalidPat)
+	}
+
+	return p, nil
+}
+
+// checkPat is a helper function which sanity checks a pat token before it is introspected:
+// prefixed tokens are parsed and their checksum verified, legacy tokens are length checked.
+func checkPat(token string) error {
+
+	if strings.HasPrefix(token, PatPrefix) {
+		_, err := ParsePat(token)
+		return err
+	}
+
+	if len(token) < legacyPatMin || len(token) > legacyPatMax {
+		return fmt.Errorf("%w length, must be between %d and %d characters", ErrInvalidPat, legacyPatMin, legacyPatMax)
+	}
+
+	return nil
+}
+
+// encodeBase62 is a helper function which encodes bytes as a fixed width base62 string (0-9a-zA-Z).
+func encodeBase62(b []byte, width int) string {
+	return padBase62(new(big.Int).SetBytes(b).Text(62), width)
+}
+
+// padBase62 is a helper function which left pads a base62 string with zeros to the width.
+func padBase62(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return strings.Repeat("0", width-len(s)) + s
+}
+
+// decodeBase62 is a helper function which decodes a base62 string into exactly size bytes.
+func decodeBase62(s string, size int) ([]byte, error) {
+
+	n, ok := new(big.Int).SetString(s, 62)
+	if !ok || n.Sign() < 0 {
+		return nil, fmt.Errorf("not a base62 string")
+	}
+
+	if n.BitLen() > size*8 {
+		return nil, fmt.Errorf("exceeds %d bytes", size)
+	}
+
+	return n.FillBytes(make([]byte, size)), nil
+}
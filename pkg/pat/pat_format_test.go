@@ -0,0 +1,204 @@
+package pat
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tdeslauriers/carapace/pkg/jwt"
+)
+
+func TestPat_String(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		secret []byte
+	}{
+		{name: "random_looking", secret: bytes.Repeat([]byte{0xa5}, SecretSize)},
+		{name: "all_zero_is_padded", secret: make([]byte, SecretSize)},
+		{name: "all_ones", secret: bytes.Repeat([]byte{0xff}, SecretSize)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := Pat{Service: "pixie", Secret: tt.secret}.String()
+
+			if want := len(PatPrefix+"pixie_") + payloadLen + 1 + checksumLen; len(token) != want {
+				t.Errorf("token length: want %d, got %d", want, len(token))
+			}
+
+			parsed, err := ParsePat(token)
+			if err != nil {
+				t.Fatalf("ParsePat() error: %v", err)
+			}
+			if parsed.Service != "pixie" || !bytes.Equal(parsed.Secret, tt.secret) {
+				t.Errorf("round trip mismatch: got service %q secret %x", parsed.Service, parsed.Secret)
+			}
+		})
+	}
+}
+
+func TestGeneratePat(t *testing.T) {
+	p := NewPatTokener(testPepper)
+
+	tests := []struct {
+		name      string
+		checkFunc func(t *testing.T, raw []byte, encoded string)
+	}{
+		{
+			name: "raw_is_64_bytes",
+			checkFunc: func(t *testing.T, raw []byte, _ string) {
+				if len(raw) != 64 {
+					t.Errorf("raw length: want 64, got %d", len(raw))
+				}
+			},
+		},
+		{
+			name: "encoded_is_prefixed_and_url_safe",
+			checkFunc: func(t *testing.T, _ []byte, encoded string) {
+				if !strings.HasPrefix(encoded, PatPrefix+"pixie_") {
+					t.Errorf("encoded %q missing prefix %q", encoded, PatPrefix+"pixie_")
+				}
+				if strings.ContainsAny(encoded, "+/=") {
+					t.Errorf("encoded %q contains non url safe characters", encoded)
+				}
+				if len(encoded) < legacyPatMin || len(encoded) > legacyPatMax {
+					t.Errorf("encoded length %d outside [%d, %d]", len(encoded), legacyPatMin, legacyPatMax)
+				}
+			},
+		},
+		{
+			name: "raw_and_encoded_are_consistent",
+			checkFunc: func(t *testing.T, raw []byte, encoded string) {
+				parsed, err := ParsePat(encoded)
+				if err != nil {
+					t.Fatalf("ParsePat() failed on generated token: %v", err)
+				}
+				if parsed.Service != "pixie" || !bytes.Equal(parsed.Secret, raw) {
+					t.Error("parsed token does not match the generated service and raw bytes")
+				}
+			},
+		},
+		{
+			name: "encoded_has_same_index_as_raw",
+			checkFunc: func(t *testing.T, raw []byte, encoded string) {
+				rawIndex, err := p.ObtainIndex(raw)
+				if err != nil {
+					t.Fatalf("ObtainIndex(raw) failed: %v", err)
+				}
+				encodedIndex, err := p.ObtainIndex([]byte(encoded))
+				if err != nil {
+					t.Fatalf("ObtainIndex(encoded) failed: %v", err)
+				}
+				if rawIndex != encodedIndex {
+					t.Error("token string and raw secret produced different blind indexes")
+				}
+			},
+		},
+		{
+			name: "successive_calls_produce_unique_tokens",
+			checkFunc: func(t *testing.T, raw []byte, encoded string) {
+				raw2, encoded2, err := GeneratePat("pixie")
+				if err != nil {
+					t.Fatalf("second GeneratePat() failed: %v", err)
+				}
+				if string(raw) == string(raw2) {
+					t.Error("successive calls returned identical raw bytes")
+				}
+				if encoded == encoded2 {
+					t.Error("successive calls returned identical encoded strings")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, encoded, err := GeneratePat("pixie")
+			if err != nil {
+				t.Fatalf("GeneratePat() returned unexpected error: %v", err)
+			}
+			tt.checkFunc(t, raw, encoded)
+		})
+	}
+
+	if _, _, err := GeneratePat("pixie_dust"); err == nil {
+		t.Error("expected error for invalid service name, got nil")
+	}
+}
+
+func TestParsePat(t *testing.T) {
+
+	valid := Pat{Service: "pixie", Secret: bytes.Repeat([]byte{0x3c}, SecretSize)}.String()
+	segments := strings.Split(valid, "_")
+
+	// change one character of the secret, keeping the original checksum
+	payload := []byte(segments[2])
+	payload[10] = map[bool]byte{true: 'b', false: 'a'}[payload[10] == 'a']
+	typo := strings.Join([]string{segments[0], segments[1], string(payload), segments[3]}, "_")
+
+	// a different service, keeping the original checksum
+	swapped := strings.Join([]string{segments[0], "shaw", segments[2], segments[3]}, "_")
+
+	tests := []struct {
+		name      string
+		token     string
+		errSubstr string
+	}{
+		{name: "valid", token: valid},
+		{name: "missing_prefix", token: strings.TrimPrefix(valid, PatPrefix), errSubstr: "prefix"},
+		{name: "legacy_base64", token: strings.Repeat("A", 88), errSubstr: "prefix"},
+		{name: "typo_in_secret", token: typo, errSubstr: "checksum"},
+		{name: "swapped_service", token: swapped, errSubstr: "checksum"},
+		{name: "truncated", token: valid[:len(valid)-1], errSubstr: "characters"},
+		{name: "extra_segment", token: valid + "_abc", errSubstr: "formatted"},
+		{name: "invalid_service", token: strings.Replace(valid, "pixie", "Pixie", 1), errSubstr: "service"},
+		{name: "non_base62_secret", token: strings.Replace(valid, segments[2], strings.Repeat("-", payloadLen), 1), errSubstr: "secret"},
+		{name: "secret_overflow", token: strings.Replace(valid, segments[2], strings.Repeat("Z", payloadLen), 1), errSubstr: "exceeds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePat(tt.token)
+			if tt.errSubstr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.errSubstr) {
+				t.Errorf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+			}
+			if !errors.Is(err, ErrInvalidPat) || !errors.Is(err, jwt.ErrUnauthorized) {
+				t.Errorf("expected error wrapping ErrInvalidPat, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIntrospectCmd_Validate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "prefixed", token: prefixedPAT},
+		{name: "legacy", token: validPAT},
+		{name: "legacy_too_short", token: shortPAT, wantErr: true},
+		{name: "bad_checksum", token: badChecksumPAT, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := IntrospectCmd{Token: tt.token}
+			if err := cmd.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package pat
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tdeslauriers/carapace/pkg/data"
+)
+
+// ErrPatNotFound is returned by a PatStore when no pat token matches the blind indexes looked up.
+var ErrPatNotFound = errors.New("pat token not found")
+
+// PatRecord is the database model of an issued pat token.  The token itself is never stored, only its blind index.
+type PatRecord struct {
+	Uuid        string          `db:"uuid"`
+	PatIndex    string          `db:"pat_index"`    // blind index from the PatTokener
+	ClientId    string          `db:"client_id"`    // the service client which owns the token
+	ServiceName string          `db:"service_name"` // the owning service's name
+	Scopes      string          `db:"scopes"`       // space delimited list of scopes
+	Audiences   string          `db:"audiences"`    // space delimited list of services which accept the token, empty if unrestricted
+	CreatedAt   data.CustomTime `db:"created_at"`
+	ExpiresAt   data.CustomTime `db:"expires_at"` // zero if the token does not expire
+	Revoked     bool            `db:"revoked"`
+	LastUsedAt  data.CustomTime `db:"last_used_at"` // zero if the token has not been used
+}
+
+// PatStore is a repository of issued pat tokens, so the issuing service can verify pat tokens locally,
+// see NewLocalVerifier.
+type PatStore interface {
+
+	// FindPat returns the record matching any of the blind indexes, eg, a token's indexes under
+	// every pepper from PatKeyring.ObtainIndexes.  It returns ErrPatNotFound if there is none.
+	FindPat(indexes []string) (PatRecord, error)
+
+	// SavePat stores a newly issued pat token.  The uuid and created at are generated if empty.
+	SavePat(record PatRecord) error
+
+	// RevokePat revokes the pat token with the uuid.  It returns ErrPatNotFound if there is none.
+	RevokePat(id string) error
+
+	// RecordUse sets the last used time of the pat token with the uuid and its blind index,
+	// which changes when a token indexed under a previous pepper is reindexed.
+	// It returns ErrPatNotFound if there is none.
+	RecordUse(id, index string, at time.Time) error
+}
+
+// prepareRecord is a helper function which validates a new record and fills in its uuid and created at if empty.
+func prepareRecord(record *PatRecord) error {
+
+	if record.PatIndex == "" {
+		return fmt.Errorf("pat index is required to save a pat token")
+	}
+
+	if record.ClientId == "" {
+		return fmt.Errorf("client id is required to save a pat token")
+	}
+
+	if record.Uuid == "" {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return fmt.Errorf("failed to generate uuid for pat token: %v", err)
+		}
+		record.Uuid = id.String()
+	}
+
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = data.CustomTime{Time: time.Now().UTC()}
+	}
+
+	return nil
+}
+
+// NewMemoryPatStore creates a new in-memory PatStore, eg, for tests.
+// Note: tokens are not shared between instances and are lost on restart.
+func NewMemoryPatStore() PatStore {
+	return &memoryPatStore{
+		records: make(map[string]*PatRecord),
+	}
+}
+
+var _ PatStore = (*memoryPatStore)(nil)
+
+// memoryPatStore is the concrete in-memory implementation of the PatStore interface.
+type memoryPatStore struct {
+	mu      sync.RWMutex
+	records map[string]*PatRecord // uuid -> record
+}
+
+// FindPat implements the PatStore interface.
+func (s *memoryPatStore) FindPat(indexes []string) (PatRecord, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, index := range indexes {
+		for _, r := range s.records {
+			if r.PatIndex == index {
+				return *r, nil
+			}
+		}
+	}
+
+	return PatRecord{}, ErrPatNotFound
+}
+
+// SavePat implements the PatStore interface.
+func (s *memoryPatStore) SavePat(record PatRecord) error {
+
+	if err := prepareRecord(&record); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.records {
+		if r.Uuid == record.Uuid || r.PatIndex == record.PatIndex {
+			return fmt.Errorf("pat token already exists")
+		}
+	}
+
+	s.records[record.Uuid] = &record
+
+	return nil
+}
+
+// RevokePat implements the PatStore interface.
+func (s *memoryPatStore) RevokePat(id string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[id]
+	if !ok {
+		return ErrPatNotFound
+	}
+	r.Revoked = true
+
+	return nil
+}
+
+// RecordUse implements the PatStore interface.
+func (s *memoryPatStore) RecordUse(id, index string, at time.Time) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[id]
+	if !ok {
+		return ErrPatNotFound
+	}
+	r.PatIndex = index
+	r.LastUsedAt = data.CustomTime{Time: at.UTC()}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package pat
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tdeslauriers/carapace/pkg/data"
+)
+
+// NewSqlPatStore creates a new PatStore backed by the pat table.
+func NewSqlPatStore(db *sql.DB) PatStore {
+	return &sqlPatStore{
+		sql: db,
+	}
+}
+
+var _ PatStore = (*sqlPatStore)(nil)
+
+// sqlDB combines Selector and Execer so the store field can be satisfied by
+// *sql.DB in production and by a mock in tests.
+type sqlDB interface {
+	data.Selector
+	data.Execer
+}
+
+// sqlPatStore is the concrete sql implementation of the PatStore interface.
+type sqlPatStore struct {
+	sql sqlDB
+}
+
+// FindPat implements the PatStore interface.
+func (s *sqlPatStore) FindPat(indexes []string) (PatRecord, error) {
+
+	if len(indexes) == 0 {
+		return PatRecord{}, fmt.Errorf("at least one blind index is required to look up a pat token")
+	}
+
+	args := make([]interface{}, len(indexes))
+	for i, index := range indexes {
+		args[i] = index
+	}
+
+	qry := fmt.Sprintf(`
+		SELECT
+			uuid,
+			pat_index,
+			client_id,
+			service_name,
+			scopes,
+			audiences,
+			created_at,
+			expires_at,
+			revoked,
+			last_used_at
+		FROM pat
+		WHERE pat_index IN (%s)
+		LIMIT 1`, strings.TrimSuffix(strings.Repeat("?, ", len(indexes)), ", "))
+
+	record, err := data.SelectOneRecord[PatRecord](s.sql, qry, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return PatRecord{}, ErrPatNotFound
+		}
+		return PatRecord{}, fmt.Errorf("failed to look up pat token: %v", err)
+	}
+
+	return record, nil
+}
+
+// SavePat implements the PatStore interface.
+func (s *sqlPatStore) SavePat(record PatRecord) error {
+
+	if err := prepareRecord(&record); err != nil {
+		return err
+	}
+
+	qry := `
+		INSERT INTO pat (
+			uuid,
+			pat_index,
+			client_id,
+			service_name,
+			scopes,
+			audiences,
+			created_at,
+			expires_at,
+			revoked,
+			last_used_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	if err := data.InsertRecord(s.sql, qry, record); err != nil {
+		return fmt.Errorf("failed to save pat token: %v", err)
+	}
+
+	return nil
+}
+
+// RevokePat implements the PatStore interface.
+func (s *sqlPatStore) RevokePat(id string) error {
+
+	if id == "" {
+		return fmt.Errorf("uuid is required to revoke a pat token")
+	}
+
+	qry := `UPDATE pat SET revoked = TRUE WHERE uuid = ?`
+	if err := s.update(id, qry, id); err != nil {
+		return fmt.Errorf("failed to revoke pat token: %w", err)
+	}
+
+	return nil
+}
+
+// RecordUse implements the PatStore interface.
+func (s *sqlPatStore) RecordUse(id, index string, at time.Time) error {
+
+	if id == "" || index == "" {
+		return fmt.Errorf("uuid and pat index are required to record pat token use")
+	}
+
+	qry := `UPDATE pat SET pat_index = ?, last_used_at = ? WHERE uuid = ?`
+	if err := s.update(id, qry, index, at.UTC(), id); err != nil {
+		return fmt.Errorf("failed to record pat token use: %w", err)
+	}
+
+	return nil
+}
+
+// update is a helper method which executes an update of the pat token with the uuid,
+// returning ErrPatNotFound if there is none, like the memory store.
+// MariaDB reports changed rather than matched rows, so an update which changes nothing,
+// eg, revoking a revoked token, is told apart from an unknown uuid by looking the uuid up.
+func (s *sqlPatStore) update(id, qry string, args ...interface{}) error {
+
+	result, err := s.sql.Exec(qry, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+
+	if rows > 0 {
+		return nil
+	}
+
+	exists, err := data.SelectExists(s.sql, `SELECT EXISTS(SELECT 1 FROM pat WHERE uuid = ?)`, id)
+	if err != nil {
+		return fmt.Errorf("failed to look up pat token: %v", err)
+	}
+
+	if !exists {
+		return ErrPatNotFound
+	}
+
+	return nil
+}
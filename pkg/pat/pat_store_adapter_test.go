@@ -0,0 +1,186 @@
+package pat
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Adapter tests verify SQL query structure and error propagation at the DB boundary.
+//
+// Success paths for FindPat, and updates which affect no rows, require constructing a real *sql.Row,
+// which is not possible without a registered driver.
+
+// mockSqlDB implements the sqlDB interface for testing.
+type mockSqlDB struct {
+	execFunc    func(string, ...interface{}) (sql.Result, error)
+	prepareFunc func(string) (*sql.Stmt, error)
+}
+
+func (m *mockSqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) { return nil, nil }
+func (m *mockSqlDB) QueryRow(query string, args ...interface{}) *sql.Row        { return nil }
+
+func (m *mockSqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if m.execFunc != nil {
+		return m.execFunc(query, args...)
+	}
+	return nil, nil
+}
+
+func (m *mockSqlDB) Prepare(query string) (*sql.Stmt, error) {
+	if m.prepareFunc != nil {
+		return m.prepareFunc(query)
+	}
+	return nil, nil
+}
+
+var _ sqlDB = (*mockSqlDB)(nil)
+
+// rowsAffected implements sql.Result for testing.
+type rowsAffected int64
+
+func (r rowsAffected) LastInsertId() (int64, error) { return 0, nil }
+func (r rowsAffected) RowsAffected() (int64, error) { return int64(r), nil }
+
+func TestSqlPatStore(t *testing.T) {
+
+	record := PatRecord{PatIndex: "1$abc", ClientId: "client-1", ServiceName: "pixie", Scopes: "r:gallery:*"}
+
+	tests := []struct {
+		name       string
+		call       func(PatStore) error
+		prepareErr error
+		errSubstr  string
+		wantQuery  []string
+	}{
+		{
+			name:      "find_no_indexes",
+			call:      func(s PatStore) error { _, err := s.FindPat(nil); return err },
+			errSubstr: "at least one blind index",
+		},
+		{
+			name:      "save_missing_index",
+			call:      func(s PatStore) error { return s.SavePat(PatRecord{ClientId: "client-1"}) },
+			errSubstr: "pat index is required",
+		},
+		{
+			name:      "save_missing_client",
+			call:      func(s PatStore) error { return s.SavePat(PatRecord{PatIndex: "1$abc"}) },
+			errSubstr: "client id is required",
+		},
+		{
+			name:       "save_prepare_error_propagated",
+			call:       func(s PatStore) error { return s.SavePat(record) },
+			prepareErr: errors.New("too many connections"),
+			errSubstr:  "too many connections",
+			wantQuery:  []string{"INSERT INTO pat", "pat_index", "audiences", "expires_at", "revoked", "last_used_at"},
+		},
+		{
+			name:      "revoke_missing_uuid",
+			call:      func(s PatStore) error { return s.RevokePat("") },
+			errSubstr: "uuid is required",
+		},
+		{
+			name:      "record_use_missing_index",
+			call:      func(s PatStore) error { return s.RecordUse("some-uuid", "", time.Now()) },
+			errSubstr: "are required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capturedQuery string
+			db := &mockSqlDB{
+				prepareFunc: func(query string) (*sql.Stmt, error) {
+					capturedQuery = query
+					return nil, tt.prepareErr
+				},
+			}
+			store := &sqlPatStore{sql: db}
+
+			err := tt.call(store)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.errSubstr) {
+				t.Fatalf("error %q does not contain %q", err.Error(), tt.errSubstr)
+			}
+			for _, expected := range tt.wantQuery {
+				if !strings.Contains(capturedQuery, expected) {
+					t.Errorf("query missing %q:\n%s", expected, capturedQuery)
+				}
+			}
+		})
+	}
+}
+
+func TestSqlPatStore_Updates(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		call      func(PatStore) error
+		rows      int64
+		execErr   error
+		errSubstr string
+		wantQuery []string
+	}{
+		{
+			name:      "revoke",
+			call:      func(s PatStore) error { return s.RevokePat("some-uuid") },
+			rows:      1,
+			wantQuery: []string{"UPDATE pat", "revoked = TRUE", "WHERE uuid = ?"},
+		},
+		{
+			name:      "revoke_exec_error_propagated",
+			call:      func(s PatStore) error { return s.RevokePat("some-uuid") },
+			execErr:   errors.New("too many connections"),
+			errSubstr: "too many connections",
+		},
+		{
+			name:      "record_use",
+			call:      func(s PatStore) error { return s.RecordUse("some-uuid", "2$def", time.Now()) },
+			rows:      1,
+			wantQuery: []string{"UPDATE pat", "pat_index = ?", "last_used_at = ?", "WHERE uuid = ?"},
+		},
+		{
+			name:      "record_use_exec_error_propagated",
+			call:      func(s PatStore) error { return s.RecordUse("some-uuid", "2$def", time.Now()) },
+			execErr:   errors.New("too many connections"),
+			errSubstr: "too many connections",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capturedQuery string
+			db := &mockSqlDB{
+				execFunc: func(query string, _ ...interface{}) (sql.Result, error) {
+					capturedQuery = query
+					if tt.execErr != nil {
+						return nil, tt.execErr
+					}
+					return rowsAffected(tt.rows), nil
+				},
+			}
+			store := &sqlPatStore{sql: db}
+
+			err := tt.call(store)
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %v", tt.errSubstr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, expected := range tt.wantQuery {
+				if !strings.Contains(capturedQuery, expected) {
+					t.Errorf("query missing %q:\n%s", expected, capturedQuery)
+				}
+			}
+		})
+	}
+}
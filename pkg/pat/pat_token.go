@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"strings"
 )
 
 // PatToken is an interface that defines methods for working with Personal Access Tokens (PATs).
@@ -14,35 +15,105 @@ type PatTokener interface {
 
 	// Generate generates a new 64 byte random secret byte-slice, a base64 url encoded string representation,
 	// and an error if any.
+	// Use GeneratePat for a prefixed pat token string in the format crp_<service>_<base62 secret>_<base62 crc32 checksum>.
 	Generate() ([]byte, string, error)
 
 	// ObtainIndex takes a PAT token byte slice and returns a hashed blind index of the token using HMAC SHA-256
 	// with the interfaces provided secret/pepper.  It returns the blind index as a hex,
 	// lowercase string and an error if any.
+	// A prefixed pat token string is indexed by its secret, so it has the same index as the raw secret from Generate.
+	// The index is prefixed with the current pepper's version, eg, 2$<hex>, unless the pepper is unversioned.
 	ObtainIndex(token []byte) (string, error)
 
 	// HashAndCompare takes in a PAT token byte-slice and a hashed blind index string,
 	// hashes the token using HMAC SHA-256 with the provided secret/pepper,
 	// and compares the resulting blind index with the provided blind index.
+	// The pepper is selected by the blind index's version.
 	// It returns true if they match, false otherwise, and an error if any.
 	HashAndCompare(token []byte, blindIndex string) (bool, error)
 }
 
+// PatKeyring is a PatTokener which blind indexes tokens with versioned peppers, so the pepper can be rotated.
+// Consumers of a PatTokener, eg, NewLocalVerifier, type-assert to it to look up and reindex tokens
+// indexed under previous peppers.
+type PatKeyring interface {
+	PatTokener
+
+	// ObtainIndexes returns the blind index of the token under every pepper in the keyring, current pepper first,
+	// so a token indexed before a pepper rotation can still be looked up, eg, WHERE pat_index IN (...).
+	ObtainIndexes(token []byte) ([]string, error)
+
+	// Reindex checks a token against its stored blind index and, if it matches but was indexed with
+	// a previous pepper, returns its index under the current pepper and true, so the caller can update the
+	// stored index after a successful use.  Once every stored index is current, previous peppers can be retired.
+	Reindex(token []byte, blindIndex string) (string, bool, error)
+}
+
+// Pepper is a versioned secret used to blind index pat tokens.
+// It should be a securely generated random byte-slice of at least 32 bytes.
+// The pepper of NewPatTokener is unversioned: its indexes have no version prefix.
+type Pepper struct {
+	Version string // eg, "2", must be letters and/or numbers
+	Secret  []byte
+}
+
+const (
+	// indexVersionSeparator separates a pepper version from the blind index, eg, 2$<hex>.
+	indexVersionSeparator = "$"
+
+	pepperVersionMax = 16
+)
+
 // newPatToken creates a new PatToken object with the provided secret/pepper byte-slice.
 func NewPatTokener(secret []byte) PatTokener {
 	return &patTokener{
-		pepper: secret,
+		current: Pepper{Secret: secret},
+		peppers: map[string][]byte{"": secret},
 	}
 }
 
-var _ PatTokener = (*patTokener)(nil)
+// NewPatKeyring creates a new PatKeyring object which indexes tokens with the current pepper and can still
+// compare tokens indexed with previous peppers, so the pepper can be rotated without invalidating stored indexes.
+// An unversioned previous pepper, ie, the secret of NewPatTokener, matches indexes without a version prefix.
+func NewPatKeyring(current Pepper, previous ...Pepper) (PatKeyring, error) {
+
+	if current.Version == "" {
+		return nil, fmt.Errorf("current pepper version is required")
+	}
+
+	peppers := make(map[string][]byte, len(previous)+1)
+	for _, p := range append([]Pepper{current}, previous...) {
+
+		if p.Version != "" && (len(p.Version) > pepperVersionMax || !isAlphanumeric(p.Version)) {
+			return nil, fmt.Errorf("pepper version %q must be 1 to %d letters and/or numbers", p.Version, pepperVersionMax)
+		}
+
+		if len(p.Secret) == 0 {
+			return nil, fmt.Errorf("pepper version %q secret is empty", p.Version)
+		}
+
+		if _, ok := peppers[p.Version]; ok {
+			return nil, fmt.Errorf("duplicate pepper version %q", p.Version)
+		}
+		peppers[p.Version] = p.Secret
+	}
+
+	return &patTokener{
+		current:  current,
+		peppers:  peppers,
+		previous: previous,
+	}, nil
+}
+
+var _ PatKeyring = (*patTokener)(nil)
 
 // patTokener is the concrete implementation of the PatToken interface.
 type patTokener struct {
 	// secret used for hashing, sometimes called the pepper, it is used to hash the token before
 	// storing it in a persistent store.
-	// It should be a securely generated random byte-slice of at least 32 bytes.
-	pepper []byte
+	current  Pepper
+	previous []Pepper          // older peppers which indexes may still be stored under, in order
+	peppers  map[string][]byte // version -> secret, including the current pepper
 }
 
 // Generate is the concrete implementation of the interface method which
@@ -51,7 +122,7 @@ type patTokener struct {
 func (p *patTokener) Generate() ([]byte, string, error) {
 
 	// generate a new 64 byte random secret
-	raw := make([]byte, 64)
+	raw := make([]byte, SecretSize)
 	if _, err := rand.Read(raw); err != nil {
 		return nil, "", fmt.Errorf("failed to generate random bytes for PAT token: %v", err)
 	}
@@ -69,23 +140,48 @@ func (p *patTokener) Generate() ([]byte, string, error) {
 func (p *patTokener) ObtainIndex(token []byte) (string, error) {
 
 	// return the blind index of the token
-	return p.obtainIndex(token)
+	return p.obtainIndex(token, p.current)
+}
+
+// ObtainIndexes is the concrete implementation of the interface method which
+// returns the blind index of the token under every pepper, current pepper first.
+func (p *patTokener) ObtainIndexes(token []byte) ([]string, error) {
+
+	indexes := make([]string, 0, len(p.previous)+1)
+	for _, pepper := range append([]Pepper{p.current}, p.previous...) {
+		index, err := p.obtainIndex(token, pepper)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, index)
+	}
+
+	return indexes, nil
 }
 
 // obtainIndex is a helper method that creates a blind index of the provided token using HMAC SHA-256
-// with the patTokener's pepper/secret.  It returns the blind index as a hex,
-// lowercase string and an error if any.
-func (p *patTokener) obtainIndex(token []byte) (string, error) {
+// with the pepper/secret.  It returns the blind index as a hex,
+// lowercase string prefixed by the pepper version, if any, and an error if any.
+func (p *patTokener) obtainIndex(token []byte, pepper Pepper) (string, error) {
 
 	// validate input is not empty
 	if len(token) == 0 {
 		return "", fmt.Errorf("cannot obtain blind index of empty token")
 	}
 
-	h := hmac.New(sha256.New, p.pepper)
+	// index the secret part of prefixed tokens: legacy tokens and raw secrets are indexed as is
+	if parsed, err := ParsePat(string(token)); err == nil {
+		token = parsed.Secret
+	}
+
+	h := hmac.New(sha256.New, pepper.Secret)
 	h.Write(token) // hmac docs indicate that Write on the hash will never return an error can ignore it here
 
-	return hex.EncodeToString(h.Sum(nil)), nil
+	if pepper.Version == "" {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	return pepper.Version + indexVersionSeparator + hex.EncodeToString(h.Sum(nil)), nil
 }
 
 // HashAndCompare takes in a PAT token byte-slice and a hashed blind index string,
@@ -104,10 +200,56 @@ func (p *patTokener) HashAndCompare(token []byte, blindIndex string) (bool, erro
 		return false, fmt.Errorf("cannot hash and compare to empty blind index")
 	}
 
-	hashedIndex, err := p.obtainIndex(token)
+	// select the pepper the index was created with
+	version := ""
+	if v, _, ok := strings.Cut(blindIndex, indexVersionSeparator); ok {
+		version = v
+	}
+
+	secret, ok := p.peppers[version]
+	if !ok {
+		return false, fmt.Errorf("unknown pepper version %q for blind index", version)
+	}
+
+	hashedIndex, err := p.obtainIndex(token, Pepper{Version: version, Secret: secret})
 	if err != nil {
 		return false, fmt.Errorf("failed to hash provided PAT token for comparision: %v", err)
 	}
 
 	return hmac.Equal([]byte(hashedIndex), []byte(blindIndex)), nil
 }
+
+// Reindex is the concrete implementation of the interface method which returns the token's index under
+// the current pepper, and true, if the token matches a blind index created with a previous pepper.
+func (p *patTokener) Reindex(token []byte, blindIndex string) (string, bool, error) {
+
+	match, err := p.HashAndCompare(token, blindIndex)
+	if err != nil {
+		return "", false, err
+	}
+
+	if !match {
+		return "", false, fmt.Errorf("PAT token does not match blind index")
+	}
+
+	current, err := p.obtainIndex(token, p.current)
+	if err != nil {
+		return "", false, err
+	}
+
+	if current == blindIndex {
+		return blindIndex, false, nil
+	}
+
+	return current, true, nil
+}
+
+// isAlphanumeric is a helper function which reports whether s only contains ascii letters and numbers.
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
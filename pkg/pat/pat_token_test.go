@@ -287,3 +287,154 @@ func TestHashAndCompare(t *testing.T) {
 		})
 	}
 }
+
+func TestNewPatKeyring(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		current   Pepper
+		previous  []Pepper
+		errSubstr string
+	}{
+		{
+			name:     "valid",
+			current:  Pepper{Version: "2", Secret: testAltPepper},
+			previous: []Pepper{{Secret: testPepper}},
+		},
+		{
+			name:      "current_unversioned",
+			current:   Pepper{Secret: testAltPepper},
+			errSubstr: "current pepper version is required",
+		},
+		{
+			name:      "invalid_version",
+			current:   Pepper{Version: "2$1", Secret: testAltPepper},
+			errSubstr: "letters and/or numbers",
+		},
+		{
+			name:      "empty_secret",
+			current:   Pepper{Version: "2", Secret: testAltPepper},
+			previous:  []Pepper{{Version: "1"}},
+			errSubstr: "secret is empty",
+		},
+		{
+			name:      "duplicate_version",
+			current:   Pepper{Version: "2", Secret: testAltPepper},
+			previous:  []Pepper{{Version: "2", Secret: testPepper}},
+			errSubstr: "duplicate pepper version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPatKeyring(tt.current, tt.previous...)
+			if tt.errSubstr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+				t.Fatalf("expected error containing %q, got %v", tt.errSubstr, err)
+			}
+		})
+	}
+}
+
+func TestPatKeyring_Rotation(t *testing.T) {
+
+	// indexes stored before the rotation: unversioned
+	legacy := NewPatTokener(testPepper)
+	legacyIndex, err := legacy.ObtainIndex(testToken)
+	if err != nil {
+		t.Fatalf("test setup: ObtainIndex() failed: %v", err)
+	}
+
+	keyring, err := NewPatKeyring(Pepper{Version: "2", Secret: testAltPepper}, Pepper{Secret: testPepper})
+	if err != nil {
+		t.Fatalf("NewPatKeyring() error: %v", err)
+	}
+
+	currentIndex, err := keyring.ObtainIndex(testToken)
+	if err != nil {
+		t.Fatalf("ObtainIndex() error: %v", err)
+	}
+	if !strings.HasPrefix(currentIndex, "2$") || len(currentIndex) != len("2$")+64 {
+		t.Fatalf("current index = %q, want 2$ followed by 64 hex characters", currentIndex)
+	}
+
+	indexes, err := keyring.ObtainIndexes(testToken)
+	if err != nil {
+		t.Fatalf("ObtainIndexes() error: %v", err)
+	}
+	if len(indexes) != 2 || indexes[0] != currentIndex || indexes[1] != legacyIndex {
+		t.Errorf("ObtainIndexes() = %v, want [%s %s]", indexes, currentIndex, legacyIndex)
+	}
+
+	tests := []struct {
+		name           string
+		token          []byte
+		blindIndex     string
+		wantMatch      bool
+		wantCompareErr bool
+		wantIndex      string
+		wantChanged    bool
+		errSubstr      string
+	}{
+		{
+			name:        "legacy_index_matches_and_is_reindexed",
+			token:       testToken,
+			blindIndex:  legacyIndex,
+			wantMatch:   true,
+			wantIndex:   currentIndex,
+			wantChanged: true,
+		},
+		{
+			name:       "current_index_matches_unchanged",
+			token:      testToken,
+			blindIndex: currentIndex,
+			wantMatch:  true,
+			wantIndex:  currentIndex,
+		},
+		{
+			name:       "different_token_does_not_match",
+			token:      testAltToken,
+			blindIndex: legacyIndex,
+			errSubstr:  "does not match",
+		},
+		{
+			name:           "retired_version",
+			token:          testToken,
+			blindIndex:     "1$" + strings.TrimPrefix(currentIndex, "2$"),
+			wantCompareErr: true,
+			errSubstr:      "unknown pepper version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := keyring.HashAndCompare(tt.token, tt.blindIndex)
+			if tt.wantCompareErr {
+				if err == nil {
+					t.Fatal("HashAndCompare: expected error for unknown version, got nil")
+				}
+			} else if err != nil || match != tt.wantMatch {
+				t.Fatalf("HashAndCompare = %v, %v, want %v", match, err, tt.wantMatch)
+			}
+
+			index, changed, err := keyring.Reindex(tt.token, tt.blindIndex)
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("Reindex: expected error containing %q, got %v", tt.errSubstr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Reindex: unexpected error: %v", err)
+			}
+			if index != tt.wantIndex || changed != tt.wantChanged {
+				t.Errorf("Reindex = %q, %v, want %q, %v", index, changed, tt.wantIndex, tt.wantChanged)
+			}
+		})
+	}
+}
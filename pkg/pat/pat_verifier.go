@@ -2,12 +2,16 @@ package pat
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/tdeslauriers/carapace/internal/util"
 	"github.com/tdeslauriers/carapace/pkg/connect"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
 	"github.com/tdeslauriers/carapace/pkg/session/provider"
 )
 
@@ -17,7 +21,8 @@ type Verifier interface {
 	// GetPatScopes takes in a PAT token string and returns the associated scopes from the upstream auth service
 	GetPatScopes(ctx context.Context, token string) (IntrospectResponse, error)
 
-	// ValidateScopes checks if the scopes associated with a pat token contain at least one of the required scopes.
+	// ValidateScopes checks if the scopes associated with a pat token satisfy the required scopes:
+	// at least one of them by default, or all of them if the verifier was created with jwt.MatchAll.
 	ValidateScopes(ctx context.Context, requiredScopes []string, token string) (bool, error)
 
 	// BuildAuthorized builds a AuthorizedService struct of a service and its id that have passed authorization
@@ -25,9 +30,43 @@ type Verifier interface {
 	BuildAuthorized(ctx context.Context, requiredScopes []string, token string) (AuthorizedService, error)
 }
 
+// CacheInvalidator is an interface for verifiers which cache introspection responses, see WithIntrospectionCache.
+// The Verifiers of this package implement it: callers type-assert a Verifier to it.
+type CacheInvalidator interface {
+
+	// Invalidate removes a pat token's cached introspection response, if any, so the next request
+	// introspects it again, eg, when the token is revoked or its scopes change.
+	Invalidate(token string)
+}
+
+// VerifierOption is a functional option for configuring the Verifier.
+type VerifierOption func(*verifier)
+
+// WithScopeMatch sets the scope matching mode: jwt.MatchAny (default) authorizes a pat granting any of the
+// required scopes, jwt.MatchAll only a pat granting all of them.
+func WithScopeMatch(mode jwt.ScopeMatch) VerifierOption {
+	return func(v *verifier) { v.scopeMatch = mode }
+}
+
+// WithIntrospectionCache caches introspection responses for the ttl, or for the negative ttl if the token is
+// inactive, so repeated requests with the same pat token do not each call the auth service.
+// At most maxEntries responses are cached, least recently used first out: 0 defaults to 10,000.
+// A token revoked at the auth service is accepted until its cached response expires, unless CacheInvalidator.Invalidate is called.
+func WithIntrospectionCache(ttl, negativeTtl time.Duration, maxEntries int) VerifierOption {
+	return func(v *verifier) { v.cache = newIntrospectionCache(ttl, negativeTtl, maxEntries) }
+}
+
+// WithAudience sets the name of the verifying service: a pat token restricted to audiences is only
+// authorized if the service is one of them.  Tokens without audiences are authorized regardless,
+// tokens with audiences are never authorized by a verifier without one.
+func WithAudience(svcName string) VerifierOption {
+	return func(v *verifier) { v.audience = svcName }
+}
+
 // NewVerifier creates a new Verifier interface with and returns and underlying concrete implementation.
-func NewVerifier(authSvcName string, c *connect.S2sCaller, p provider.S2sTokenProvider) Verifier {
-	return &verifier{
+func NewVerifier(authSvcName string, c *connect.S2sCaller, p provider.S2sTokenProvider, opts ...VerifierOption) Verifier {
+
+	v := &verifier{
 		authSvcName: authSvcName,
 		auth:        c,
 		tkn:         p,
@@ -37,15 +76,38 @@ func NewVerifier(authSvcName string, c *connect.S2sCaller, p provider.S2sTokenPr
 			With(slog.String(util.PackageKey, util.PackagePat)).
 			With(slog.String(util.ComponentKey, util.ComponentPatVerifier)),
 	}
+
+	// apply options if any
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	// the cache is keyed by a blind index under a per process key, so raw tokens are not held in memory
+	if v.cache != nil {
+		key := make([]byte, 32)
+		rand.Read(key) // never returns an error as of go 1.24
+		v.indexer = NewPatTokener(key)
+	}
+
+	return v
 }
 
 var _ Verifier = (*verifier)(nil)
+var _ CacheInvalidator = (*verifier)(nil)
 
 // verifier is the concrete implementation of the Verifier interface.
 type verifier struct {
 	authSvcName string             // ie, iam vs s2s authentication service
 	auth        *connect.S2sCaller // could be s2s or iam so leaving prop name generic
 	tkn         provider.S2sTokenProvider
+	scopeMatch  jwt.ScopeMatch      // any (default) or all of the required scopes must be granted
+	cache       *introspectionCache // nil if introspection responses are not cached
+	indexer     PatTokener          // blind indexes tokens for cache keys
+	audience    string              // the verifying service's name, if set
+
+	// local verification, see NewLocalVerifier: nil if pat tokens are introspected by the auth service
+	store   PatStore
+	tokener PatTokener
 
 	logger *slog.Logger
 }
@@ -54,15 +116,59 @@ type verifier struct {
 // so that a service endpoint can validate if the token is real, unexpired, and has the required scopes/permissions.
 func (v *verifier) GetPatScopes(ctx context.Context, token string) (IntrospectResponse, error) {
 
-	if len(token) < 64 || len(token) > 128 {
+	// reject malformed tokens without a round trip to the auth service
+	if err := checkPat(token); err != nil {
+		return IntrospectResponse{}, err
+	}
+
+	if v.cache == nil {
+		return v.lookup(ctx, token)
+	}
+
+	key, err := v.indexer.ObtainIndex([]byte(token))
+	if err != nil {
+		return IntrospectResponse{}, fmt.Errorf("failed to obtain cache key for pat token: %v", err)
+	}
+
+	return v.cache.get(ctx, key, func(ctx context.Context) (IntrospectResponse, error) {
+		return v.lookup(ctx, token)
+	})
+}
+
+// lookup is a helper method which verifies a pat token locally against the store, if the verifier has one,
+// or with the auth service's introspection endpoint.
+func (v *verifier) lookup(ctx context.Context, token string) (IntrospectResponse, error) {
+
+	if v.store != nil {
+		return v.introspectLocal(ctx, token)
+	}
+
+	return v.introspect(ctx, token)
+}
 
-		return IntrospectResponse{}, fmt.Errorf("invalid pat token length")
+// Invalidate implements the CacheInvalidator interface.
+func (v *verifier) Invalidate(token string) {
+
+	if v.cache == nil || token == "" {
+		return
+	}
+
+	key, err := v.indexer.ObtainIndex([]byte(token))
+	if err != nil {
+		v.logger.Error("failed to obtain cache key to invalidate pat token", slog.String("err", err.Error()))
+		return
 	}
 
+	v.cache.invalidate(key)
+}
+
+// introspect is a helper method which submits a pat token to the auth service's introspection endpoint.
+func (v *verifier) introspect(ctx context.Context, token string) (IntrospectResponse, error) {
+
 	s2sToken, err := v.tkn.GetServiceToken(ctx, v.authSvcName)
 	if err != nil {
 
-		return IntrospectResponse{}, fmt.Errorf("failed to get service token for %s: %v", v.authSvcName, err)
+		return IntrospectResponse{}, fmt.Errorf("failed to get service token for %s: %w", v.authSvcName, err)
 	}
 
 	ir, err := connect.PostToService[IntrospectCmd, IntrospectResponse](
@@ -74,37 +180,31 @@ func (v *verifier) GetPatScopes(ctx context.Context, token string) (IntrospectRe
 		IntrospectCmd{Token: token},
 	)
 	if err != nil {
-		return ir, fmt.Errorf("failed to introspect pat token: %v", err)
+		return ir, fmt.Errorf("failed to introspect pat token: %w", err)
 	}
 
 	return ir, nil
 }
 
-// ValidateScopes checks if the scopes associated with a pat token contain at least one of the required scopes.
+// ValidateScopes checks if the scopes associated with a pat token satisfy the required scopes.
 func (v *verifier) ValidateScopes(ctx context.Context, requiredScopes []string, token string) (bool, error) {
 
-	if len(token) < 64 || len(token) > 128 {
-		return false, fmt.Errorf("invalid pat token length, must be between 64 and 128 characters")
+	if err := checkPat(token); err != nil {
+		return false, err
 	}
 
 	if len(requiredScopes) == 0 {
 		return false, fmt.Errorf("no required scopes provided for validation")
 	}
 
-	// make map for efficient lookup of required scopes
-	requiredMap := make(map[string]struct{}, len(requiredScopes))
-	for _, scope := range requiredScopes {
-		requiredMap[scope] = struct{}{}
-	}
-
 	// get the scopes associated with the pat token from the auth service
 	resp, err := v.GetPatScopes(ctx, token)
 	if err != nil {
-		return false, fmt.Errorf("failed to get scopes for pat token: %v", err)
+		return false, fmt.Errorf("failed to get scopes for pat token: %w", err)
 	}
 
-	// validate that token has at least one of the required scopes and is active
-	if err := authorizeFromResponse(resp, requiredMap); err != nil {
+	// validate that token is active and has the required scopes
+	if err := authorizeFromResponse(resp, requiredScopes, v.scopeMatch, v.audience); err != nil {
 		return false, err
 	}
 
@@ -116,9 +216,8 @@ func (v *verifier) ValidateScopes(ctx context.Context, requiredScopes []string,
 func (v *verifier) BuildAuthorized(ctx context.Context, requiredScopes []string, token string) (AuthorizedService, error) {
 
 	// quick input check
-	if len(token) < 64 || len(token) > 128 {
-
-		return AuthorizedService{}, fmt.Errorf("invalid pat token length, must be between 64 and 128 characters")
+	if err := checkPat(token); err != nil {
+		return AuthorizedService{}, err
 	}
 
 	// if no required scopes provided return an error
@@ -127,21 +226,14 @@ func (v *verifier) BuildAuthorized(ctx context.Context, requiredScopes []string,
 		return AuthorizedService{}, fmt.Errorf("no required scopes provided for validation")
 	}
 
-	// make map for efficient lookup of required scopes
-	requiredMap := make(map[string]struct{}, len(requiredScopes))
-	for _, scope := range requiredScopes {
-
-		requiredMap[scope] = struct{}{}
-	}
-
 	// get the scopes associated with the pat token from the auth service
 	resp, err := v.GetPatScopes(ctx, token)
 	if err != nil {
-		return AuthorizedService{}, fmt.Errorf("failed to get scopes for pat token: %v", err)
+		return AuthorizedService{}, fmt.Errorf("failed to get scopes for pat token: %w", err)
 	}
 
-	// validate that token has at least one of the required scopes and is active
-	if err := authorizeFromResponse(resp, requiredMap); err != nil {
+	// validate that token is active and has the required scopes
+	if err := authorizeFromResponse(resp, requiredScopes, v.scopeMatch, v.audience); err != nil {
 		return AuthorizedService{}, err
 	}
 
@@ -152,27 +244,29 @@ func (v *verifier) BuildAuthorized(ctx context.Context, requiredScopes []string,
 	}, nil
 }
 
-// authorizeFromResponse validates that a PAT introspect response is active and contains at least one required scope.
-func authorizeFromResponse(resp IntrospectResponse, requiredMap map[string]struct{}) error {
+// authorizeFromResponse validates that a PAT introspect response is active, the audience is one of its audiences
+// if it is audience restricted, and its scopes satisfy the required scopes under the matching mode,
+// eg, a granted w:gallery:* satisfies a required w:gallery:album.
+func authorizeFromResponse(resp IntrospectResponse, requiredScopes []string, mode jwt.ScopeMatch, audience string) error {
 
 	if !resp.Active {
-		return fmt.Errorf("pat token is not active")
+		return ErrPatInactive
 	}
 
-	// TODO: add audiences check. Not a big deal for now since PATs are not audience restricted
-	// but good practice to check if we start using audiences in the future
+	if resp.Aud != "" && (audience == "" || !slices.Contains(strings.Fields(resp.Aud), audience)) {
+		return fmt.Errorf("%w: pat token is not valid for %q", jwt.ErrInvalidAudience, audience)
+	}
 
 	if len(resp.Scope) == 0 {
-		return fmt.Errorf("no scopes associated with pat token")
+		return fmt.Errorf("%w: no scopes associated with pat token", jwt.ErrMissingScope)
 	}
 
-	for scope := range strings.SplitSeq(resp.Scope, " ") {
-
-		if _, ok := requiredMap[scope]; ok {
-
-			return nil
+	if !jwt.MatchScopes(strings.Fields(resp.Scope), requiredScopes, mode) {
+		if mode == jwt.MatchAll {
+			return fmt.Errorf("%w: pat token does not have all of the required scopes", jwt.ErrMissingScope)
 		}
+		return fmt.Errorf("%w: pat token does not have any of the required scopes", jwt.ErrMissingScope)
 	}
 
-	return fmt.Errorf("pat token does not have any of the required scopes")
+	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/tdeslauriers/carapace/pkg/connect"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
 	"github.com/tdeslauriers/carapace/pkg/session/provider"
 )
 
@@ -80,6 +82,9 @@ var (
 	validPAT = strings.Repeat("A", 88)  // 88 chars, within [64, 128]
 	shortPAT = strings.Repeat("A", 63)  // 63 chars, below minimum
 	longPAT  = strings.Repeat("A", 129) // 129 chars, above maximum
+
+	prefixedPAT    = Pat{Service: "pixie", Secret: bytes.Repeat([]byte{7}, SecretSize)}.String()
+	badChecksumPAT = prefixedPAT[:len(prefixedPAT)-1] + "x" // fails the checksum offline
 )
 
 // ---- TestNewVerifier --------------------------------------------------------
@@ -94,28 +99,31 @@ func TestNewVerifier(t *testing.T) {
 // ---- TestAuthorizeFromResponse ----------------------------------------------
 
 func TestAuthorizeFromResponse(t *testing.T) {
-	requiredMap := map[string]struct{}{
-		"r:svc:*": {},
-		"w:svc:*": {},
-	}
+	required := []string{"r:svc:*", "w:svc:*"}
 
 	tests := []struct {
 		name      string
 		resp      IntrospectResponse
+		required  []string
+		mode      jwt.ScopeMatch
+		audience  string
 		wantErr   bool
 		errSubstr string
+		wantIs    error
 	}{
 		{
 			name:      "inactive_token",
 			resp:      IntrospectResponse{Active: false},
 			wantErr:   true,
 			errSubstr: "not active",
+			wantIs:    ErrPatInactive,
 		},
 		{
 			name:      "active_but_no_scopes",
 			resp:      IntrospectResponse{Active: true, Scope: ""},
 			wantErr:   true,
 			errSubstr: "no scopes",
+			wantIs:    jwt.ErrMissingScope,
 		},
 		{
 			name:      "active_no_matching_scopes",
@@ -138,11 +146,69 @@ func TestAuthorizeFromResponse(t *testing.T) {
 			resp:    IntrospectResponse{Active: true, Scope: "r:svc:* w:svc:*"},
 			wantErr: false,
 		},
+		{
+			name:     "wildcard_grant_satisfies_resource",
+			resp:     IntrospectResponse{Active: true, Scope: "w:gallery:*"},
+			required: []string{"w:gallery:album"},
+			wantErr:  false,
+		},
+		{
+			// a required wildcard is literal: a grant on one resource does not satisfy it
+			name:      "resource_grant_does_not_satisfy_required_wildcard",
+			resp:      IntrospectResponse{Active: true, Scope: "w:gallery:album"},
+			required:  []string{"w:gallery:*"},
+			wantErr:   true,
+			errSubstr: "required scopes",
+		},
+		{
+			name:    "match_all_every_scope_granted",
+			resp:    IntrospectResponse{Active: true, Scope: "r:svc:* w:svc:*"},
+			mode:    jwt.MatchAll,
+			wantErr: false,
+		},
+		{
+			name:      "match_all_one_scope_missing",
+			resp:      IntrospectResponse{Active: true, Scope: "r:svc:*"},
+			mode:      jwt.MatchAll,
+			wantErr:   true,
+			errSubstr: "all of the required scopes",
+			wantIs:    jwt.ErrForbidden,
+		},
+		{
+			name:     "audience_restricted_to_verifier",
+			resp:     IntrospectResponse{Active: true, Scope: "r:svc:*", Aud: "gallery pixie"},
+			audience: "pixie",
+			wantErr:  false,
+		},
+		{
+			name:      "audience_restricted_to_other_service",
+			resp:      IntrospectResponse{Active: true, Scope: "r:svc:*", Aud: "gallery"},
+			audience:  "pixie",
+			wantErr:   true,
+			errSubstr: "incorrect audience",
+			wantIs:    jwt.ErrInvalidAudience,
+		},
+		{
+			name:    "audience_restricted_verifier_without_audience",
+			resp:    IntrospectResponse{Active: true, Scope: "r:svc:*", Aud: "gallery"},
+			wantErr: true,
+			wantIs:  jwt.ErrInvalidAudience,
+		},
+		{
+			name:     "unrestricted_token_any_audience",
+			resp:     IntrospectResponse{Active: true, Scope: "r:svc:*"},
+			audience: "pixie",
+			wantErr:  false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := authorizeFromResponse(tt.resp, requiredMap)
+			req := required
+			if tt.required != nil {
+				req = tt.required
+			}
+			err := authorizeFromResponse(tt.resp, req, tt.mode, tt.audience)
 			if tt.wantErr {
 				if err == nil {
 					t.Fatal("expected error, got nil")
@@ -150,6 +216,9 @@ func TestAuthorizeFromResponse(t *testing.T) {
 				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
 					t.Errorf("expected error containing %q, got %q", tt.errSubstr, err.Error())
 				}
+				if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+					t.Errorf("expected errors.Is(err, %v), got %v", tt.wantIs, err)
+				}
 				return
 			}
 			if err != nil {
@@ -191,6 +260,24 @@ func TestGetPatScopes(t *testing.T) {
 			wantErr:   true,
 			errSubstr: "invalid pat token length",
 		},
+		{
+			// no token provider or client: reaching the auth service would panic
+			name:      "bad_checksum_rejected_offline",
+			token:     badChecksumPAT,
+			wantErr:   true,
+			errSubstr: "invalid pat token checksum",
+		},
+		{
+			name:      "prefixed_token_introspected",
+			token:     prefixedPAT,
+			tokenProv: okTokenProvider(),
+			tlsClient: &mockTlsClient{
+				DoFunc: func(_ *http.Request) (*http.Response, error) {
+					return jsonResp(http.StatusOK, successResp), nil
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name:  "token_provider_fails",
 			token: validPAT,
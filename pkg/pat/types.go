@@ -1,22 +1,14 @@
 package pat
 
-import "fmt"
-
 // IntrospectCmd is a model used as a command to submit a PAT token for introspection
 type IntrospectCmd struct {
 	Token string `json:"token"`
 }
 
 // Validate checks if the introspect command is valid/well-formed
-// It is a sanity check of the token length only.
+// It is a sanity check of the token format only: the checksum of prefixed tokens, the length of legacy tokens.
 func (cmd *IntrospectCmd) Validate() error {
-
-	// quick sanity check of token length
-	if len(cmd.Token) < 64 || len(cmd.Token) > 128 {
-		return fmt.Errorf("invalid pat token length")
-	}
-
-	return nil
+	return checkPat(cmd.Token)
 }
 
 // IntrospectResponse is a model used as a response from a PAT token introspection
@@ -28,6 +20,7 @@ type IntrospectResponse struct {
 	Sub         string `json:"sub,omitempty"`         // client id associated with the token
 	ServiceName string `json:"client_name,omitempty"` // client name associated with the token (convenience field added by me)
 	Iss         string `json:"iss,omitempty"`         // issueing service name
+	Aud         string `json:"aud,omitempty"`         // space delimited list of services which accept the token, empty if unrestricted
 }
 
 // AuthorizedService is a model representing a service and it's id that have passed authorization checks
@@ -0,0 +1,307 @@
+package refresh
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tdeslauriers/carapace/pkg/data"
+	"github.com/tdeslauriers/carapace/pkg/session/types"
+)
+
+// ErrRefreshNotFound is returned when no refresh token matches the token presented.
+var ErrRefreshNotFound = errors.New("refresh token not found")
+
+// tableName restricts table names, which cannot be query parameters, to plain sql identifiers.
+var tableName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// NewService creates a new types.RefreshFamilyService for the S2sRefresh or UserRefresh model, backed by the sql table,
+// eg, NewService[types.UserRefresh](db, indexer, cryptor, "refresh").  The table's columns are the model's db tags.
+//
+// Refresh tokens and the client id (s2s) or username (user) are encrypted at rest with the cryptor,
+// and looked up by their blind indexes from the indexer: RefreshIndex, and ClientIndex or UsernameIndex.
+func NewService[T types.Refresh](db *sql.DB, i data.Indexer, c data.Cryptor, table string) (types.RefreshFamilyService[T], error) {
+
+	if !tableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid refresh table name %q", table)
+	}
+
+	return &refreshService[T]{
+		sql:     db,
+		indexer: i,
+		cryptor: c,
+		table:   table,
+		columns: columnsOf[T](),
+	}, nil
+}
+
+var (
+	_ types.RefreshFamilyService[types.S2sRefresh]  = (*refreshService[types.S2sRefresh])(nil)
+	_ types.RefreshFamilyService[types.UserRefresh] = (*refreshService[types.UserRefresh])(nil)
+)
+
+// sqlDB combines Selector and Execer so the service field can be satisfied by
+// *sql.DB in production and by a mock in tests.
+type sqlDB interface {
+	data.Selector
+	data.Execer
+}
+
+// refreshService is the concrete sql implementation of the types.RefreshFamilyService interface.
+type refreshService[T types.Refresh] struct {
+	sql     sqlDB
+	indexer data.Indexer
+	cryptor data.Cryptor
+	table   string
+	columns []string // in model field order, the order data.SelectOneRecord scans into
+}
+
+// GetRefreshToken implements the types.RefreshService interface.  The returned record is decrypted.
+func (s *refreshService[T]) GetRefreshToken(ctx context.Context, token string) (*T, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	index, err := s.indexer.ObtainBlindIndex(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain blind index for refresh token: %v", err)
+	}
+
+	qry := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM %s
+		WHERE refresh_index = ?`, strings.Join(s.columns, ",\n\t\t\t"), s.table)
+
+	record, err := data.SelectOneRecord[T](s.sql, qry, index)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRefreshNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve refresh token: %w", err)
+	}
+
+	if err := s.decrypt(&record); err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// PersistRefresh implements the types.RefreshService interface.  The blind indexes are computed from the
+// plaintext fields, and the refresh token and client id or username are encrypted before insert.
+// A missing uuid or created at is generated, and a refresh token without a family starts a new one.
+func (s *refreshService[T]) PersistRefresh(refresh T) error {
+
+	if err := s.prepare(&refresh); err != nil {
+		return err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(s.columns)), ", ")
+	qry := fmt.Sprintf(`
+		INSERT INTO %s (
+			%s
+		) VALUES (%s)`, s.table, strings.Join(s.columns, ",\n\t\t\t"), placeholders)
+
+	if err := data.InsertRecord(s.sql, qry, refresh); err != nil {
+		return fmt.Errorf("failed to persist refresh token: %v", err)
+	}
+
+	return nil
+}
+
+// DestroyRefresh implements the types.RefreshService interface.
+func (s *refreshService[T]) DestroyRefresh(token string) error {
+
+	index, err := s.indexer.ObtainBlindIndex(token)
+	if err != nil {
+		return fmt.Errorf("failed to obtain blind index for refresh token: %v", err)
+	}
+
+	qry := fmt.Sprintf(`DELETE FROM %s WHERE refresh_index = ?`, s.table)
+	if err := data.DeleteRecord(s.sql, qry, index); err != nil {
+		return fmt.Errorf("failed to destroy refresh token: %v", err)
+	}
+
+	return nil
+}
+
+// RevokeRefresh implements the types.RefreshService interface.
+func (s *refreshService[T]) RevokeRefresh(token string) error {
+
+	index, err := s.indexer.ObtainBlindIndex(token)
+	if err != nil {
+		return fmt.Errorf("failed to obtain blind index for refresh token: %v", err)
+	}
+
+	qry := fmt.Sprintf(`UPDATE %s SET revoked = TRUE WHERE refresh_index = ?`, s.table)
+	if err := data.UpdateRecord(s.sql, qry, index); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %v", err)
+	}
+
+	return nil
+}
+
+// MarkRotated implements the types.RefreshFamilyService interface.  The update only matches a token which is not
+// already rotated, so if no row is updated the token was rotated concurrently: types.ErrRefreshReused.
+func (s *refreshService[T]) MarkRotated(token string) error {
+
+	index, err := s.indexer.ObtainBlindIndex(token)
+	if err != nil {
+		return fmt.Errorf("failed to obtain blind index for refresh token: %v", err)
+	}
+
+	qry := fmt.Sprintf(`UPDATE %s SET rotated = TRUE WHERE refresh_index = ? AND rotated = FALSE`, s.table)
+	result, err := s.sql.Exec(qry, index)
+	if err != nil {
+		return fmt.Errorf("failed to mark refresh token rotated: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected marking refresh token rotated: %v", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("%w: refresh token already rotated", types.ErrRefreshReused)
+	}
+
+	return nil
+}
+
+// RevokeFamily implements the types.RefreshFamilyService interface.
+func (s *refreshService[T]) RevokeFamily(familyId string) error {
+
+	if familyId == "" {
+		return fmt.Errorf("family id is required to revoke a refresh token family")
+	}
+
+	qry := fmt.Sprintf(`UPDATE %s SET revoked = TRUE WHERE family_id = ?`, s.table)
+	if err := data.UpdateRecord(s.sql, qry, familyId); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %v", err)
+	}
+
+	return nil
+}
+
+// prepare is a helper method which fills in generated fields, computes the blind indexes,
+// and encrypts the sensitive fields of a refresh record before it is persisted.
+func (s *refreshService[T]) prepare(refresh *T) error {
+
+	var (
+		token, identity           *string
+		refreshIndex, identityIdx *string
+		id, familyId              *string
+		createdAt                 *data.CustomTime
+		identityName              string
+	)
+
+	switch r := any(refresh).(type) {
+	case *types.S2sRefresh:
+		token, identity, refreshIndex, identityIdx = &r.RefreshToken, &r.ClientId, &r.RefreshIndex, &r.ClientIndex
+		id, familyId, createdAt, identityName = &r.Uuid, &r.FamilyId, &r.CreatedAt, "client id"
+	case *types.UserRefresh:
+		token, identity, refreshIndex, identityIdx = &r.RefreshToken, &r.Username, &r.RefreshIndex, &r.UsernameIndex
+		id, familyId, createdAt, identityName = &r.Uuid, &r.FamilyId, &r.CreatedAt, "username"
+	}
+
+	if *token == "" {
+		return fmt.Errorf("refresh token is required")
+	}
+
+	if *identity == "" {
+		return fmt.Errorf("%s is required", identityName)
+	}
+
+	if *id == "" {
+		generated, err := uuid.NewRandom()
+		if err != nil {
+			return fmt.Errorf("failed to generate uuid for refresh token: %v", err)
+		}
+		*id = generated.String()
+	}
+
+	if createdAt.IsZero() {
+		*createdAt = data.CustomTime{Time: time.Now().UTC()}
+	}
+
+	// not rotated from another token: a new login
+	if *familyId == "" {
+		if err := types.StartFamily(refresh); err != nil {
+			return err
+		}
+	}
+
+	index, err := s.indexer.ObtainBlindIndex(*token)
+	if err != nil {
+		return fmt.Errorf("failed to obtain blind index for refresh token: %v", err)
+	}
+	*refreshIndex = index
+
+	index, err = s.indexer.ObtainBlindIndex(*identity)
+	if err != nil {
+		return fmt.Errorf("failed to obtain blind index for %s: %v", identityName, err)
+	}
+	*identityIdx = index
+
+	encrypted, err := s.cryptor.EncryptServiceData([]byte(*token))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt refresh token: %v", err)
+	}
+	*token = encrypted
+
+	encrypted, err = s.cryptor.EncryptServiceData([]byte(*identity))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %v", identityName, err)
+	}
+	*identity = encrypted
+
+	return nil
+}
+
+// decrypt is a helper method which decrypts the sensitive fields of a refresh record read from the database.
+func (s *refreshService[T]) decrypt(refresh *T) error {
+
+	var token, identity *string
+	var identityName string
+
+	switch r := any(refresh).(type) {
+	case *types.S2sRefresh:
+		token, identity, identityName = &r.RefreshToken, &r.ClientId, "client id"
+	case *types.UserRefresh:
+		token, identity, identityName = &r.RefreshToken, &r.Username, "username"
+	}
+
+	decrypted, err := s.cryptor.DecryptServiceData(*token)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt refresh token: %v", err)
+	}
+	*token = string(decrypted)
+
+	decrypted, err = s.cryptor.DecryptServiceData(*identity)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %v", identityName, err)
+	}
+	*identity = string(decrypted)
+
+	return nil
+}
+
+// columnsOf is a helper function which returns the db tags of the refresh model in field order.
+func columnsOf[T types.Refresh]() []string {
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	columns := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		columns = append(columns, t.Field(i).Tag.Get("db"))
+	}
+
+	return columns
+}
@@ -0,0 +1,300 @@
+package refresh
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tdeslauriers/carapace/pkg/data"
+	"github.com/tdeslauriers/carapace/pkg/session/types"
+)
+
+// Service tests verify SQL query structure, field encryption, and error propagation at the DB boundary.
+//
+// Success paths for GetRefreshToken require constructing a real *sql.Row,
+// which is not possible without a registered driver.
+
+// mockSqlDB implements the sqlDB interface for testing.
+type mockSqlDB struct {
+	execFunc    func(string, ...interface{}) (sql.Result, error)
+	prepareFunc func(string) (*sql.Stmt, error)
+}
+
+func (m *mockSqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) { return nil, nil }
+func (m *mockSqlDB) QueryRow(query string, args ...interface{}) *sql.Row        { return nil }
+
+func (m *mockSqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if m.execFunc != nil {
+		return m.execFunc(query, args...)
+	}
+	return nil, nil
+}
+
+func (m *mockSqlDB) Prepare(query string) (*sql.Stmt, error) {
+	if m.prepareFunc != nil {
+		return m.prepareFunc(query)
+	}
+	return nil, nil
+}
+
+var _ sqlDB = (*mockSqlDB)(nil)
+
+// rowsAffected implements sql.Result for testing.
+type rowsAffected int64
+
+func (r rowsAffected) LastInsertId() (int64, error) { return 0, nil }
+func (r rowsAffected) RowsAffected() (int64, error) { return int64(r), nil }
+
+// testService is a helper which creates a service with a real indexer and cryptor over the mock db.
+func testService[T types.Refresh](t *testing.T, db sqlDB) *refreshService[T] {
+	t.Helper()
+
+	indexer, err := data.NewIndexer([]byte(strings.Repeat("i", 32)))
+	if err != nil {
+		t.Fatalf("failed to create indexer: %v", err)
+	}
+	cryptor, err := data.NewServiceAesGcmKey(data.GenerateAesGcmKey())
+	if err != nil {
+		t.Fatalf("failed to create cryptor: %v", err)
+	}
+
+	return &refreshService[T]{
+		sql:     db,
+		indexer: indexer,
+		cryptor: cryptor,
+		table:   "refresh",
+		columns: columnsOf[T](),
+	}
+}
+
+// ---- NewService ----
+
+func TestNewService_TableName(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		table   string
+		wantErr bool
+	}{
+		{name: "valid", table: "user_refresh"},
+		{name: "empty", table: "", wantErr: true},
+		{name: "injection", table: "refresh; DROP TABLE account", wantErr: true},
+		{name: "quoted", table: "`refresh`", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewService[types.UserRefresh](nil, nil, nil, tt.table)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestColumnsOf(t *testing.T) {
+
+	columns := columnsOf[types.S2sRefresh]()
+	want := []string{"uuid", "refresh_index", "service_name", "refresh_token", "client_uuid", "client_index",
+		"created_at", "revoked", "family_id", "parent_index", "rotated"}
+
+	if strings.Join(columns, ",") != strings.Join(want, ",") {
+		t.Errorf("columnsOf() = %v, want %v", columns, want)
+	}
+}
+
+// ---- prepare / decrypt ----
+
+func TestPrepareDecrypt_RoundTrip(t *testing.T) {
+
+	s := testService[types.UserRefresh](t, &mockSqlDB{})
+
+	original := types.UserRefresh{
+		ClientId:     "client-1",
+		RefreshToken: "a7c3e1f0-4b2d-4e8a-9f61-0d2b3c4e5f67",
+		Username:     "darth.vader@empire.com",
+		Scopes:       "r:gallery:*",
+	}
+
+	record := original
+	if err := s.prepare(&record); err != nil {
+		t.Fatalf("prepare() error: %v", err)
+	}
+
+	if record.Uuid == "" || record.CreatedAt.IsZero() || record.FamilyId == "" {
+		t.Errorf("expected uuid, created at, and family id to be generated, got %+v", record)
+	}
+	if record.RefreshToken == original.RefreshToken || record.Username == original.Username {
+		t.Error("expected refresh token and username to be encrypted")
+	}
+
+	wantIndex, _ := s.indexer.ObtainBlindIndex(original.RefreshToken)
+	if record.RefreshIndex != wantIndex {
+		t.Errorf("refresh index = %q, want %q", record.RefreshIndex, wantIndex)
+	}
+	wantIndex, _ = s.indexer.ObtainBlindIndex(original.Username)
+	if record.UsernameIndex != wantIndex {
+		t.Errorf("username index = %q, want %q", record.UsernameIndex, wantIndex)
+	}
+
+	if err := s.decrypt(&record); err != nil {
+		t.Fatalf("decrypt() error: %v", err)
+	}
+	if record.RefreshToken != original.RefreshToken || record.Username != original.Username {
+		t.Errorf("decrypted token/username = %q/%q, want %q/%q",
+			record.RefreshToken, record.Username, original.RefreshToken, original.Username)
+	}
+}
+
+func TestPrepare_S2s(t *testing.T) {
+
+	s := testService[types.S2sRefresh](t, &mockSqlDB{})
+
+	tests := []struct {
+		name      string
+		record    types.S2sRefresh
+		errSubstr string
+	}{
+		{
+			name:   "valid_keeps_family",
+			record: types.S2sRefresh{RefreshToken: "token", ClientId: "client", FamilyId: "family-1", ParentIndex: "parent"},
+		},
+		{name: "missing_token", record: types.S2sRefresh{ClientId: "client"}, errSubstr: "refresh token is required"},
+		{name: "missing_client_id", record: types.S2sRefresh{RefreshToken: "token"}, errSubstr: "client id is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := tt.record
+			err := s.prepare(&record)
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %v", tt.errSubstr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("prepare() error: %v", err)
+			}
+			if record.FamilyId != tt.record.FamilyId || record.ParentIndex != tt.record.ParentIndex {
+				t.Errorf("family/parent = %q/%q, want rotated lineage kept", record.FamilyId, record.ParentIndex)
+			}
+			wantIndex, _ := s.indexer.ObtainBlindIndex(tt.record.ClientId)
+			if record.ClientIndex != wantIndex {
+				t.Errorf("client index = %q, want %q", record.ClientIndex, wantIndex)
+			}
+		})
+	}
+}
+
+// ---- queries ----
+
+func TestRefreshService_Queries(t *testing.T) {
+
+	prepareErr := errors.New("too many connections")
+
+	tests := []struct {
+		name      string
+		call      func(types.RefreshFamilyService[types.UserRefresh]) error
+		errSubstr string
+		wantQuery []string
+	}{
+		{
+			name: "persist",
+			call: func(s types.RefreshFamilyService[types.UserRefresh]) error {
+				return s.PersistRefresh(types.UserRefresh{RefreshToken: "token", Username: "user"})
+			},
+			errSubstr: "too many connections",
+			wantQuery: []string{"INSERT INTO refresh", "family_id", "parent_index", "rotated",
+				"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"},
+		},
+		{
+			name:      "destroy",
+			call:      func(s types.RefreshFamilyService[types.UserRefresh]) error { return s.DestroyRefresh("token") },
+			errSubstr: "failed to destroy refresh token",
+			wantQuery: []string{"DELETE FROM refresh", "refresh_index = ?"},
+		},
+		{
+			name:      "revoke",
+			call:      func(s types.RefreshFamilyService[types.UserRefresh]) error { return s.RevokeRefresh("token") },
+			errSubstr: "failed to revoke refresh token",
+			wantQuery: []string{"UPDATE refresh", "revoked = TRUE", "refresh_index = ?"},
+		},
+		{
+			name:      "revoke_family",
+			call:      func(s types.RefreshFamilyService[types.UserRefresh]) error { return s.RevokeFamily("family-1") },
+			errSubstr: "failed to revoke refresh token family",
+			wantQuery: []string{"UPDATE refresh", "revoked = TRUE", "family_id = ?"},
+		},
+		{
+			name:      "revoke_family_empty",
+			call:      func(s types.RefreshFamilyService[types.UserRefresh]) error { return s.RevokeFamily("") },
+			errSubstr: "family id is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			db := &mockSqlDB{prepareFunc: func(q string) (*sql.Stmt, error) {
+				got = q
+				return nil, prepareErr
+			}}
+
+			err := tt.call(testService[types.UserRefresh](t, db))
+			if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+				t.Fatalf("expected error containing %q, got %v", tt.errSubstr, err)
+			}
+			for _, expected := range tt.wantQuery {
+				if !strings.Contains(got, expected) {
+					t.Errorf("query missing %q:\n%s", expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkRotated(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		result    sql.Result
+		execErr   error
+		wantIs    error
+		errSubstr string
+	}{
+		{name: "rotated", result: rowsAffected(1)},
+		{name: "already_rotated", result: rowsAffected(0), wantIs: types.ErrRefreshReused},
+		{name: "exec_error", execErr: errors.New("deadlock"), errSubstr: "deadlock"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			db := &mockSqlDB{execFunc: func(q string, _ ...interface{}) (sql.Result, error) {
+				got = q
+				return tt.result, tt.execErr
+			}}
+
+			err := testService[types.S2sRefresh](t, db).MarkRotated("token")
+
+			if !strings.Contains(got, "rotated = FALSE") {
+				t.Errorf("expected conditional update, got query:\n%s", got)
+			}
+
+			switch {
+			case tt.wantIs != nil:
+				if !errors.Is(err, tt.wantIs) {
+					t.Errorf("expected error wrapping %v, got %v", tt.wantIs, err)
+				}
+			case tt.errSubstr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Errorf("expected error containing %q, got %v", tt.errSubstr, err)
+				}
+			case err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
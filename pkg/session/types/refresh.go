@@ -29,7 +29,22 @@ type RefreshService[T Refresh] interface {
 	RevokeRefresh(token string) error
 }
 
+// RefreshFamilyService is a RefreshService which tracks refresh token families, so refresh tokens can be
+// rotated with reuse detection, see RotateRefresh.
+type RefreshFamilyService[T Refresh] interface {
+	RefreshService[T]
+
+	// MarkRotated marks a refresh token as rotated, ie, exchanged for a child token, so it cannot be used again.
+	// It must return an error wrapping ErrRefreshReused if the token is already rotated,
+	// so concurrent rotations of the same token cannot both succeed, eg, UPDATE ... WHERE rotated = FALSE.
+	MarkRotated(token string) error
+
+	// RevokeFamily revokes every refresh token in the family by setting their revoked flags to true
+	RevokeFamily(familyId string) error
+}
+
 // S2sRefresh is a model for the service-to-service refresh table data.
+// The family_id, parent_index, and rotated columns must be NOT NULL, see the upgrade notes in the README.
 type S2sRefresh struct {
 	Uuid         string          `db:"uuid"`
 	RefreshIndex string          `db:"refresh_index"`
@@ -39,6 +54,9 @@ type S2sRefresh struct {
 	ClientIndex  string          `db:"client_index"`
 	CreatedAt    data.CustomTime `db:"created_at"`
 	Revoked      bool            `db:"revoked"`
+	FamilyId     string          `db:"family_id"`    // shared by every token rotated from the same login
+	ParentIndex  string          `db:"parent_index"` // refresh index of the token this one was rotated from, if any
+	Rotated      bool            `db:"rotated"`
 }
 
 // S2sRefreshCmd is a struct for a s2s refresh token request endpoint to consume.
@@ -65,6 +83,7 @@ func (cmd S2sRefreshCmd) ValidateCmd() error {
 }
 
 // UserRefresh is a model for the user refresh table data.
+// The family_id, parent_index, and rotated columns must be NOT NULL, see the upgrade notes in the README.
 type UserRefresh struct {
 	Uuid          string          `db:"uuid"`
 	RefreshIndex  string          `db:"refresh_index"`
@@ -75,6 +94,9 @@ type UserRefresh struct {
 	Scopes        string          `db:"scopes"`
 	CreatedAt     data.CustomTime `db:"created_at"`
 	Revoked       bool            `db:"revoked"`
+	FamilyId      string          `db:"family_id"`    // shared by every token rotated from the same login
+	ParentIndex   string          `db:"parent_index"` // refresh index of the token this one was rotated from, if any
+	Rotated       bool            `db:"rotated"`
 }
 
 // UserRefreshCmd is a struct for a user refresh token request endpoint to consume.
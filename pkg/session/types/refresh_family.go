@@ -0,0 +1,112 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrRefreshRevoked is returned when a revoked refresh token, or a token of a revoked family, is presented.
+	ErrRefreshRevoked = errors.New("refresh token has been revoked")
+
+	// ErrRefreshReused is returned when an already rotated refresh token is presented again.
+	// Either the legitimate client or an attacker holds a stolen copy, so the whole family is revoked.
+	ErrRefreshReused = errors.New("refresh token reuse detected")
+)
+
+// familyMember is implemented by the refresh models so the generic family functions
+// can read and set their lineage fields.
+type familyMember interface {
+	lineage() (familyId, refreshIndex string, rotated, revoked bool)
+	setLineage(familyId, parentIndex string)
+}
+
+var (
+	_ familyMember = (*S2sRefresh)(nil)
+	_ familyMember = (*UserRefresh)(nil)
+)
+
+func (r *S2sRefresh) lineage() (string, string, bool, bool) {
+	return r.FamilyId, r.RefreshIndex, r.Rotated, r.Revoked
+}
+
+func (r *S2sRefresh) setLineage(familyId, parentIndex string) {
+	r.FamilyId, r.ParentIndex = familyId, parentIndex
+}
+
+func (r *UserRefresh) lineage() (string, string, bool, bool) {
+	return r.FamilyId, r.RefreshIndex, r.Rotated, r.Revoked
+}
+
+func (r *UserRefresh) setLineage(familyId, parentIndex string) {
+	r.FamilyId, r.ParentIndex = familyId, parentIndex
+}
+
+// StartFamily assigns a new family id to a refresh token issued at login, ie, not rotated from another token.
+func StartFamily[T Refresh](refresh *T) error {
+
+	familyId, err := uuid.NewRandom()
+	if err != nil {
+		return fmt.Errorf("failed to generate refresh token family id: %v", err)
+	}
+
+	any(refresh).(familyMember).setLineage(familyId.String(), "")
+
+	return nil
+}
+
+// RotateRefresh exchanges a presented refresh token for its replacement, next, which joins the presented token's family.
+// The presented token is marked rotated before next is persisted.  If the presented token was already rotated,
+// the whole family is revoked and an error wrapping ErrRefreshReused is returned: the caller must not issue new tokens.
+// Returns the presented token's record, eg, to carry its scopes or client over to the new access token.
+func RotateRefresh[T Refresh](ctx context.Context, svc RefreshFamilyService[T], token string, next T) (*T, error) {
+
+	current, err := svc.GetRefreshToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	familyId, refreshIndex, rotated, revoked := any(current).(familyMember).lineage()
+
+	// tokens persisted before family tracking have an empty family, the column default: derive one from the presented token,
+	// so a later reuse of it resolves to the same family as its children
+	if familyId == "" {
+		familyId = refreshIndex
+	}
+
+	if rotated {
+		return nil, revokeReused(svc, familyId)
+	}
+
+	if revoked {
+		return nil, ErrRefreshRevoked
+	}
+
+	// claim the presented token: a concurrent rotation of the same token fails here
+	if err := svc.MarkRotated(token); err != nil {
+		if errors.Is(err, ErrRefreshReused) {
+			return nil, revokeReused(svc, familyId)
+		}
+		return nil, fmt.Errorf("failed to mark refresh token rotated: %v", err)
+	}
+
+	any(&next).(familyMember).setLineage(familyId, refreshIndex)
+	if err := svc.PersistRefresh(next); err != nil {
+		return nil, fmt.Errorf("failed to persist rotated refresh token: %v", err)
+	}
+
+	return current, nil
+}
+
+// revokeReused is a helper function which revokes a family after reuse of one of its tokens was detected.
+func revokeReused[T Refresh](svc RefreshFamilyService[T], familyId string) error {
+
+	if err := svc.RevokeFamily(familyId); err != nil {
+		return fmt.Errorf("%w: failed to revoke token family %s: %v", ErrRefreshReused, familyId, err)
+	}
+
+	return fmt.Errorf("%w: token family %s revoked", ErrRefreshReused, familyId)
+}
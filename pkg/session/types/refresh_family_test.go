@@ -0,0 +1,241 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// memRefreshService is an in-memory RefreshFamilyService keyed by token, recording the families revoked.
+type memRefreshService struct {
+	mu       sync.Mutex
+	tokens   map[string]*UserRefresh
+	revoked  []string
+	failMark error
+}
+
+func newMemRefreshService() *memRefreshService {
+	return &memRefreshService{tokens: make(map[string]*UserRefresh)}
+}
+
+func (m *memRefreshService) GetRefreshToken(_ context.Context, token string) (*UserRefresh, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.tokens[token]
+	if !ok {
+		return nil, fmt.Errorf("refresh token not found")
+	}
+	copied := *r
+	return &copied, nil
+}
+
+func (m *memRefreshService) PersistRefresh(r UserRefresh) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[r.RefreshToken] = &r
+	return nil
+}
+
+func (m *memRefreshService) DestroyRefresh(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tokens, token)
+	return nil
+}
+
+func (m *memRefreshService) RevokeRefresh(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[token].Revoked = true
+	return nil
+}
+
+func (m *memRefreshService) MarkRotated(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failMark != nil {
+		return m.failMark
+	}
+	if m.tokens[token].Rotated {
+		return ErrRefreshReused
+	}
+	m.tokens[token].Rotated = true
+	return nil
+}
+
+func (m *memRefreshService) RevokeFamily(familyId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoked = append(m.revoked, familyId)
+	for _, r := range m.tokens {
+		if r.FamilyId == familyId {
+			r.Revoked = true
+		}
+	}
+	return nil
+}
+
+var _ RefreshFamilyService[UserRefresh] = (*memRefreshService)(nil)
+
+// ---- StartFamily ----
+
+func TestStartFamily(t *testing.T) {
+
+	first := UserRefresh{RefreshToken: "token-1", RefreshIndex: "index-1"}
+	if err := StartFamily(&first); err != nil {
+		t.Fatalf("StartFamily() error: %v", err)
+	}
+	second := S2sRefresh{RefreshToken: "token-2", RefreshIndex: "index-2"}
+	if err := StartFamily(&second); err != nil {
+		t.Fatalf("StartFamily() error: %v", err)
+	}
+
+	if first.FamilyId == "" || second.FamilyId == "" {
+		t.Fatal("expected family ids to be set")
+	}
+	if first.FamilyId == second.FamilyId {
+		t.Error("expected each login to start a new family")
+	}
+	if first.ParentIndex != "" {
+		t.Errorf("parent index = %q, want empty for a family root", first.ParentIndex)
+	}
+}
+
+// ---- RotateRefresh ----
+
+func TestRotateRefresh(t *testing.T) {
+
+	ctx := context.Background()
+
+	// login -> rotate -> rotate
+	setup := func(t *testing.T) *memRefreshService {
+		t.Helper()
+		svc := newMemRefreshService()
+		root := UserRefresh{RefreshToken: "token-1", RefreshIndex: "index-1", Scopes: "r:gallery:*"}
+		if err := StartFamily(&root); err != nil {
+			t.Fatalf("StartFamily() error: %v", err)
+		}
+		if err := svc.PersistRefresh(root); err != nil {
+			t.Fatalf("PersistRefresh() error: %v", err)
+		}
+		if _, err := RotateRefresh(ctx, svc, "token-1", UserRefresh{RefreshToken: "token-2", RefreshIndex: "index-2"}); err != nil {
+			t.Fatalf("RotateRefresh() error: %v", err)
+		}
+		return svc
+	}
+
+	tests := []struct {
+		name       string
+		present    string
+		failMark   error
+		wantErr    bool
+		wantIs     error
+		wantRevoke bool
+	}{
+		{name: "rotate_latest", present: "token-2"},
+		{name: "reuse_rotated_token_revokes_family", present: "token-1", wantErr: true, wantIs: ErrRefreshReused, wantRevoke: true},
+		{name: "concurrent_rotation_revokes_family", present: "token-2", failMark: ErrRefreshReused, wantErr: true, wantIs: ErrRefreshReused, wantRevoke: true},
+		{name: "mark_rotated_failure", present: "token-2", failMark: errors.New("db down"), wantErr: true},
+		{name: "unknown_token", present: "token-x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := setup(t)
+			svc.failMark = tt.failMark
+			family := svc.tokens["token-1"].FamilyId
+
+			current, err := RotateRefresh(ctx, svc, tt.present, UserRefresh{RefreshToken: "token-3", RefreshIndex: "index-3"})
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("RotateRefresh() error: %v", err)
+				}
+				if current.RefreshToken != "token-2" {
+					t.Errorf("current = %q, want token-2", current.RefreshToken)
+				}
+				next := svc.tokens["token-3"]
+				if next.FamilyId != family || next.ParentIndex != "index-2" {
+					t.Errorf("next family/parent = %q/%q, want %q/index-2", next.FamilyId, next.ParentIndex, family)
+				}
+				if !svc.tokens["token-2"].Rotated {
+					t.Error("expected presented token to be marked rotated")
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("expected error wrapping %v, got %v", tt.wantIs, err)
+			}
+			if _, ok := svc.tokens["token-3"]; ok {
+				t.Error("expected no new token to be persisted")
+			}
+
+			if tt.wantRevoke {
+				if len(svc.revoked) != 1 || svc.revoked[0] != family {
+					t.Fatalf("revoked families = %v, want [%s]", svc.revoked, family)
+				}
+				for token, r := range svc.tokens {
+					if !r.Revoked {
+						t.Errorf("expected %s to be revoked with its family", token)
+					}
+				}
+			} else if len(svc.revoked) != 0 {
+				t.Errorf("revoked families = %v, want none", svc.revoked)
+			}
+		})
+	}
+}
+
+func TestRotateRefresh_RevokedFamily(t *testing.T) {
+
+	ctx := context.Background()
+	svc := newMemRefreshService()
+
+	root := UserRefresh{RefreshToken: "token-1", RefreshIndex: "index-1"}
+	if err := StartFamily(&root); err != nil {
+		t.Fatalf("StartFamily() error: %v", err)
+	}
+	svc.PersistRefresh(root)
+
+	if _, err := RotateRefresh(ctx, svc, "token-1", UserRefresh{RefreshToken: "token-2", RefreshIndex: "index-2"}); err != nil {
+		t.Fatalf("RotateRefresh() error: %v", err)
+	}
+
+	// the replayed token revokes the family, so the legitimate latest token is also dead
+	if _, err := RotateRefresh(ctx, svc, "token-1", UserRefresh{RefreshToken: "token-3", RefreshIndex: "index-3"}); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("replay error = %v, want %v", err, ErrRefreshReused)
+	}
+	if _, err := RotateRefresh(ctx, svc, "token-2", UserRefresh{RefreshToken: "token-4", RefreshIndex: "index-4"}); !errors.Is(err, ErrRefreshRevoked) {
+		t.Fatalf("latest token error = %v, want %v", err, ErrRefreshRevoked)
+	}
+}
+
+func TestRotateRefresh_LegacyToken(t *testing.T) {
+
+	ctx := context.Background()
+	svc := newMemRefreshService()
+
+	// persisted before family tracking: no family id
+	svc.PersistRefresh(UserRefresh{RefreshToken: "token-1", RefreshIndex: "index-1"})
+
+	if _, err := RotateRefresh(ctx, svc, "token-1", UserRefresh{RefreshToken: "token-2", RefreshIndex: "index-2"}); err != nil {
+		t.Fatalf("RotateRefresh() error: %v", err)
+	}
+	if got := svc.tokens["token-2"].FamilyId; got != "index-1" {
+		t.Fatalf("child family id = %q, want index-1", got)
+	}
+
+	// a replay of the legacy token resolves to its children's family
+	if _, err := RotateRefresh(ctx, svc, "token-1", UserRefresh{RefreshToken: "token-3", RefreshIndex: "index-3"}); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("replay error = %v, want %v", err, ErrRefreshReused)
+	}
+	if !svc.tokens["token-2"].Revoked {
+		t.Error("expected the legacy token's child to be revoked")
+	}
+}
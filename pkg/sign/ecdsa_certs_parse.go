@@ -1,7 +1,9 @@
 package sign
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
@@ -84,3 +86,83 @@ func ParsePublicEcdsaCert(publicKey string) (*ecdsa.PublicKey, error) {
 
 	return ecdsaPublicKey, nil
 }
+
+// ParsePrivateSigningKey is a helper function that parses a private jwt signing key in PKCS#8 pem format from
+// a base64 encoded string, for example, a kubernetes secret value.
+// Supports ecdsa keys (ES512, ES256) and ed25519 keys (EdDSA); SEC 1 ecdsa keys are parsed by ParsePrivateEcdsaCert.
+func ParsePrivateSigningKey(privateKey string) (crypto.Signer, error) {
+
+	block, err := decodePemBlock(privateKey, "private")
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS8 private key: %w", err)
+		}
+		switch k := key.(type) {
+		case *ecdsa.PrivateKey:
+			return k, nil
+		case ed25519.PrivateKey:
+			return k, nil
+		default:
+			return nil, fmt.Errorf("PKCS8 key is not an ECDSA or Ed25519 key")
+		}
+	case "EC PRIVATE KEY":
+		return ParsePrivateEcdsaCert(privateKey)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+}
+
+// ParsePublicSigningKey is a helper function that parses a public jwt signing key in PKIX pem format from
+// a base64 encoded string, for example, a kubernetes secret value.
+// Supports ecdsa keys (ES512, ES256) and ed25519 keys (EdDSA).
+func ParsePublicSigningKey(publicKey string) (crypto.PublicKey, error) {
+
+	block, err := decodePemBlock(publicKey, "public")
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+
+	genericPublicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key block to generic public key: %w", err)
+	}
+
+	switch k := genericPublicKey.(type) {
+	case *ecdsa.PublicKey:
+		return k, nil
+	case ed25519.PublicKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("value provided is not an ECDSA or Ed25519 public key")
+	}
+}
+
+// decodePemBlock is a helper function that decodes a base64 encoded pem string into its pem block.
+func decodePemBlock(encoded, kind string) (*pem.Block, error) {
+
+	if encoded == "" {
+		return nil, fmt.Errorf("%s key string provided is empty", kind)
+	}
+
+	keyPem, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s key from base64: %w", kind, err)
+	}
+
+	block, _ := pem.Decode(keyPem)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block from %s key", kind)
+	}
+
+	return block, nil
+}
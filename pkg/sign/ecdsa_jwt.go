@@ -1,7 +1,9 @@
 package sign
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
@@ -11,16 +13,35 @@ import (
 	"log/slog"
 
 	"github.com/tdeslauriers/carapace/internal/util"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
 	onepassword "github.com/tdeslauriers/carapace/pkg/one_password"
 )
 
+// KeyGenerator generates jwt signing key pairs and stores them in 1password.
 type KeyGenerator interface {
+
+	// GenerateEcdsaSigningKey generates an ES512 (ecdsa P-521) jwt signing key pair.
 	GenerateEcdsaSigningKey(service, env string) error
 }
 
+// SigningKeyGenerator is a KeyGenerator which generates jwt signing key pairs for any supported algorithm.
+// The KeyGenerator returned by NewKeyGenerator implements it.
+type SigningKeyGenerator interface {
+	KeyGenerator
+
+	// GenerateSigningKey generates a jwt signing key pair for the given algorithm, eg, jwt.ES512, jwt.ES256, or jwt.EdDSA.
+	GenerateSigningKey(service, env, alg string) error
+}
+
 var _ KeyGenerator = (*keyGenerator)(nil)
+var _ SigningKeyGenerator = (*keyGenerator)(nil)
 
 func NewKeyGenerator(op onepassword.Service) KeyGenerator {
+	return NewSigningKeyGenerator(op)
+}
+
+// NewSigningKeyGenerator creates a new SigningKeyGenerator interface with an underlying implementation.
+func NewSigningKeyGenerator(op onepassword.Service) SigningKeyGenerator {
 	return &keyGenerator{
 		op: op,
 
@@ -36,20 +57,26 @@ type keyGenerator struct {
 	logger *slog.Logger
 }
 
+// GenerateEcdsaSigningKey implements the KeyGenerator interface.
 func (kg *keyGenerator) GenerateEcdsaSigningKey(service, env string) error {
+	return kg.GenerateSigningKey(service, env, jwt.ES512)
+}
+
+// GenerateSigningKey implements the SigningKeyGenerator interface.
+func (kg *keyGenerator) GenerateSigningKey(service, env, alg string) error {
 
 	if service == "" || env == "" {
-		return fmt.Errorf("service name and env are required to generate ecdsa key pair")
+		return fmt.Errorf("service name and env are required to generate %s key pair", keyType(alg))
 	}
 
-	privateKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	privateKey, publicKey, err := generateKeyPair(alg)
 	if err != nil {
-		return fmt.Errorf("failed to generate ecdsa key: %w", err)
+		return err
 	}
 
 	privBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
 	if err != nil {
-		return fmt.Errorf("failed to marshal EC (ecdsa) private key: %w", err)
+		return fmt.Errorf("failed to marshal PKCS8 (%s) private key: %w", keyType(alg), err)
 	}
 
 	privPem :=
@@ -58,9 +85,9 @@ func (kg *keyGenerator) GenerateEcdsaSigningKey(service, env string) error {
 			Bytes: privBytes,
 		})
 
-	pubBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	pubBytes, err := x509.MarshalPKIXPublicKey(publicKey)
 	if err != nil {
-		return fmt.Errorf("failed to marshal PKIX (ecdsa) public key: %w", err)
+		return fmt.Errorf("failed to marshal PKIX (%s) public key: %w", keyType(alg), err)
 	}
 
 	pubPem :=
@@ -73,7 +100,8 @@ func (kg *keyGenerator) GenerateEcdsaSigningKey(service, env string) error {
 	pubBase64 := base64.StdEncoding.EncodeToString(pubPem)
 
 	kg.logger.Info(
-		"successfully generated jwt ecdsa key pair",
+		fmt.Sprintf("successfully generated jwt %s key pair", keyType(alg)),
+		slog.String("alg", alg),
 		slog.String("env", env),
 		slog.String("service", service),
 	)
@@ -92,13 +120,47 @@ func (kg *keyGenerator) GenerateEcdsaSigningKey(service, env string) error {
 	}
 
 	if err := kg.op.UpsertItem(item); err != nil {
-		return fmt.Errorf("failed to upsert ecdsa key pair to 1password: %w", err)
+		return fmt.Errorf("failed to upsert %s key pair to 1password: %w", keyType(alg), err)
 	}
 
 	kg.logger.Info(
-		"successfully upserted jwt signing ecdsa key pair in 1password",
+		fmt.Sprintf("successfully upserted jwt signing %s key pair in 1password", keyType(alg)),
 		slog.String("item_title", item.Title),
 	)
 
 	return nil
 }
+
+// generateKeyPair is a helper function that generates a key pair of the type bound to the jwt signing algorithm.
+func generateKeyPair(alg string) (crypto.PrivateKey, crypto.PublicKey, error) {
+	switch alg {
+	case jwt.ES512:
+		priv, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate ecdsa key: %w", err)
+		}
+		return priv, &priv.PublicKey, nil
+	case jwt.ES256:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate ecdsa key: %w", err)
+		}
+		return priv, &priv.PublicKey, nil
+	case jwt.EdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate ed25519 key: %w", err)
+		}
+		return priv, pub, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported jwt signing algorithm %q", alg)
+	}
+}
+
+// keyType is a helper function that returns the key type name of a jwt signing algorithm for messages.
+func keyType(alg string) string {
+	if alg == jwt.EdDSA {
+		return "ed25519"
+	}
+	return "ecdsa"
+}
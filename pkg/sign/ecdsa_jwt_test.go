@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/tdeslauriers/carapace/internal/util"
+	"github.com/tdeslauriers/carapace/pkg/jwt"
 	onepassword "github.com/tdeslauriers/carapace/pkg/one_password"
 )
 
@@ -246,3 +247,85 @@ func TestGenSigningKey(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateSigningKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		alg       string
+		wantErr   bool
+		errSubstr string
+	}{
+		{name: "es512", alg: jwt.ES512},
+		{name: "es256", alg: jwt.ES256},
+		{name: "eddsa", alg: jwt.EdDSA},
+		{
+			name:      "unsupported_alg",
+			alg:       "RS256",
+			wantErr:   true,
+			errSubstr: "unsupported jwt signing algorithm",
+		},
+		{
+			name:      "none_alg",
+			alg:       "none",
+			wantErr:   true,
+			errSubstr: "unsupported jwt signing algorithm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockOpService{}
+			kg := NewSigningKeyGenerator(mock)
+			err := kg.GenerateSigningKey("my-service", "prod", tt.alg)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("expected error containing %q, got %q", tt.errSubstr, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var privValue, pubValue string
+			for _, f := range mock.capturedItem.Fields {
+				switch f.Label {
+				case util.OpEcdsaPrivateKeyLabel:
+					privValue = f.Value
+				case util.OpEcdsaPublicKeyLabel:
+					pubValue = f.Value
+				}
+			}
+
+			// the generated pair must parse back and mint/verify under the requested alg
+			priv, err := ParsePrivateSigningKey(privValue)
+			if err != nil {
+				t.Fatalf("failed to parse generated private key: %v", err)
+			}
+			pub, err := ParsePublicSigningKey(pubValue)
+			if err != nil {
+				t.Fatalf("failed to parse generated public key: %v", err)
+			}
+
+			alg, err := jwt.AlgorithmForKey(pub)
+			if err != nil {
+				t.Fatalf("generated public key has no algorithm: %v", err)
+			}
+			if alg.Name() != tt.alg {
+				t.Errorf("alg: want %q, got %q", tt.alg, alg.Name())
+			}
+
+			sig, err := alg.Sign(priv, []byte("msg"))
+			if err != nil {
+				t.Fatalf("failed to sign with generated key: %v", err)
+			}
+			if err := alg.Verify(pub, []byte("msg"), sig); err != nil {
+				t.Fatalf("failed to verify with generated key: %v", err)
+			}
+		})
+	}
+}